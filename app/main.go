@@ -8,27 +8,107 @@
 // # Features
 //
 // Built-in Commands:
-//   - echo:   Print arguments to stdout
+//   - echo:   Print arguments to stdout (-n: no newline, -e/-E: escapes)
 //   - exit:  Terminate the shell
 //   - type: Display command type information
 //   - pwd:  Print working directory
-//   - cd:   Change directory (with tilde expansion)
+//   - cd:   Change directory (cd - returns to the previous one)
+//   - export: Export shell variables to external commands
+//   - unset:  Remove shell variables or array elements
+//   - break, continue: Leave a loop or skip to its next iteration
+//   - local, return: Function-local variables and return status
+//   - alias, unalias: Define, list and remove aliases
+//   - set:    Set the positional parameters (set -- a b) or list variables
+//   - declare: Create arrays (-a, -A), export (-x) or print (-p) variables
+//   - shopt:  Set shell options (nullglob, failglob)
 //
 // External Commands:
 //   - Any executable found in PATH
 //   - Full argument and quoting support
 //
+// Command Lists:
+//   - cmd1 ; cmd2  : Run cmd2 after cmd1
+//   - cmd1 && cmd2 : Run cmd2 only if cmd1 succeeded (exit status 0)
+//   - cmd1 || cmd2 : Run cmd2 only if cmd1 failed (non-zero exit status)
+//   - ! cmd        : Invert the exit status of a pipeline
+//
+// Conditionals:
+//   - if cmd; then ...; elif cmd; then ...; else ...; fi
+//   - The branch is chosen by the exit status of the condition
+//   - Redirections after fi apply to the whole command
+//
+// Case:
+//   - case word in pat1|pat2) ...;; *) ...;; esac
+//   - Patterns use *, ? and [...]; quoted characters match literally
+//   - ;& falls through to the next body, ;;& keeps testing patterns
+//
+// Loops:
+//   - for name in words; do ...; done
+//   - for ((init; condition; update)); do ...; done
+//   - while cmd; do ...; done and until cmd; do ...; done
+//   - break [N] and continue [N] unwind nested loops
+//
+// Functions:
+//   - name() { ...; } and function name { ...; }
+//   - Builtins come first, then functions, then PATH
+//   - $1..$n, $#, $@ per call; local variables and return N
+//
+// Special Parameters:
+//   - $? (last status), $$ (shell PID), $0 (script or shell name)
+//   - $#, $@ and $* for the positional parameters, which come from the
+//     script's arguments, a function call or set -- args
+//   - "$@" is one word per parameter, "$*" joins them with IFS
+//
+// Arrays:
+//   - arr=(a b c), arr[i]=value and ${arr[i]} with arithmetic subscripts
+//   - declare -A map for associative arrays: map[key]=value
+//   - "${arr[@]}", ${#arr[@]}, ${!arr[@]} and slices ${arr[@]:1:2}
+//
+// Aliases:
+//   - alias ll='ls -l' replaces ll at the start of a command with ls -l
+//   - Expanded when a line is parsed; a value ending in a blank also
+//     expands the next word
+//
+// Grouping:
+//   - { list; }  : Run a list in the current shell
+//   - ( list )   : Run a list in a subshell; cd, assignments and exit
+//     inside it do not affect the shell
+//
+// Pipelines:
+//   - cmd1 | cmd2 : Connect stdout of cmd1 to stdin of cmd2
+//   - Stages run concurrently; builtins may appear in any stage
+//
+// Process Substitution:
+//   - <(cmd) : A /dev/fd/N path to read the output of cmd from
+//   - >(cmd) : A /dev/fd/N path whose contents become the input of cmd
+//
 // I/O Redirection:
 //   - >   or 1>   :  Redirect stdout (overwrite)
 //   - >>  or 1>>  : Redirect stdout (append)
 //   - 2>          : Redirect stderr (overwrite)
 //   - 2>>         : Redirect stderr (append)
+//   - &> or &>>   : Redirect stdout and stderr together
+//   - 2>&1, 1>&2  : Duplicate one output stream onto the other
+//   - <           : Read stdin from a file
+//   - << and <<-  : Here-documents (<<- strips leading tabs)
+//   - <<<         : Here-strings
 //
 // Command Parsing:
 //   - Single-quoted strings (literal)
 //   - Double-quoted strings (with escape sequences)
+//   - ANSI-C quoted strings ($'a\tb', with \n, \t, \xHH, \uHHHH, \NNN, \e)
 //   - Backslash escaping
 //   - Whitespace handling
+//   - Operators need no spaces around them (echo hi>out.txt, cmd 2>&1)
+//   - Quoted operators are literal (echo ">" prints >)
+//   - Variable expansion ($NAME, ${NAME}) and NAME=value assignments
+//   - Parameter operators (${var:-default}, ${var#pat}, ${var/pat/rep}, ...)
+//   - Command substitution ($(cmd) and `cmd`)
+//   - Field splitting of unquoted expansion results by $IFS
+//   - Arithmetic expansion $((expr)) and ((expr)) commands
+//   - Tilde expansion (~, ~user, ~+, ~-) on every word
+//   - Brace expansion ({a,b}, {1..10}, {a..z..2})
+//   - Filename globbing (*, ?, [...]) on unquoted words
 //
 // # Installation
 //
@@ -67,7 +147,11 @@
 // # Exit Codes
 //
 //   - 0:   Normal termination (exit command)
-//   - 1:   Fatal error (I/O error, parse error)
+//   - N:   Status passed to exit N, or of the last command for a bare exit
+//   - 1:   Fatal error (I/O error)
+//   - 2:   The last command had a syntax error, or the input ended inside an
+//     unfinished command; the shell reports syntax errors and keeps running
+//   - 127: The script file could not be opened
 //
 // # Examples
 //
@@ -123,7 +207,7 @@
 //	┌──────────────────────────────────────┐
 //	│         Shell (REPL)                 │
 //	│  - Read commands                     │
-//	│  - Parse input                       │
+//	│  - Parse input into a syntax tree    │
 //	│  - Execute commands                  │
 //	│  - Handle errors                     │
 //	└──┬───────┬──────────┬────────────┬───┘
@@ -134,11 +218,8 @@
 // # Limitations
 //
 // The following features are not currently supported:
-//   - Pipes (|)
 //   - Background jobs (&)
-//   - Command substitution (`cmd` or $(cmd))
 //   - Wildcards/globbing (*, ?, [])
-//   - Environment variable expansion (except ~ in cd)
 //   - Job control (fg, bg, jobs)
 //   - Signal handling (Ctrl+C, Ctrl+Z)
 //   - Command history
@@ -173,22 +254,39 @@ var _ = os.Stdout
 // encounters a fatal error, the program exits with status code 1.
 //
 // Execution flow:
-//  1. Create shell instance with os.Stdin, os.Stdout, os.Stderr
+//  1. Create shell instance with os.Stdin, os.Stdout, os.Stderr, or with
+//     the script named by the first argument as its input
 //  2. Start the REPL with shell.Run()
 //  3. Run continues until:
 //     - User executes 'exit' command (normal termination, exit code 0)
+//     - The input ends (normal termination, status of the last command)
 //     - Fatal I/O error occurs (abnormal termination, exit code 1)
-//     - Fatal parse error occurs (abnormal termination, exit code 1)
 //
 // The shell runs in the foreground and blocks until termination.
 //
 // Exit behavior:
-//   - exit command:       shell.Run() returns nil, main exits normally (code 0)
-//   - I/O error:         shell.Run() returns error, log.Fatal exits with code 1
-//   - Parse error:       shell.Run() returns error, log.Fatal exits with code 1
+//   - exit command:       shell.Run() returns nil, main exits with the status
+//     passed to exit (or the status of the last command)
+//   - end of input:       shell.Run() returns nil, main exits with the status
+//     of the last command
+//   - I/O error:         shell.Run() returns error, which is logged, and main
+//     exits with code 1
+//
+// Syntax errors are not fatal: the shell reports them, sets the status to 2
+// and reads the next command. Incomplete commands, such as an unclosed
+// quote, are continued on the next line with the "> " prompt. Interactive
+// sessions show the line with a caret under the error, and scripts report
+// it as file:line:column:
+//
+//	$ ls | | wc
+//	syntax error near unexpected token `|' (expected a command)
+//	ls | | wc
+//	     ^
+//	$ ./shell build.sh
+//	build.sh:3:6: syntax error near unexpected token `|' (expected a command)
 //
 // Standard streams:
-//   - os.Stdin:  Used for reading user commands
+//   - os.Stdin:  Used for reading user commands, or by the commands of a script
 //   - os.Stdout: Used for command output and prompts
 //   - os. Stderr: Used for error messages
 //
@@ -200,13 +298,23 @@ var _ = os.Stdout
 //	$ exit
 //	[process exits with code 0]
 //
-// Example with error:
+// Example with a continued command:
 //
 //	$ ./shell
 //	$ echo "unclosed quote
-//	[shell terminates with parse error, code 1]
+//	> closed here"
+//	unclosed quote
+//	closed here
+//
+// To run a script, pass its path and any arguments. The script's lines are
+// read from the file instead of stdin, which the commands in the script
+// read instead, no prompts are printed, $0 is the script's path and $1,
+// $2, ... are the arguments. A script that cannot be opened exits with
+// code 127:
 //
-// For non-interactive use (scripting), redirect stdin from a file:
+//	$ ./shell build.sh release
+//
+// Input redirected from a file is also run, with $0 set to the shell:
 //
 //	$ ./shell < script.sh
 //
@@ -215,10 +323,44 @@ var _ = os.Stdout
 //	$ ./shell 2> debug.log
 func main() {
 
+	// ./shell script.sh args... runs the script with $1.. set to args
+	if len(os.Args) > 1 {
+		os.Exit(runScript(os.Args[1], os.Args[2:]))
+	}
+
 	s := shell.New(os.Stdin, os.Stdout, os.Stderr)
 
 	if err := s.Run(); err != nil {
 		log.Fatal(err)
 	}
 
+	os.Exit(s.ExitStatus())
+
+}
+
+// runScript runs the script at path with $1, $2, ... set to args and
+// returns the exit status for the process. The script's lines come from
+// the file, while the commands in it read the shell's own stdin, so
+// `echo data | ./shell script.sh` pipes data into the script's commands.
+//
+// The file is closed before returning, as os.Exit skips deferred calls.
+func runScript(path string, args []string) int {
+	script, err := os.Open(path)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+		return 127
+	}
+	defer script.Close()
+
+	s := shell.New(script, os.Stdout, os.Stderr)
+	s.SetScript(path, args)
+	s.SetStdin(os.Stdin)
+
+	if err := s.Run(); err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	return s.ExitStatus()
 }
@@ -0,0 +1,129 @@
+package shell
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// lookupAlias returns the value of an alias and whether it is defined. The
+// shell's parser uses it to expand aliases (see expandAlias).
+func (shell *Shell) lookupAlias(name string) (string, bool) {
+	value, ok := shell.aliases[name]
+	return value, ok
+}
+
+// isValidAliasName reports whether name can be defined as an alias: it must
+// be non-empty and free of blanks, quotes, expansions, "/" and the
+// characters of operators.
+func isValidAliasName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, " \t\n/$`=\\'\"|&;()<>")
+}
+
+// quoteAlias formats an alias definition the way alias prints it, as input
+// that defines it again: alias ll='ls -l'
+func quoteAlias(name, value string) string {
+	return "alias " + name + "=" + singleQuote(value)
+}
+
+// aliasBuiltin implements alias, which defines or prints aliases:
+// alias [-p] [name[=value] ...]
+//
+// Without names, or with -p, every alias is printed in a form that can be
+// read back as input, sorted by name. A name=value argument defines an
+// alias; a bare name prints its definition. The status is 1 if any name is
+// not an alias or cannot be defined.
+//
+// Aliases take effect when a command is parsed, so one defined on a line is
+// only used from the next line on.
+//
+// Example:
+//
+//	$ alias ll='ls -l' la='ls -a'
+//	$ alias
+//	alias la='ls -a'
+//	alias ll='ls -l'
+func aliasBuiltin(args []string, shell *Shell) (int, error) {
+
+	printAll := len(args) == 0
+
+	if len(args) > 0 && args[0] == "-p" {
+		args, printAll = args[1:], true
+	}
+
+	if printAll {
+		for _, name := range slices.Sorted(maps.Keys(shell.aliases)) {
+			if _, err := fmt.Fprintln(shell.Out, quoteAlias(name, shell.aliases[name])); err != nil {
+				return 1, err
+			}
+		}
+	}
+
+	status := 0
+
+	for _, arg := range args {
+		name, value, hasValue := strings.Cut(arg, "=")
+
+		if !hasValue {
+			if value, ok := shell.aliases[name]; ok {
+				if _, err := fmt.Fprintln(shell.Out, quoteAlias(name, value)); err != nil {
+					return 1, err
+				}
+				continue
+			}
+
+			fmt.Fprintf(shell.Err, "alias: %s: not found\n", name)
+			status = 1
+			continue
+		}
+
+		if !isValidAliasName(name) {
+			fmt.Fprintf(shell.Err, "alias: `%s': invalid alias name\n", name)
+			status = 1
+			continue
+		}
+
+		shell.aliases[name] = value
+	}
+
+	return status, nil
+}
+
+// unaliasBuiltin implements unalias, which removes aliases:
+// unalias [-a] name [name ...]
+//
+// With -a every alias is removed. The status is 1 if any name is not an
+// alias.
+//
+// Example:
+//
+//	$ unalias ll
+//	$ ll
+//	ll: command not found
+func unaliasBuiltin(args []string, shell *Shell) (int, error) {
+
+	if len(args) > 0 && args[0] == "-a" {
+		clear(shell.aliases)
+		return 0, nil
+	}
+
+	if len(args) == 0 {
+		fmt.Fprintln(shell.Err, "unalias: usage: unalias [-a] name [name ...]")
+		return 2, nil
+	}
+
+	status := 0
+
+	for _, name := range args {
+		if _, ok := shell.aliases[name]; !ok {
+			fmt.Fprintf(shell.Err, "unalias: %s: not found\n", name)
+			status = 1
+			continue
+		}
+
+		delete(shell.aliases, name)
+	}
+
+	return status, nil
+}
@@ -0,0 +1,155 @@
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParseTree_Aliases(t *testing.T) {
+
+	aliases := map[string]string{
+		"ll":    "ls -l",
+		"l":     "ls | less",
+		"ls":    "ls -F",
+		"a":     "b",
+		"b":     "a",
+		"sudo":  "sudo ",
+		"empty": "",
+		"loop":  "for x in 1 2; do echo $x; done",
+		"if":    "echo",
+		"bad":   `echo "a`,
+	}
+
+	parser := NewDefaultParser()
+	parser.SetAliases(func(name string) (string, bool) {
+		value, ok := aliases[name]
+		return value, ok
+	})
+
+	tests := []struct {
+		name        string
+		input       string
+		expected    string
+		expectedErr error
+	}{
+		{name: "first word", input: "ll /tmp", expected: "[ls -F -l /tmp]"},
+		{name: "only the first word", input: "echo ll", expected: "[echo ll]"},
+		{name: "quoted words are not aliases", input: `"ll"; \ll`, expected: `["ll"] ; [\ll]`},
+		{name: "value with operators", input: "l -a", expected: "[ls -F] | [less -a]"},
+		{name: "alias of itself", input: "ls", expected: "[ls -F]"},
+		{name: "aliases of each other", input: "a", expected: "[a]"},
+		{name: "trailing blank expands the next word", input: "sudo ll x", expected: "[sudo ls -F -l x]"},
+		{name: "without a trailing blank", input: "echo sudo ll", expected: "[echo sudo ll]"},
+		{name: "empty value", input: "empty ll", expected: "[ls -F -l]"},
+		{name: "after assignments", input: "A=1 ll", expected: "[=A=1 ls -F -l]"},
+		{name: "each command of a list", input: "ll && ll | ll", expected: "[ls -F -l] && [ls -F -l] | [ls -F -l]"},
+		{name: "compound command value", input: "loop", expected: "for x in 1 2 do [echo $x] done"},
+		{name: "inside compound commands", input: "if ll; then ll; fi", expected: "if [ls -F -l] then [ls -F -l] fi"},
+		{name: "reserved words are not aliases", input: "if a; then b; fi", expected: "if [a] then [b] fi"},
+		{name: "unclosed quote in a value", input: "bad", expectedErr: ErrUnclosedQuote},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			list, err := parser.ParseTree(tt.input)
+
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Errorf("Expected error: %v got %v", tt.expectedErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Expected no error got %v", err)
+				return
+			}
+
+			if got := describeList(list); got != tt.expected {
+				t.Errorf("input: %q\nexpected: %s\ngot:      %s", tt.input, tt.expected, got)
+			}
+
+		})
+
+	}
+
+}
+
+func TestAliasBuiltins(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		lines          []string
+		expected       string
+		expectedErr    string
+		expectedStatus int
+	}{
+		{name: "define and use", lines: []string{"alias hi='echo hello'", "hi there"}, expected: "hello there\n"},
+		{name: "not used on the defining line", lines: []string{"alias hi='echo hello'; hi"}, expectedErr: "hi: command not found\n", expectedStatus: 127},
+		{name: "list sorted", lines: []string{"alias b=2 a='x y'", "alias"}, expected: "alias a='x y'\nalias b='2'\n"},
+		{name: "list with -p", lines: []string{"alias q=\"it's\"", "alias -p"}, expected: "alias q='it'\\''s'\n"},
+		{name: "print one", lines: []string{"alias a=1 b=2", "alias b"}, expected: "alias b='2'\n"},
+		{name: "print unknown", lines: []string{"alias nope"}, expectedErr: "alias: nope: not found\n", expectedStatus: 1},
+		{name: "invalid name", lines: []string{"alias a/b=x"}, expectedErr: "alias: `a/b': invalid alias name\n", expectedStatus: 1},
+		{name: "unalias", lines: []string{"alias a=1 b=2", "unalias a", "alias"}, expected: "alias b='2'\n"},
+		{name: "unalias -a", lines: []string{"alias a=1 b=2", "unalias -a", "alias"}, expected: ""},
+		{name: "unalias unknown", lines: []string{"unalias nope"}, expectedErr: "unalias: nope: not found\n", expectedStatus: 1},
+		{name: "unalias without names", lines: []string{"unalias"}, expectedErr: "unalias: usage: unalias [-a] name [name ...]\n", expectedStatus: 2},
+		{name: "type", lines: []string{"alias ll='ls -l'", "type ll"}, expected: "ll is aliased to `ls -l`\n"},
+		{name: "recursive", lines: []string{"alias echo='echo [' e=echo", "e x"}, expected: "[ x\n"},
+		{name: "trailing blank", lines: []string{"alias run='command ' command='' hi='echo hi'", "run hi"}, expected: "hi\n"},
+		{name: "in functions", lines: []string{"alias hi='echo hello'", "f() { hi; }", "unalias hi", "f"}, expected: "hello\n"},
+		{name: "in subshells", lines: []string{"alias hi='echo hello'", "(hi); echo $(hi)"}, expected: "hello\nhello\n"},
+		{name: "subshells do not leak", lines: []string{"(alias hi='echo hello')", "alias"}, expected: ""},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			var stdout, stderr bytes.Buffer
+			sh := New(strings.NewReader(""), &stdout, &stderr)
+
+			for _, line := range tt.lines {
+				if err := sh.evaluate(line); err != nil {
+					t.Fatalf("Expected no error got %v", err)
+				}
+			}
+
+			if got := stdout.String(); got != tt.expected {
+				t.Errorf("lines: %q\nexpected: %q\ngot:      %q", tt.lines, tt.expected, got)
+			}
+
+			if got := stderr.String(); got != tt.expectedErr {
+				t.Errorf("expected stderr %q got %q", tt.expectedErr, got)
+			}
+
+			if sh.lastStatus != tt.expectedStatus {
+				t.Errorf("expected status %d got %d", tt.expectedStatus, sh.lastStatus)
+			}
+
+		})
+
+	}
+
+}
+
+func TestRun_AliasScript(t *testing.T) {
+
+	var stdout bytes.Buffer
+	sh := New(strings.NewReader("alias greet='echo hello'\ngreet world\n"), &stdout, io.Discard)
+
+	if err := sh.Run(); err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+
+	if got := stdout.String(); !strings.Contains(got, "hello world\n") {
+		t.Errorf("expected the alias to apply on the next line, got %q", got)
+	}
+
+}
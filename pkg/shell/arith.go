@@ -0,0 +1,713 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrDivisionByZero is returned when an arithmetic expression divides or
+// takes a remainder by zero.
+//
+// Example:
+//
+//	$ echo $((1 / 0))
+//	1 / 0: division by 0
+var ErrDivisionByZero = errors.New("division by 0")
+
+// ErrArithmeticSyntax is returned when an arithmetic expression cannot be
+// parsed, such as `1 +` or `(2`.
+var ErrArithmeticSyntax = errors.New("syntax error in expression")
+
+// maxArithmeticDepth bounds how deeply variable values may refer to other
+// variables (a=b, b=a) before evaluation gives up.
+const maxArithmeticDepth = 32
+
+// arithEnv gives the arithmetic evaluator access to shell variables and
+// array elements. elementKey resolves the subscript of a name[subscript]
+// operand into the key its element is stored under.
+//
+// Shell satisfies this interface; tests can use a map-backed implementation.
+type arithEnv interface {
+	getVar(name string) (string, bool)
+	setVar(name, value string)
+	elementKey(name, subscript string) (string, error)
+	getElement(name, key string) (string, bool)
+	setElement(name, key, value string)
+}
+
+// arithTokenKind classifies the tokens of an arithmetic expression.
+type arithTokenKind int
+
+const (
+	arithNumber   arithTokenKind = iota // Integer literal
+	arithName                           // Variable or array element reference
+	arithOperator                       // Operator or parenthesis
+	arithEOF                            // End of the expression
+)
+
+// arithToken is a single lexical token of an arithmetic expression.
+type arithToken struct {
+	kind  arithTokenKind
+	text  string // Source text (operator, name or name[subscript])
+	value int64  // Value of a number literal
+}
+
+// arithOperators lists every operator, longest first for maximal munch.
+var arithOperators = []string{
+	"<<=", ">>=",
+	"**", "++", "--", "<<", ">>", "<=", ">=", "==", "!=", "&&", "||",
+	"+=", "-=", "*=", "/=", "%=", "&=", "^=", "|=",
+	"+", "-", "*", "/", "%", "<", ">", "=", "!", "~", "&", "|", "^",
+	"?", ":", "(", ")", ",",
+}
+
+// arithAssignOps maps each assignment operator to the binary operator it
+// applies ("" for plain assignment).
+var arithAssignOps = map[string]string{
+	"=": "", "+=": "+", "-=": "-", "*=": "*", "/=": "/", "%=": "%",
+	"<<=": "<<", ">>=": ">>", "&=": "&", "^=": "^", "|=": "|",
+}
+
+// arithBinaryPrec gives the precedence of each binary operator; higher
+// binds tighter. Assignment, the ternary and the comma operator are handled
+// by dedicated parse functions below this level.
+var arithBinaryPrec = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"|":  3,
+	"^":  4,
+	"&":  5,
+	"==": 6, "!=": 6,
+	"<": 7, "<=": 7, ">": 7, ">=": 7,
+	"<<": 8, ">>": 8,
+	"+": 9, "-": 9,
+	"*": 10, "/": 10, "%": 10,
+	"**": 11,
+}
+
+// lexArithmetic splits an arithmetic expression into tokens.
+//
+// Number literals may be decimal (42), octal (017), hexadecimal (0x1F) or
+// use an explicit base between 2 and 64 (2#1010, 16#ff). A name directly
+// followed by [subscript] is a single token referring to an array element.
+//
+// Parameters:
+//   - expr: The expression text
+//
+// Returns:
+//   - []arithToken: The tokens, terminated by an arithEOF token
+//   - error: ErrArithmeticSyntax for characters or literals that are not valid
+func lexArithmetic(expr string) ([]arithToken, error) {
+	tokens := []arithToken{}
+	i := 0
+
+	for i < len(expr) {
+		ch := expr[i]
+
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			i++
+
+		case ch >= '0' && ch <= '9':
+			start := i
+			for i < len(expr) && (isNameStart(rune(expr[i])) || isDigit(expr[i]) || expr[i] == '#' || expr[i] == '@') {
+				i++
+			}
+
+			value, err := parseArithNumber(expr[start:i])
+			if err != nil {
+				return nil, err
+			}
+
+			tokens = append(tokens, arithToken{kind: arithNumber, text: expr[start:i], value: value})
+
+		case isNameStart(rune(ch)):
+			start := i
+			for i < len(expr) && (isNameStart(rune(expr[i])) || isDigit(expr[i])) {
+				i++
+			}
+
+			if i < len(expr) && expr[i] == '[' {
+				n := subscriptLength(expr[i:])
+				if n == 0 {
+					return nil, fmt.Errorf("%w: missing `]' (error token is %q)", ErrArithmeticSyntax, expr[start:])
+				}
+				i += n
+			}
+
+			tokens = append(tokens, arithToken{kind: arithName, text: expr[start:i]})
+
+		default:
+			op := matchOperator(expr[i:], arithOperators)
+			if op == "" {
+				return nil, fmt.Errorf("%w (error token is %q)", ErrArithmeticSyntax, expr[i:])
+			}
+
+			tokens = append(tokens, arithToken{kind: arithOperator, text: op})
+			i += len(op)
+		}
+	}
+
+	return append(tokens, arithToken{kind: arithEOF}), nil
+}
+
+// parseArithNumber converts an integer literal in shell notation to its value.
+func parseArithNumber(literal string) (int64, error) {
+	invalid := fmt.Errorf("%w: value too great for base (error token is %q)", ErrArithmeticSyntax, literal)
+
+	if base, digits, ok := strings.Cut(literal, "#"); ok {
+		b, err := strconv.Atoi(base)
+		if err != nil || b < 2 || b > 64 || digits == "" {
+			return 0, fmt.Errorf("%w: invalid arithmetic base (error token is %q)", ErrArithmeticSyntax, literal)
+		}
+
+		var value int64
+		for _, ch := range digits {
+			d := arithDigit(ch, b)
+			if d < 0 || d >= b {
+				return 0, invalid
+			}
+			value = value*int64(b) + int64(d)
+		}
+
+		return value, nil
+	}
+
+	value, err := strconv.ParseInt(literal, 0, 64)
+	if err != nil {
+		// leading zeros mean octal, which ParseInt handles; anything else is bad
+		return 0, invalid
+	}
+
+	return value, nil
+}
+
+// arithDigit returns the value of ch as a digit in the given base using the
+// shell's digit set: 0-9, a-z, A-Z, @ and _ (letters are case-insensitive
+// for bases up to 36).
+func arithDigit(ch rune, base int) int {
+	switch {
+	case ch >= '0' && ch <= '9':
+		return int(ch - '0')
+	case ch >= 'a' && ch <= 'z':
+		return int(ch-'a') + 10
+	case ch >= 'A' && ch <= 'Z':
+		if base <= 36 {
+			return int(ch-'A') + 10
+		}
+		return int(ch-'A') + 36
+	case ch == '@':
+		return 62
+	case ch == '_':
+		return 63
+	}
+
+	return -1
+}
+
+// isDigit reports whether ch is an ASCII decimal digit.
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+// arithEvaluator evaluates a token stream with precedence climbing.
+//
+// Evaluation happens during parsing. The skip counter is raised while
+// parsing operands that short-circuiting (&&, || and ?:) leaves unevaluated,
+// so assignments and division errors inside them have no effect.
+type arithEvaluator struct {
+	tokens []arithToken
+	pos    int
+	env    arithEnv
+	skip   int
+	depth  int
+}
+
+// evalArithmetic evaluates a shell arithmetic expression.
+//
+// Supported syntax, from lowest to highest precedence:
+//   - ,                       : Evaluate both sides, yield the right
+//   - = += -= *= /= %= <<= >>= &= ^= |= : Assignment to a variable
+//   - ?:                      : Ternary conditional
+//   - || &&                   : Logical or / and (short-circuiting)
+//   - | ^ &                   : Bitwise or / xor / and
+//   - == != < <= > >=         : Comparisons (1 for true, 0 for false)
+//   - << >>                   : Shifts
+//   - + - * / %               : Arithmetic
+//   - **                      : Exponentiation (right associative)
+//   - ! ~ + - ++x --x         : Unary operators and pre-increment
+//   - x++ x--                 : Post-increment / decrement
+//
+// Variables are referenced by name and array elements as name[subscript],
+// where the subscript of an indexed array is itself an expression. Unset or
+// empty variables are 0, and a variable whose value is itself an expression
+// is evaluated recursively.
+//
+// Parameters:
+//   - expr: The expression text (already expanded for $ and quotes)
+//   - env: Variable storage for references and assignments
+//
+// Returns:
+//   - int64: The value of the expression (0 for an empty expression)
+//   - error: ErrDivisionByZero or ErrArithmeticSyntax
+//
+// Examples:
+//
+//	evalArithmetic("1 + 2 * 3", env)     → 7
+//	evalArithmetic("2 ** 10", env)       → 1024
+//	evalArithmetic("x = 5, x += 2", env) → 7 (and x is set to 7)
+//	evalArithmetic("7 > 3 ? 1 : 0", env) → 1
+//	evalArithmetic("a[i+1] += 2", env)   → a[i+1] + 2 (and the element is set)
+func evalArithmetic(expr string, env arithEnv) (int64, error) {
+	return evalArithmeticDepth(expr, env, 0)
+}
+
+// evalArithmeticDepth evaluates expr at the given variable recursion depth.
+func evalArithmeticDepth(expr string, env arithEnv, depth int) (int64, error) {
+	if depth > maxArithmeticDepth {
+		return 0, fmt.Errorf("%w: expression recursion level exceeded", ErrArithmeticSyntax)
+	}
+
+	tokens, err := lexArithmetic(expr)
+	if err != nil {
+		return 0, err
+	}
+
+	// an empty expression evaluates to 0
+	if len(tokens) == 1 {
+		return 0, nil
+	}
+
+	evaluator := &arithEvaluator{tokens: tokens, env: env, depth: depth}
+
+	value, err := evaluator.parseComma()
+	if err != nil {
+		return 0, err
+	}
+
+	if tok := evaluator.peek(); tok.kind != arithEOF {
+		return 0, fmt.Errorf("%w (error token is %q)", ErrArithmeticSyntax, tok.text)
+	}
+
+	return value, nil
+}
+
+// peek returns the current token without consuming it.
+func (e *arithEvaluator) peek() arithToken {
+	return e.tokens[e.pos]
+}
+
+// next consumes and returns the current token.
+func (e *arithEvaluator) next() arithToken {
+	tok := e.tokens[e.pos]
+	if tok.kind != arithEOF {
+		e.pos++
+	}
+	return tok
+}
+
+// isOperator reports whether the current token is the operator op.
+func (e *arithEvaluator) isOperator(op string) bool {
+	tok := e.peek()
+	return tok.kind == arithOperator && tok.text == op
+}
+
+// expect consumes the operator op or reports a syntax error.
+func (e *arithEvaluator) expect(op string) error {
+	if !e.isOperator(op) {
+		return fmt.Errorf("%w: expected %q (error token is %q)", ErrArithmeticSyntax, op, e.peek().text)
+	}
+
+	e.next()
+	return nil
+}
+
+// parseComma parses a comma-separated list of assignments.
+func (e *arithEvaluator) parseComma() (int64, error) {
+	value, err := e.parseAssign()
+
+	for err == nil && e.isOperator(",") {
+		e.next()
+		value, err = e.parseAssign()
+	}
+
+	return value, err
+}
+
+// parseAssign parses an assignment or falls through to the ternary level.
+func (e *arithEvaluator) parseAssign() (int64, error) {
+	tok := e.peek()
+	following := e.tokens[min(e.pos+1, len(e.tokens)-1)]
+
+	if tok.kind == arithName && following.kind == arithOperator {
+		if binaryOp, ok := arithAssignOps[following.text]; ok {
+			e.pos += 2
+
+			value, err := e.parseAssign()
+			if err != nil {
+				return 0, err
+			}
+
+			if binaryOp != "" {
+				current, err := e.variable(tok.text)
+				if err != nil {
+					return 0, err
+				}
+
+				if value, err = e.apply(binaryOp, current, value); err != nil {
+					return 0, err
+				}
+			}
+
+			return value, e.assign(tok.text, value)
+		}
+	}
+
+	return e.parseTernary()
+}
+
+// parseTernary parses cond ? a : b, evaluating only the chosen branch.
+func (e *arithEvaluator) parseTernary() (int64, error) {
+	cond, err := e.parseBinary(1)
+	if err != nil || !e.isOperator("?") {
+		return cond, err
+	}
+
+	e.next()
+
+	thenValue, err := e.parseBranch(cond == 0, e.parseComma)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := e.expect(":"); err != nil {
+		return 0, err
+	}
+
+	elseValue, err := e.parseBranch(cond != 0, e.parseAssign)
+	if err != nil {
+		return 0, err
+	}
+
+	if cond != 0 {
+		return thenValue, nil
+	}
+
+	return elseValue, nil
+}
+
+// parseBranch runs parse, suppressing side effects when skip is true.
+func (e *arithEvaluator) parseBranch(skip bool, parse func() (int64, error)) (int64, error) {
+	if skip {
+		e.skip++
+		defer func() { e.skip-- }()
+	}
+
+	return parse()
+}
+
+// parseBinary parses binary operators with precedence of at least minPrec.
+func (e *arithEvaluator) parseBinary(minPrec int) (int64, error) {
+	lhs, err := e.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		tok := e.peek()
+		prec, ok := arithBinaryPrec[tok.text]
+
+		if tok.kind != arithOperator || !ok || prec < minPrec {
+			return lhs, nil
+		}
+
+		e.next()
+
+		// ** is right associative, everything else is left associative
+		nextPrec := prec + 1
+		if tok.text == "**" {
+			nextPrec = prec
+		}
+
+		// && and || skip their right operand once the result is known
+		skip := (tok.text == "&&" && lhs == 0) || (tok.text == "||" && lhs != 0)
+
+		rhs, err := e.parseBranch(skip, func() (int64, error) { return e.parseBinary(nextPrec) })
+		if err != nil {
+			return 0, err
+		}
+
+		if lhs, err = e.apply(tok.text, lhs, rhs); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// parseUnary parses prefix operators.
+func (e *arithEvaluator) parseUnary() (int64, error) {
+	tok := e.peek()
+
+	if tok.kind != arithOperator {
+		return e.parsePostfix()
+	}
+
+	switch tok.text {
+	case "++", "--":
+		e.next()
+
+		name := e.next()
+		if name.kind != arithName {
+			return 0, fmt.Errorf("%w: %s needs a variable (error token is %q)", ErrArithmeticSyntax, tok.text, name.text)
+		}
+
+		value, err := e.variable(name.text)
+		if err != nil {
+			return 0, err
+		}
+
+		if tok.text == "++" {
+			value++
+		} else {
+			value--
+		}
+
+		return value, e.assign(name.text, value)
+
+	case "!", "~", "+", "-":
+		e.next()
+
+		value, err := e.parseUnary()
+		if err != nil {
+			return 0, err
+		}
+
+		switch tok.text {
+		case "!":
+			return boolToInt(value == 0), nil
+		case "~":
+			return ^value, nil
+		case "-":
+			return -value, nil
+		}
+
+		return value, nil
+	}
+
+	return e.parsePostfix()
+}
+
+// parsePostfix parses a primary followed by an optional ++ or --.
+func (e *arithEvaluator) parsePostfix() (int64, error) {
+	tok := e.peek()
+
+	if tok.kind == arithName && (e.tokens[e.pos+1].text == "++" || e.tokens[e.pos+1].text == "--") {
+		e.pos += 2
+
+		value, err := e.variable(tok.text)
+		if err != nil {
+			return 0, err
+		}
+
+		next := value - 1
+		if e.tokens[e.pos-1].text == "++" {
+			next = value + 1
+		}
+
+		return value, e.assign(tok.text, next)
+	}
+
+	return e.parsePrimary()
+}
+
+// parsePrimary parses a number, a variable or a parenthesised expression.
+func (e *arithEvaluator) parsePrimary() (int64, error) {
+	tok := e.next()
+
+	switch tok.kind {
+	case arithNumber:
+		return tok.value, nil
+
+	case arithName:
+		return e.variable(tok.text)
+
+	case arithOperator:
+		if tok.text == "(" {
+			value, err := e.parseComma()
+			if err != nil {
+				return 0, err
+			}
+
+			if err := e.expect(")"); err != nil {
+				return 0, err
+			}
+
+			return value, nil
+		}
+	}
+
+	if tok.kind == arithEOF {
+		return 0, fmt.Errorf("%w: operand expected", ErrArithmeticSyntax)
+	}
+
+	return 0, fmt.Errorf("%w: operand expected (error token is %q)", ErrArithmeticSyntax, tok.text)
+}
+
+// variable returns the numeric value of a shell variable or, for a
+// name[subscript] reference, of an array element.
+func (e *arithEvaluator) variable(ref string) (int64, error) {
+	value, err := e.lookup(ref)
+	if err != nil {
+		return 0, err
+	}
+
+	value = strings.TrimSpace(value)
+
+	if value == "" {
+		return 0, nil
+	}
+
+	if n, err := parseArithNumber(value); err == nil {
+		return n, nil
+	}
+
+	return evalArithmeticDepth(value, e.env, e.depth+1)
+}
+
+// lookup returns the text of a variable or array element reference.
+func (e *arithEvaluator) lookup(ref string) (string, error) {
+	name, subscript, hasSubscript := splitSubscript(ref)
+
+	if !hasSubscript {
+		value, _ := e.env.getVar(name)
+		return value, nil
+	}
+
+	key, err := e.env.elementKey(name, subscript)
+	if err != nil {
+		return "", err
+	}
+
+	value, _ := e.env.getElement(name, key)
+	return value, nil
+}
+
+// assign stores value in a variable or array element unless evaluation is
+// being skipped.
+func (e *arithEvaluator) assign(ref string, value int64) error {
+	if e.skip > 0 {
+		return nil
+	}
+
+	name, subscript, hasSubscript := splitSubscript(ref)
+
+	if !hasSubscript {
+		e.env.setVar(name, strconv.FormatInt(value, 10))
+		return nil
+	}
+
+	key, err := e.env.elementKey(name, subscript)
+	if err != nil {
+		return err
+	}
+
+	e.env.setElement(name, key, strconv.FormatInt(value, 10))
+	return nil
+}
+
+// apply computes a binary operation.
+func (e *arithEvaluator) apply(op string, lhs, rhs int64) (int64, error) {
+	switch op {
+	case "+":
+		return lhs + rhs, nil
+	case "-":
+		return lhs - rhs, nil
+	case "*":
+		return lhs * rhs, nil
+	case "/", "%":
+		if rhs == 0 {
+			if e.skip > 0 {
+				return 0, nil
+			}
+			return 0, ErrDivisionByZero
+		}
+		if op == "/" {
+			return lhs / rhs, nil
+		}
+		return lhs % rhs, nil
+	case "**":
+		if rhs < 0 {
+			return 0, fmt.Errorf("%w: exponent less than 0", ErrArithmeticSyntax)
+		}
+		result := int64(1)
+		for ; rhs > 0; rhs-- {
+			result *= lhs
+		}
+		return result, nil
+	case "<<":
+		return lhs << uint64(rhs&63), nil
+	case ">>":
+		return lhs >> uint64(rhs&63), nil
+	case "&":
+		return lhs & rhs, nil
+	case "|":
+		return lhs | rhs, nil
+	case "^":
+		return lhs ^ rhs, nil
+	case "&&":
+		return boolToInt(lhs != 0 && rhs != 0), nil
+	case "||":
+		return boolToInt(lhs != 0 || rhs != 0), nil
+	case "==":
+		return boolToInt(lhs == rhs), nil
+	case "!=":
+		return boolToInt(lhs != rhs), nil
+	case "<":
+		return boolToInt(lhs < rhs), nil
+	case "<=":
+		return boolToInt(lhs <= rhs), nil
+	case ">":
+		return boolToInt(lhs > rhs), nil
+	case ">=":
+		return boolToInt(lhs >= rhs), nil
+	}
+
+	return 0, fmt.Errorf("%w (error token is %q)", ErrArithmeticSyntax, op)
+}
+
+// boolToInt converts a truth value to the shell's 1/0 representation.
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// runArithmeticCommand evaluates a ((expr)) command.
+//
+// The expression is expanded like the body of $((...)) and evaluated. The
+// exit status is 0 when the result is non-zero and 1 when it is zero, so
+// arithmetic tests combine with && and ||. Evaluation errors are printed
+// and also give status 1.
+//
+// Example:
+//
+//	$ ((count++)); ((count > 0)) && echo positive
+//	positive
+func (shell *Shell) runArithmeticCommand(expr string) int {
+	value, err := shell.expander.ExpandArithmetic(expr)
+
+	if err != nil {
+		if !shell.expansionFailure(err) {
+			fmt.Fprintln(shell.Err, err)
+		}
+		return 1
+	}
+
+	if value == "0" {
+		return 1
+	}
+
+	return 0
+}
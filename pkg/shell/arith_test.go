@@ -0,0 +1,146 @@
+package shell
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+// mapArithEnv stores arithmetic variables in a plain map for tests. Array
+// elements are stored under "name[index]".
+type mapArithEnv map[string]string
+
+func (m mapArithEnv) getVar(name string) (string, bool) {
+	value, ok := m[name]
+	return value, ok
+}
+
+func (m mapArithEnv) setVar(name, value string) {
+	m[name] = value
+}
+
+func (m mapArithEnv) elementKey(name, subscript string) (string, error) {
+	index, err := evalArithmetic(subscript, m)
+	return strconv.FormatInt(index, 10), err
+}
+
+func (m mapArithEnv) getElement(name, key string) (string, bool) {
+	return m.getVar(name + "[" + key + "]")
+}
+
+func (m mapArithEnv) setElement(name, key, value string) {
+	m.setVar(name+"["+key+"]", value)
+}
+
+func TestEvalArithmetic(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		input       string
+		expected    int64
+		expectedErr error
+	}{
+		{name: "empty expression", input: "  ", expected: 0},
+		{name: "precedence", input: "1 + 2 * 3", expected: 7},
+		{name: "parentheses", input: "(1 + 2) * 3", expected: 9},
+		{name: "division truncates", input: "7 / 2", expected: 3},
+		{name: "remainder", input: "7 % 3", expected: 1},
+		{name: "power is right associative", input: "2 ** 3 ** 2", expected: 512},
+		{name: "unary minus binds tighter than power", input: "-2 ** 2", expected: 4},
+		{name: "comparisons", input: "(3 < 4) + (3 >= 4) + (2 == 2) + (2 != 2)", expected: 2},
+		{name: "logical operators", input: "!0 && (0 || 5)", expected: 1},
+		{name: "bitwise operators", input: "(6 & 3) | (1 << 4) ^ ~0", expected: ^int64(16) | 2},
+		{name: "ternary", input: "5 > 3 ? 10 : 20", expected: 10},
+		{name: "nested ternary", input: "0 ? 1 : 0 ? 2 : 3", expected: 3},
+		{name: "hex octal and base literals", input: "0x10 + 010 + 2#101", expected: 29},
+		{name: "variable reference", input: "x * 2", expected: 84},
+		{name: "unset variable is zero", input: "missing + 1", expected: 1},
+		{name: "variable holding an expression", input: "expr", expected: 43},
+		{name: "array element", input: "a[1] + a[x - 41] * 2", expected: 12},
+		{name: "unset array element is zero", input: "a[5] + 1", expected: 1},
+		{name: "unclosed subscript", input: "a[1 + 2", expectedErr: ErrArithmeticSyntax},
+		{name: "comma yields last value", input: "1, 2, 3", expected: 3},
+		{name: "short circuit avoids division by zero", input: "0 && 1 / 0", expected: 0},
+		{name: "division by zero", input: "1 / 0", expectedErr: ErrDivisionByZero},
+		{name: "remainder by zero", input: "1 % 0", expectedErr: ErrDivisionByZero},
+		{name: "missing operand", input: "1 +", expectedErr: ErrArithmeticSyntax},
+		{name: "unbalanced parenthesis", input: "(1 + 2", expectedErr: ErrArithmeticSyntax},
+		{name: "invalid character", input: "1 $ 2", expectedErr: ErrArithmeticSyntax},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			env := mapArithEnv{"x": "42", "expr": "x + 1", "a[1]": "4"}
+			res, err := evalArithmetic(tt.input, env)
+
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Errorf("Expected error: %v got %v", tt.expectedErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Expected no error got %v", err)
+				return
+			}
+
+			if res != tt.expected {
+				t.Errorf("input: %q\nexpected: %d\ngot:      %d", tt.input, tt.expected, res)
+			}
+
+		})
+
+	}
+
+}
+
+func TestEvalArithmeticAssignment(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		input     string
+		expected  int64
+		variables map[string]string
+	}{
+		{name: "plain assignment", input: "a = 5", expected: 5, variables: map[string]string{"a": "5"}},
+		{name: "compound assignment", input: "n += 3", expected: 13, variables: map[string]string{"n": "13"}},
+		{name: "shift assignment", input: "n <<= 2", expected: 40, variables: map[string]string{"n": "40"}},
+		{name: "chained assignment", input: "a = b = 2", expected: 2, variables: map[string]string{"a": "2", "b": "2"}},
+		{name: "pre increment", input: "++n", expected: 11, variables: map[string]string{"n": "11"}},
+		{name: "post increment", input: "n++", expected: 10, variables: map[string]string{"n": "11"}},
+		{name: "post decrement", input: "n--", expected: 10, variables: map[string]string{"n": "9"}},
+		{name: "element assignment", input: "a[n - 9] += 5", expected: 12, variables: map[string]string{"a[1]": "12"}},
+		{name: "element increment", input: "a[1]++ + ++a[2]", expected: 8, variables: map[string]string{"a[1]": "8", "a[2]": "1"}},
+		{name: "skipped branch has no side effects", input: "1 ? n : (n = 99)", expected: 10, variables: map[string]string{"n": "10"}},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			env := mapArithEnv{"n": "10", "a[1]": "7"}
+			res, err := evalArithmetic(tt.input, env)
+
+			if err != nil {
+				t.Errorf("Expected no error got %v", err)
+				return
+			}
+
+			if res != tt.expected {
+				t.Errorf("input: %q\nexpected: %d\ngot:      %d", tt.input, tt.expected, res)
+			}
+
+			for name, value := range tt.variables {
+				if env[name] != value {
+					t.Errorf("expected %s=%s, got %s=%s", name, value, name, env[name])
+				}
+			}
+
+		})
+
+	}
+
+}
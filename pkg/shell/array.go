@@ -0,0 +1,690 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrBadSubscript is returned when an array subscript cannot be used, such
+// as a negative index before the first element.
+//
+// Example input that triggers this error:
+//
+//	$ arr=(a b); arr[-5]=x
+//	arr[-5]: bad array subscript
+var ErrBadSubscript = errors.New("bad array subscript")
+
+// ErrNegativeLength is returned by ${arr[@]:offset:length} when the length
+// is negative.
+var ErrNegativeLength = errors.New("substring expression < 0")
+
+// varKind identifies the type of value a shell variable holds.
+type varKind int
+
+const (
+	scalarVar  varKind = iota // A single string
+	indexedVar                // An indexed array: elements by non-negative integer index
+	assocVar                  // An associative array: elements by string key
+)
+
+// arrayElement is one element of an array assignment, NAME=(...), after
+// expansion: a value, optionally with the [key]= it was written with.
+type arrayElement struct {
+	key    string // The subscript, for [key]=value elements
+	hasKey bool
+	value  string
+}
+
+// listExpansion is a parameter expansion that stands for a list of values
+// rather than a single one:
+//   - $@ and $*: The positional parameters
+//   - ${name[@]} and ${name[*]}: The elements of an array
+//   - ${!name[@]} and ${!name[*]}: The indices or keys of an array
+//   - ${name[@]:offset} and ${name[@]:offset:length}: A slice of the
+//     elements, as for ${@:offset:length}
+//
+// Inside double quotes, the @ forms are one word per value and the * forms
+// a single word with the values joined by the first character of IFS.
+type listExpansion struct {
+	name     string // The array name, or "@" for the positional parameters
+	keys     bool   // Whether the indices or keys are wanted instead of the values
+	joined   bool   // Whether this is a * form
+	slice    string // The "offset[:length]" of a slice
+	hasSlice bool
+}
+
+// parseListExpansion recognises the list forms of a parameter expansion
+// (see listExpansion) in the text of a $name or ${...} expansion.
+//
+// Example:
+//
+//	parseListExpansion("arr[@]:1:2") → {name: "arr", slice: "1:2", hasSlice: true}, true
+//	parseListExpansion("arr[1]")     → {}, false
+func parseListExpansion(expr string) (listExpansion, bool) {
+	var list listExpansion
+	var rest string
+
+	if expr != "" && (expr[0] == '@' || expr[0] == '*') {
+		list.name, list.joined, rest = "@", expr[0] == '*', expr[1:]
+	} else {
+		list.keys = strings.HasPrefix(expr, "!")
+		body := strings.TrimPrefix(expr, "!")
+		nameEnd := paramNameLength(body)
+		name, subscript := body[:nameEnd], body[nameEnd:]
+
+		if !isValidName(name) || !(strings.HasPrefix(subscript, "[@]") || strings.HasPrefix(subscript, "[*]")) {
+			return listExpansion{}, false
+		}
+
+		list.name, list.joined, rest = name, subscript[1] == '*', subscript[3:]
+	}
+
+	if rest == "" {
+		return list, true
+	}
+
+	// ${arr[@]:-word} is an operator on the joined values, not a slice
+	if list.keys || rest[0] != ':' || (len(rest) > 1 && strings.ContainsRune("-=?+", rune(rest[1]))) {
+		return listExpansion{}, false
+	}
+
+	list.slice, list.hasSlice = rest[1:], true
+	return list, true
+}
+
+// joinSeparator returns the text that joins the values of a list
+// expansion into one word: a space for the @ forms, and the first
+// character of ifs for the * forms.
+func (list listExpansion) joinSeparator(ifs string) string {
+	if !list.joined {
+		return " "
+	}
+
+	for _, ch := range ifs {
+		return string(ch)
+	}
+
+	return ""
+}
+
+// subscriptLength returns the length of the [subscript] at the start of s,
+// brackets included, or 0 if s does not start with one. Brackets inside
+// the subscript are balanced and quoted text is skipped, so
+// map["a]"] has the subscript "a]" in quotes.
+func subscriptLength(s string) int {
+	if !strings.HasPrefix(s, "[") {
+		return 0
+	}
+
+	depth := 0
+	var quote byte
+
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\\':
+			i++
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '[':
+			depth++
+		case ch == ']':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+
+	return 0
+}
+
+// elementKeyLength returns the length of the [key]= at the start of an
+// element of an array assignment, or 0 if the element has no key.
+func elementKeyLength(rest string) int {
+	n := subscriptLength(rest)
+
+	if n == 0 || !strings.HasPrefix(rest[n:], "=") {
+		return 0
+	}
+
+	return n + 1
+}
+
+// splitSubscript splits a NAME[subscript] reference into the name and the
+// subscript. A reference without a subscript has hasSubscript false.
+func splitSubscript(ref string) (name, subscript string, hasSubscript bool) {
+	name, rest, found := strings.Cut(ref, "[")
+
+	if !found || !strings.HasSuffix(rest, "]") {
+		return ref, "", false
+	}
+
+	return name, rest[:len(rest)-1], true
+}
+
+// expandArrayElements expands the text between the parentheses of an array
+// assignment, NAME=(...), into its elements.
+//
+// Elements are separated by whitespace. A [key]=value element has its key
+// and value expanded as single words; the [key]= is read as a whole, so the
+// key may contain quotes and blanks. Any other element is expanded like a
+// command argument, so it may produce several elements through field
+// splitting, brace expansion or filename expansion, or none at all.
+//
+// Parameters:
+//   - text: The text between the parentheses
+//
+// Returns:
+//   - []arrayElement: The elements in order
+//   - error: Quoting and expansion errors
+//
+// Example:
+//
+//	expandArrayElements(`a "b c" [5]=d ["e f"]=g`) → {a}, {b c}, {key: 5, d}, {key: e f, g}
+func (p *DefaultParser) expandArrayElements(text string) ([]arrayElement, error) {
+	s := p.newSourceReader(text)
+	elements := []arrayElement{}
+
+	for {
+		rest := strings.TrimLeftFunc(s.rest(), unicode.IsSpace)
+		s.skip(len(s.rest()) - len(rest))
+
+		if rest == "" {
+			return elements, nil
+		}
+
+		if n := elementKeyLength(rest); n > 0 {
+			s.skip(n)
+			rawValue := ""
+
+			// [key]= followed by a blank assigns the empty string
+			if s.rest() != "" && !startsWithSpace(s.rest()) {
+				word, err := readWord(s, startsWithSpace)
+				if err != nil {
+					return nil, err
+				}
+
+				rawValue = word.Raw
+			}
+
+			key, err := p.ExpandWord(rest[1 : n-2])
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := p.ExpandWord(rawValue)
+			if err != nil {
+				return nil, err
+			}
+
+			elements = append(elements, arrayElement{key: key, hasKey: true, value: value})
+			continue
+		}
+
+		word, err := readWord(s, startsWithSpace)
+		if err != nil {
+			return nil, err
+		}
+
+		values, err := p.ExpandWords([]*Word{word})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, value := range values {
+			elements = append(elements, arrayElement{value: value})
+		}
+	}
+}
+
+// clone returns a copy of the variable that shares no elements with it.
+func (v *shellVariable) clone() *shellVariable {
+	copied := *v
+	copied.elements = maps.Clone(v.elements)
+	return &copied
+}
+
+// keys returns the indices or keys of the variable's elements in order:
+// indices in increasing order, and associative keys sorted. A scalar has
+// the single index 0.
+func (v *shellVariable) keys() []string {
+	if v.kind == scalarVar {
+		return []string{"0"}
+	}
+
+	keys := slices.Collect(maps.Keys(v.elements))
+
+	if v.kind == assocVar {
+		slices.Sort(keys)
+		return keys
+	}
+
+	slices.SortFunc(keys, func(a, b string) int {
+		x, _ := strconv.Atoi(a)
+		y, _ := strconv.Atoi(b)
+		return x - y
+	})
+
+	return keys
+}
+
+// values returns the values of the variable's elements, in the order of
+// keys.
+func (v *shellVariable) values() []string {
+	if v.kind == scalarVar {
+		return []string{v.value}
+	}
+
+	values := []string{}
+	for _, key := range v.keys() {
+		values = append(values, v.elements[key])
+	}
+
+	return values
+}
+
+// maxIndex returns the highest index of an indexed array, or -1 when it
+// has no elements.
+func (v *shellVariable) maxIndex() int {
+	if v.kind == scalarVar {
+		return 0
+	}
+
+	keys := v.keys()
+
+	if len(keys) == 0 {
+		return -1
+	}
+
+	n, _ := strconv.Atoi(keys[len(keys)-1])
+	return n
+}
+
+// format renders the value as it appears after NAME= in the output of set
+// and declare -p: a quoted string, or ([key]='value' ...) for arrays.
+func (v *shellVariable) format() string {
+	if v.kind == scalarVar {
+		return singleQuote(v.value)
+	}
+
+	var elements []string
+	for _, key := range v.keys() {
+		elements = append(elements, "["+key+"]="+singleQuote(v.elements[key]))
+	}
+
+	return "(" + strings.Join(elements, " ") + ")"
+}
+
+// elementKey resolves an expanded subscript of the variable name into the
+// key its element is stored under.
+//
+// Associative arrays use the subscript as it is. For anything else the
+// subscript is an arithmetic expression giving the index; a negative index
+// counts back from the end of the array.
+//
+// Returns:
+//   - string: The key, or the index in decimal
+//   - error: *ExpansionError for invalid expressions and indices
+func (shell *Shell) elementKey(name, subscript string) (string, error) {
+	v, exists := shell.vars[name]
+
+	if exists && v.kind == assocVar {
+		return subscript, nil
+	}
+
+	index, err := evalArithmetic(subscript, shell)
+
+	if err != nil {
+		return "", &ExpansionError{Param: subscript, Err: err}
+	}
+
+	if index < 0 && exists {
+		index += int64(v.maxIndex()) + 1
+	}
+
+	if index < 0 {
+		return "", &ExpansionError{Param: name + "[" + subscript + "]", Err: ErrBadSubscript}
+	}
+
+	return strconv.FormatInt(index, 10), nil
+}
+
+// getElement returns the element of variable name stored under key, and
+// whether it is set. Element 0 of a scalar is its value.
+func (shell *Shell) getElement(name, key string) (string, bool) {
+	v, ok := shell.vars[name]
+
+	if !ok {
+		return "", false
+	}
+
+	if v.kind == scalarVar {
+		return v.value, key == "0"
+	}
+
+	value, ok := v.elements[key]
+	return value, ok
+}
+
+// setElement assigns the element of variable name stored under key. An
+// unset variable becomes an indexed array, and a scalar one whose element
+// 0 is the old value.
+func (shell *Shell) setElement(name, key, value string) {
+	v, ok := shell.vars[name]
+
+	if !ok {
+		v = &shellVariable{kind: indexedVar}
+		shell.vars[name] = v
+	}
+
+	if v.kind == scalarVar {
+		if key == "0" {
+			shell.setVar(name, value)
+			return
+		}
+
+		v.kind, v.elements = indexedVar, map[string]string{"0": v.value}
+	}
+
+	if v.elements == nil {
+		v.elements = map[string]string{}
+	}
+
+	v.elements[key] = value
+}
+
+// assign performs the assignment of an expanded NAME=value or
+// NAME[subscript]=value word.
+//
+// Returns:
+//   - error: *ExpansionError for invalid subscripts
+func (shell *Shell) assign(ref, value string) error {
+	name, subscript, hasSubscript := splitSubscript(ref)
+
+	if !hasSubscript {
+		shell.setVar(name, value)
+		return nil
+	}
+
+	key, err := shell.elementKey(name, subscript)
+
+	if err != nil {
+		return err
+	}
+
+	shell.setElement(name, key, value)
+	return nil
+}
+
+// assignArray replaces the elements of variable name with those of an
+// array assignment.
+//
+// An associative array stays associative, and every element needs a key.
+// Otherwise the variable becomes an indexed array: elements without a key
+// take the index after the previous element, starting at 0, and a [N]=
+// key sets the index.
+//
+// Example:
+//
+//	$ arr=(a [5]=b c); echo ${!arr[@]}
+//	0 5 6
+func (shell *Shell) assignArray(name string, elements []arrayElement) error {
+	v, ok := shell.vars[name]
+
+	if !ok {
+		v = &shellVariable{}
+		shell.vars[name] = v
+	}
+
+	if v.kind != assocVar {
+		v.kind = indexedVar
+	}
+
+	v.value, v.elements = "", map[string]string{}
+	next := 0
+
+	for _, element := range elements {
+		if v.kind == assocVar && !element.hasKey {
+			return &ExpansionError{Param: name, Err: errors.New("must use subscript when assigning associative array")}
+		}
+
+		if !element.hasKey {
+			v.elements[strconv.Itoa(next)] = element.value
+			next++
+			continue
+		}
+
+		key, err := shell.elementKey(name, element.key)
+
+		if err != nil {
+			return err
+		}
+
+		v.elements[key] = element.value
+		next, _ = strconv.Atoi(key)
+		next++
+	}
+
+	return nil
+}
+
+// unsetElement removes one element of an array: unset 'arr[1]'.
+func (shell *Shell) unsetElement(name, subscript string) error {
+	v, ok := shell.vars[name]
+
+	if !ok {
+		return nil
+	}
+
+	key, err := shell.elementKey(name, subscript)
+
+	if err != nil {
+		return err
+	}
+
+	if v.kind == scalarVar {
+		if key == "0" {
+			shell.unsetVar(name)
+		}
+		return nil
+	}
+
+	delete(v.elements, key)
+	return nil
+}
+
+// declareBuiltin implements declare, which sets the type and attributes
+// of variables, assigns them, or prints them:
+// declare [-aAgpx] [name[=value] ...]
+//
+// Options:
+//   - -a: Make each name an indexed array
+//   - -A: Make each name an associative array
+//   - -x: Export each name
+//   - -g: Inside a function, work on the global variables
+//   - -p: Print each name, or every variable without names, as a declare
+//     command
+//
+// A value of the form (...) is an array assignment, as in
+// declare -A map=([k]=v). Without names, declare prints every variable like
+// -p. Inside a function, declare makes its names local unless -g is given.
+// The status is 1 if any name is invalid, cannot change type or cannot be
+// printed, and 2 for an unknown option.
+//
+// Example:
+//
+//	$ declare -A color=([apple]=red)
+//	$ color[lime]=green
+//	$ declare -p color
+//	declare -A color=([apple]='red' [lime]='green')
+func declareBuiltin(args []string, shell *Shell) (int, error) {
+	return declareVariables("declare", args, shell, len(shell.frames) > 0)
+}
+
+// declareVariables runs declare and local, which differ only in whether
+// the names are made local to the running function.
+func declareVariables(command string, args []string, shell *Shell, local bool) (int, error) {
+	var kind varKind
+	var export, print bool
+
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		if args[0] == "--" {
+			args = args[1:]
+			break
+		}
+
+		for _, flag := range args[0][1:] {
+			switch flag {
+			case 'a':
+				kind = indexedVar
+			case 'A':
+				kind = assocVar
+			case 'x':
+				export = true
+			case 'p':
+				print = true
+			case 'g':
+				local = false
+			default:
+				fmt.Fprintf(shell.Err, "%s: -%c: invalid option\n", command, flag)
+				return 2, nil
+			}
+		}
+
+		args = args[1:]
+	}
+
+	if len(args) == 0 && command == "declare" {
+		for _, name := range slices.Sorted(maps.Keys(shell.vars)) {
+			if _, err := fmt.Fprintln(shell.Out, shell.declaration(name)); err != nil {
+				return 1, err
+			}
+		}
+		return 0, nil
+	}
+
+	status := 0
+
+	for _, arg := range args {
+		ref, value, hasValue := strings.Cut(arg, "=")
+		name, _, _ := splitSubscript(ref)
+
+		if !isValidName(name) {
+			fmt.Fprintf(shell.Err, "%s: `%s': not a valid identifier\n", command, arg)
+			status = 1
+			continue
+		}
+
+		if print {
+			if _, ok := shell.vars[name]; !ok {
+				fmt.Fprintf(shell.Err, "%s: %s: not found\n", command, name)
+				status = 1
+				continue
+			}
+
+			if _, err := fmt.Fprintln(shell.Out, shell.declaration(name)); err != nil {
+				return 1, err
+			}
+			continue
+		}
+
+		if local {
+			shell.declareLocal(name)
+		}
+
+		if err := shell.setKind(name, kind); err != nil {
+			fmt.Fprintf(shell.Err, "%s: %v\n", command, err)
+			status = 1
+			continue
+		}
+
+		if err := shell.declareValue(ref, value, hasValue); err != nil {
+			fmt.Fprintf(shell.Err, "%s: %v\n", command, err)
+			status = 1
+			continue
+		}
+
+		if export {
+			shell.exportVar(name)
+		}
+	}
+
+	return status, nil
+}
+
+// setKind gives variable name the type requested by declare -a or -A,
+// creating it if needed. A scalar becomes an array whose element 0 is its
+// value; an associative array cannot become indexed or the other way round.
+func (shell *Shell) setKind(name string, kind varKind) error {
+	if kind == scalarVar {
+		return nil
+	}
+
+	v, ok := shell.vars[name]
+
+	if !ok {
+		shell.vars[name] = &shellVariable{kind: kind, elements: map[string]string{}}
+		return nil
+	}
+
+	switch {
+	case v.kind == kind:
+		return nil
+	case v.kind == scalarVar:
+		v.kind, v.elements, v.value = kind, map[string]string{"0": v.value}, ""
+		return nil
+	case kind == indexedVar:
+		return fmt.Errorf("%s: cannot convert associative to indexed array", name)
+	default:
+		return fmt.Errorf("%s: cannot convert indexed to associative array", name)
+	}
+}
+
+// declareValue performs the assignment part of a declare or local
+// argument, if it has one. A value of the form (...) is an array
+// assignment, whose elements are expanded now.
+func (shell *Shell) declareValue(ref, value string, hasValue bool) error {
+	if !hasValue {
+		// declare name creates name, unset but known to local
+		return nil
+	}
+
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") && isValidName(ref) {
+		elements, err := shell.parser.expandArrayElements(value[1 : len(value)-1])
+
+		if err != nil {
+			return err
+		}
+
+		return shell.assignArray(ref, elements)
+	}
+
+	return shell.assign(ref, value)
+}
+
+// declaration formats variable name as the declare command that recreates
+// it, as printed by declare -p: declare -a arr=([0]='x').
+func (shell *Shell) declaration(name string) string {
+	v := shell.vars[name]
+
+	flags := map[varKind]string{scalarVar: "", indexedVar: "a", assocVar: "A"}[v.kind]
+
+	if v.exported {
+		flags += "x"
+	}
+
+	if flags == "" {
+		flags = "-"
+	}
+
+	return "declare -" + flags + " " + name + "=" + v.format()
+}
@@ -0,0 +1,70 @@
+package shell
+
+import (
+	"testing"
+)
+
+func TestArrays(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		script         string
+		expected       string
+		expectedStatus int
+	}{
+		{name: "element", script: "arr=(a 'b c' d); echo ${arr[1]}", expected: "b c\n"},
+		{name: "name alone is element 0", script: "arr=(a b); echo $arr", expected: "a\n"},
+		{name: "assign an element", script: "arr=(a); arr[3]=x; echo ${arr[@]}", expected: "a x\n"},
+		{name: "arithmetic subscript", script: "i=1; n=(10 20 30); echo ${n[i+1]} ${n[$i-1]}", expected: "30 10\n"},
+		{name: "negative subscript", script: "n=(10 20 30); echo ${n[-1]}", expected: "30\n"},
+		{name: "quoted @ keeps each element", script: "arr=(a 'b c'); for x in \"${arr[@]}\"; do echo \"[$x]\"; done", expected: "[a]\n[b c]\n"},
+		{name: "quoted @ in an assignment", script: "arr=(a 'b c' d); y=\"${arr[@]}\"; echo \"[$y]\"", expected: "[a b c d]\n"},
+		{name: "quoted * is one word", script: "arr=(a 'b c'); for x in \"${arr[*]}\"; do echo \"[$x]\"; done", expected: "[a b c]\n"},
+		{name: "unquoted @ is split", script: "arr=('a b' c); for x in ${arr[@]}; do echo $x; done", expected: "a\nb\nc\n"},
+		{name: "element count", script: "arr=(a b); arr[7]=c; echo ${#arr[@]} ${#arr[*]}", expected: "3 3\n"},
+		{name: "element length", script: "arr=(a hello); echo ${#arr[1]}", expected: "5\n"},
+		{name: "indices", script: "arr=(a b); arr[7]=c; echo ${!arr[@]}", expected: "0 1 7\n"},
+		{name: "slice", script: "arr=(a b c d); echo ${arr[@]:1:2}", expected: "b c\n"},
+		{name: "slice with negative offset", script: "arr=(a b c d); echo ${arr[@]: -2}", expected: "c d\n"},
+		{name: "empty array", script: "arr=(); echo ${#arr[@]}", expected: "0\n"},
+		{name: "elements are expanded", script: "x='1 2'; arr=($x \"$x\" {a,b}); echo ${#arr[@]}", expected: "5\n"},
+		{name: "explicit indices", script: "arr=([2]=b a [0]=z); echo ${!arr[@]} ${arr[@]}", expected: "0 2 3 z b a\n"},
+		{name: "default for an unset array", script: "echo ${none[@]:-default}", expected: "default\n"},
+		{name: "unset an element", script: "arr=(a b c); unset 'arr[1]'; echo ${arr[@]} ${!arr[@]}", expected: "a c 0 2\n"},
+		{name: "unset the array", script: "arr=(a b); unset arr; echo ${#arr[@]}", expected: "0\n"},
+		{name: "scalar becomes an array", script: "x=s; x[1]=t; echo ${x[@]}", expected: "s t\n"},
+		{name: "associative array", script: "declare -A m; m[key]=v; m[other]='w x'; echo ${m[key]}; echo ${!m[@]}", expected: "v\nkey other\n"},
+		{name: "associative literal", script: "declare -A m=([a]=1 ['b c']=2); echo ${m[b c]} ${#m[@]}", expected: "2 2\n"},
+		{name: "associative needs keys", script: "declare -A m; m=(x)", expectedStatus: 1},
+		{name: "arithmetic on elements", script: "a=(1 2 3); echo $((a[1]+1)); ((a[0]+=5)); i=1; ((a[i+1]++)); echo ${a[@]}", expected: "3\n6 2 4\n"},
+		{name: "arithmetic on associative elements", script: "declare -A m=([x]=4); ((m[x]*=2, m[new]=1)); k=x; echo $((m[$k] + m[new]))", expected: "9\n"},
+		{name: "arithmetic bad subscript", script: "echo $((none[-1]))", expectedStatus: 1},
+		{name: "keys with blanks", script: "declare -A m=([\"x y\"]=z [p q]=r ['k]']=); echo ${m[x y]} ${m[p q]} ${#m[@]}", expected: "z r 3\n"},
+		{name: "arithmetic key", script: "arr=([1 + 1]=two); echo ${!arr[@]}", expected: "2\n"},
+		{name: "bad subscript", script: "arr=(a); arr[-5]=x", expectedStatus: 1},
+		{name: "local array", script: "arr=(a b); f() { local -a arr=(z); echo ${arr[@]}; }; f; echo ${arr[@]}", expected: "z\na b\n"},
+		{name: "subshell copy", script: "arr=(a b); (arr[0]=x; echo ${arr[@]}); echo ${arr[@]}", expected: "x b\na b\n"},
+		{name: "declare -a", script: "declare -a arr; arr[2]=x; echo ${!arr[@]}", expected: "2\n"},
+		{name: "declare invalid option", script: "declare -q x", expectedStatus: 2},
+		{name: "declare -p", script: "arr=(a 'b c'); declare -A m=([k]=v); x=1; declare -p arr m x", expected: "declare -a arr=([0]='a' [1]='b c')\ndeclare -A m=([k]='v')\ndeclare -- x='1'\n"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, status := runScript(t, tt.script)
+
+			if got != tt.expected {
+				t.Errorf("script: %q\nexpected: %q\ngot:      %q", tt.script, tt.expected, got)
+			}
+
+			if status != tt.expectedStatus {
+				t.Errorf("expected status %d got %d", tt.expectedStatus, status)
+			}
+
+		})
+
+	}
+
+}
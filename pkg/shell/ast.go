@@ -0,0 +1,1303 @@
+package shell
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Position is a location in the source text of a command.
+type Position struct {
+	Offset int // Byte offset from the start of the text, starting at 0
+	Line   int // Line number, starting at 1
+	Column int // Column in characters, starting at 1
+}
+
+// String formats the position as "line:column".
+func (pos Position) String() string {
+	return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+}
+
+// Node is implemented by every node of the syntax tree.
+type Node interface {
+	// Pos returns the position of the first character of the node.
+	Pos() Position
+}
+
+// WordPart is a piece of a Word: a *Literal, *SingleQuoted, *DoubleQuoted,
+// *Expansion or *ArrayLiteral.
+type WordPart interface {
+	Node
+	wordPart()
+}
+
+// Literal is literal text in a word.
+//
+// Outside double quotes an unescaped Literal is subject to tilde expansion
+// and its *, ? and [ to filename expansion. An escaped Literal holds the
+// single character that followed a backslash, which is always taken
+// literally.
+type Literal struct {
+	Position Position
+	Value    string // The text, with the escaping backslash removed
+	Escaped  bool   // Whether the text was escaped with a backslash
+}
+
+// SingleQuoted is the text of a '...' string, taken literally. A $'...'
+// string is a SingleQuoted too, with its backslash escapes decoded.
+type SingleQuoted struct {
+	Position Position
+	Value    string // The text between the quotes
+}
+
+// DoubleQuoted is a "..." string. Its parts are Literals and Expansions;
+// expansions inside it are neither split into fields nor globbed.
+type DoubleQuoted struct {
+	Position Position
+	Parts    []WordPart
+}
+
+// ExpansionKind identifies the kind of an Expansion.
+type ExpansionKind int
+
+const (
+	ParameterExpansion  ExpansionKind = iota // $name or ${...}
+	CommandSubstitution                      // $(...) or `...`
+	ArithmeticExpansion                      // $((...))
+	ProcessSubstitution                      // <(...) or >(...)
+)
+
+// Expansion is a parameter expansion, command substitution, arithmetic
+// expansion or process substitution inside a word.
+//
+// Example:
+//
+//	${HOME:-/tmp} → Expansion{Kind: ParameterExpansion, Text: "HOME:-/tmp"}
+//	$(date)       → Expansion{Kind: CommandSubstitution, Text: "date"}
+//	>(wc -l)      → Expansion{Kind: ProcessSubstitution, Text: "wc -l", Raw: ">(wc -l)"}
+type Expansion struct {
+	Position Position
+	Kind     ExpansionKind
+	Text     string // The name, or the text inside the delimiters
+	Raw      string // The source text, delimiters included
+}
+
+// ArrayLiteral is the parenthesized value of an array assignment,
+// NAME=(...). It follows the Literal holding "NAME=".
+//
+// The elements are expanded when the assignment runs (see
+// expandArrayElements). In a word that is not an assignment, such as an
+// argument of declare, the literal stands for its source text.
+//
+// Example:
+//
+//	arr=(a "b c") → Word{Parts: []WordPart{
+//	    &Literal{Value: "arr="},
+//	    &ArrayLiteral{Text: `a "b c"`},
+//	}}
+type ArrayLiteral struct {
+	Position Position
+	Text     string // The text between the parentheses
+}
+
+// Word is a single shell word, such as a command name or argument, as the
+// sequence of parts it was written with.
+//
+// Example:
+//
+//	pre"$x"'*' → Word{Parts: []WordPart{
+//	    &Literal{Value: "pre"},
+//	    &DoubleQuoted{Parts: []WordPart{&Expansion{Kind: ParameterExpansion, Text: "x"}}},
+//	    &SingleQuoted{Value: "*"},
+//	}}
+type Word struct {
+	Position Position
+	Raw      string // The source text of the word, quotes and escapes included
+	Parts    []WordPart
+}
+
+// Redirect is an I/O redirection such as "> out.txt".
+type Redirect struct {
+	Position Position
+	Operator string // The redirection operator, such as ">" or "2>>"
+	Target   *Word  // The file name, or here-document body
+}
+
+// Command is a command in a pipeline: a *SimpleCommand, an
+// *ArithmeticCommand or a compound command such as an *IfClause.
+type Command interface {
+	Node
+	commandNode()
+}
+
+// SimpleCommand is a command name with its arguments, optionally preceded
+// by variable assignments and accompanied by redirections.
+//
+// Example:
+//
+//	LANG=C sort -r < in.txt → SimpleCommand{
+//	    Assignments: [LANG=C],
+//	    Words:       [sort, -r],
+//	    Redirects:   [{Operator: "<", Target: in.txt}],
+//	}
+type SimpleCommand struct {
+	Position    Position
+	Assignments []*Word     // Leading NAME=value words
+	Words       []*Word     // The command name and its arguments
+	Redirects   []*Redirect // Redirections, in the order written
+}
+
+// ArithmeticCommand is a ((expr)) command.
+type ArithmeticCommand struct {
+	Position Position
+	Expr     string // The expression between the double parentheses
+}
+
+// IfClause is an if command:
+//
+//	if list; then list; [elif list; then list;]... [else list;] fi
+//
+// Branches holds the if branch followed by any elif branches. The body of
+// the first branch whose condition succeeds runs; if none does, the Else
+// body runs when there is one.
+//
+// Example:
+//
+//	if test -d src; then cd src; else echo missing; fi > log → IfClause{
+//	    Branches:  [{Condition: [test -d src], Body: [cd src]}],
+//	    Else:      [echo missing],
+//	    Redirects: [{Operator: ">", Target: log}],
+//	}
+type IfClause struct {
+	Position  Position
+	Branches  []*IfBranch
+	Else      *List       // The else body, or nil
+	Redirects []*Redirect // Redirections applied to the whole command
+}
+
+// IfBranch is the condition and body of an if or elif.
+type IfBranch struct {
+	Position  Position
+	Condition *List
+	Body      *List
+}
+
+// ForClause is a for loop over a list of words:
+//
+//	for name [in word...]; do list; done
+//
+// The words are expanded like the arguments of a command, and the body runs
+// once for each resulting field with the variable set to it. Without "in"
+// the loop runs over the positional parameters.
+//
+// Example:
+//
+//	for f in *.go; do wc -l $f; done → ForClause{
+//	    Name:  "f",
+//	    Words: [*.go],
+//	    Body:  [wc -l $f],
+//	}
+type ForClause struct {
+	Position  Position
+	Name      string  // The loop variable
+	Words     []*Word // The words after "in", nil when it is omitted ("$@" is used)
+	Body      *List
+	Redirects []*Redirect // Redirections applied to the whole loop
+}
+
+// ArithmeticForClause is a C-style for loop:
+//
+//	for ((init; condition; update)); do list; done
+//
+// Each expression may be empty; an empty condition is always true.
+type ArithmeticForClause struct {
+	Position  Position
+	Init      string // Evaluated once before the loop
+	Condition string // Evaluated before each iteration; the loop ends when it is 0
+	Update    string // Evaluated after each iteration
+	Body      *List
+	Redirects []*Redirect // Redirections applied to the whole loop
+}
+
+// WhileClause is a while or until loop:
+//
+//	while list; do list; done
+//	until list; do list; done
+//
+// The body runs as long as the condition succeeds (while) or fails
+// (until), as decided by the exit status of its last command.
+type WhileClause struct {
+	Position  Position
+	Until     bool // Whether this is an until loop
+	Condition *List
+	Body      *List
+	Redirects []*Redirect // Redirections applied to the whole loop
+}
+
+// CaseClause is a case command:
+//
+//	case word in [(]pattern[|pattern]...) list ;; ... esac
+//
+// The word is expanded and compared with the patterns of each item in turn;
+// the body of the first item with a matching pattern runs. What happens
+// next depends on the operator that ends the item (see CaseItem).
+//
+// Example:
+//
+//	case $f in *.go|*.mod) go build ;; *) echo skip ;; esac → CaseClause{
+//	    Word:  $f,
+//	    Items: [{Patterns: [*.go, *.mod], Body: [go build], Terminator: ";;"},
+//	            {Patterns: [*], Body: [echo skip], Terminator: ";;"}],
+//	}
+type CaseClause struct {
+	Position  Position
+	Word      *Word
+	Items     []*CaseItem
+	Redirects []*Redirect // Redirections applied to the whole command
+}
+
+// CaseItem is one pattern list and body of a case command.
+//
+// Terminator is the operator that ends the item:
+//   - ;;  : The case command is done
+//   - ;&  : The body of the next item runs too, without testing its patterns
+//   - ;;& : The patterns of the following items are tested as well
+//
+// The last item may omit its terminator, which is then recorded as ";;".
+type CaseItem struct {
+	Position   Position
+	Patterns   []*Word
+	Body       *List // The commands to run, possibly none
+	Terminator string
+}
+
+// BraceGroup is a list of commands grouped with braces, run in the current
+// shell:
+//
+//	{ list; }
+type BraceGroup struct {
+	Position  Position
+	Body      *List
+	Redirects []*Redirect // Redirections applied to the whole group
+}
+
+// Subshell is a list of commands run in a copy of the shell:
+//
+//	( list )
+//
+// Changes the list makes to the working directory, variables, functions
+// and options are lost when it ends, and exit only leaves the subshell.
+type Subshell struct {
+	Position  Position
+	Body      *List
+	Redirects []*Redirect // Redirections applied to the whole subshell
+}
+
+// FunctionDefinition defines a shell function, in either of the forms
+//
+//	name() compound-command
+//	function name [()] compound-command
+//
+// The body is usually a brace group, { list; }, but may be any compound
+// command, such as a subshell. Running the definition only records the
+// function; its body runs each time the function is called, with the
+// arguments of the call as positional parameters. Redirections after the
+// body apply to every call.
+//
+// Example:
+//
+//	greet() { echo "hi $1"; } → FunctionDefinition{
+//	    Name:   "greet",
+//	    Body:   {Body: [echo "hi $1"]},
+//	    Source: `{ echo "hi $1"; }`,
+//	}
+type FunctionDefinition struct {
+	Position Position
+	Name     string
+	Body     Command // A compound command
+	Source   string  // The source text of the body, as printed by type
+}
+
+// Pipeline is a sequence of commands connected by "|". A pipeline that
+// starts with the reserved word "!" is Negated: its status is inverted.
+type Pipeline struct {
+	Position Position
+	Negated  bool
+	Commands []Command
+}
+
+// List is a sequence of pipelines separated by ";", "&&", "||" or newlines.
+//
+// Operators holds the operator between each pair of pipelines, so it is
+// always one shorter than Pipelines; a newline is recorded as ";".
+type List struct {
+	Position  Position
+	Pipelines []*Pipeline
+	Operators []string
+}
+
+func (n *Literal) Pos() Position             { return n.Position }
+func (n *SingleQuoted) Pos() Position        { return n.Position }
+func (n *DoubleQuoted) Pos() Position        { return n.Position }
+func (n *Expansion) Pos() Position           { return n.Position }
+func (n *ArrayLiteral) Pos() Position        { return n.Position }
+func (n *Word) Pos() Position                { return n.Position }
+func (n *Redirect) Pos() Position            { return n.Position }
+func (n *SimpleCommand) Pos() Position       { return n.Position }
+func (n *ArithmeticCommand) Pos() Position   { return n.Position }
+func (n *IfClause) Pos() Position            { return n.Position }
+func (n *IfBranch) Pos() Position            { return n.Position }
+func (n *ForClause) Pos() Position           { return n.Position }
+func (n *ArithmeticForClause) Pos() Position { return n.Position }
+func (n *WhileClause) Pos() Position         { return n.Position }
+func (n *CaseClause) Pos() Position          { return n.Position }
+func (n *CaseItem) Pos() Position            { return n.Position }
+func (n *BraceGroup) Pos() Position          { return n.Position }
+func (n *Subshell) Pos() Position            { return n.Position }
+func (n *FunctionDefinition) Pos() Position  { return n.Position }
+func (n *Pipeline) Pos() Position            { return n.Position }
+func (n *List) Pos() Position                { return n.Position }
+
+func (*Literal) wordPart()      {}
+func (*SingleQuoted) wordPart() {}
+func (*DoubleQuoted) wordPart() {}
+func (*Expansion) wordPart()    {}
+func (*ArrayLiteral) wordPart() {}
+
+func (*SimpleCommand) commandNode()       {}
+func (*ArithmeticCommand) commandNode()   {}
+func (*IfClause) commandNode()            {}
+func (*ForClause) commandNode()           {}
+func (*ArithmeticForClause) commandNode() {}
+func (*WhileClause) commandNode()         {}
+func (*CaseClause) commandNode()          {}
+func (*BraceGroup) commandNode()          {}
+func (*Subshell) commandNode()            {}
+func (*FunctionDefinition) commandNode()  {}
+
+// closingWords are the reserved words that end a part of a compound
+// command. They cannot start a command of their own.
+var closingWords = []string{"then", "elif", "else", "fi", "do", "done", "esac", "}"}
+
+// compoundWords are the reserved words that start a compound command. A
+// "(" starts one too, a subshell.
+var compoundWords = []string{"{", "if", "case", "for", "while", "until"}
+
+// reservedWords are the words that are never alias names at the start of
+// a command.
+var reservedWords = slices.Concat(compoundWords, closingWords, []string{"function", "!"})
+
+// caseTerminators are the operators that end an item of a case command.
+var caseTerminators = []string{";;", ";&", ";;&"}
+
+// literal returns the text of a word made of a single unquoted, unescaped
+// literal, which is how reserved words are recognised: if starts a
+// conditional, while "if" and \if are ordinary command names.
+func (n *Word) literal() (string, bool) {
+	if len(n.Parts) != 1 {
+		return "", false
+	}
+
+	part, ok := n.Parts[0].(*Literal)
+
+	if !ok || part.Escaped {
+		return "", false
+	}
+
+	return part.Value, true
+}
+
+// isAssignment reports whether the word has the form NAME=value or
+// NAME[subscript]=value with an unquoted NAME prefix. The subscript may
+// contain quotes and expansions, as in map["$key"]=1.
+func (n *Word) isAssignment() bool {
+	if len(n.Parts) == 0 {
+		return false
+	}
+
+	part, ok := n.Parts[0].(*Literal)
+
+	if !ok || part.Escaped {
+		return false
+	}
+
+	_, _, ok = splitAssignment(n.Raw)
+	return ok
+}
+
+// arrayValue returns the ArrayLiteral of a NAME=(...) word, or nil if the
+// word is not an array assignment.
+func (n *Word) arrayValue() *ArrayLiteral {
+	if len(n.Parts) != 2 || !n.isAssignment() {
+		return nil
+	}
+
+	array, _ := n.Parts[1].(*ArrayLiteral)
+	return array
+}
+
+// ParseTree parses command text into a syntax tree.
+//
+// The text is a command list: pipelines separated by ";", "&&", "||" or
+// newlines, each a sequence of commands separated by "|". A command is a
+// ((expr)) arithmetic command, a compound command (if, case, for, while,
+// until, a { list; } group or a ( list ) subshell), a function definition
+// or a simple command made of words. Reserved words such as if, do and fi
+// are only recognised unquoted at the start of a command. Operators are
+// recognised wherever they appear unquoted, with or without spaces around
+// them (see lex). Redirection operators (>, >>, 2>, &>, 2>&, <, <<,
+// <<< and so on) take the following word as their target; leading
+// NAME=value words are assignments. Quoted operators are ordinary words, so
+// `echo ">"` prints ">".
+//
+// Aliases set with SetAliases are the exception: an unquoted alias name
+// that starts a simple command is replaced by the tokens of its value before
+// the command is parsed (see expandAlias). Nothing else is expanded: words
+// keep their quoted, literal and expansion parts, to be expanded when the
+// command runs (see ExpandWords).
+//
+// Blank lines, a trailing ";" and newlines after "&&", "||" or "|" are
+// allowed. Empty text gives an empty List.
+//
+// Parameters:
+//   - text: The command text to parse
+//
+// Returns:
+//   - *List: The syntax tree
+//   - error: A *ParseError, wrapping ErrSyntax with the offending token or
+//     one of the quoting errors of Parse with the quote that is not closed
+//
+// Example:
+//
+//	list, err := parser.ParseTree(`make && echo "done > ok" > log`)
+//	// list.Pipelines[1].Commands[0] is a *SimpleCommand with the words
+//	// echo and "done > ok" and a redirection of stdout to log
+func (p *DefaultParser) ParseTree(text string) (*List, error) {
+	tokens, err := p.lex(text)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tree := &treeParser{tokens: tokens, text: text, parser: p, aliasNext: -1}
+
+	return tree.parseList()
+}
+
+// treeParser builds a syntax tree from a token stream by recursive descent.
+type treeParser struct {
+	tokens    []token
+	index     int
+	text      string         // The source text, for the bodies of function definitions
+	parser    *DefaultParser // Lexes alias values; nil disables aliases
+	aliasNext int            // Index of a word to check for an alias after one whose value ends in a blank, or -1
+}
+
+// peek returns the next token without consuming it.
+func (tree *treeParser) peek() token {
+	return tree.tokens[tree.index]
+}
+
+// next consumes and returns the next token.
+func (tree *treeParser) next() token {
+	tok := tree.tokens[tree.index]
+
+	if tok.kind != tokenEOF {
+		tree.index++
+	}
+
+	return tok
+}
+
+// isReservedWord reports whether the next token is an unquoted word that is
+// one of the given reserved words.
+func (tree *treeParser) isReservedWord(words ...string) bool {
+	tok := tree.peek()
+
+	if tok.kind != tokenWord {
+		return false
+	}
+
+	word, ok := tok.word.literal()
+	return ok && slices.Contains(words, word)
+}
+
+// isOperator reports whether the next token is one of the given operators.
+func (tree *treeParser) isOperator(ops ...string) bool {
+	tok := tree.peek()
+	return tok.kind == tokenOperator && slices.Contains(ops, tok.text)
+}
+
+// skipNewlines consumes any newline operators.
+func (tree *treeParser) skipNewlines() {
+	for tree.isOperator("\n") {
+		tree.next()
+	}
+}
+
+// parseList parses pipelines separated by list operators up to the end of
+// the tokens or, inside a compound command, up to one of the reserved words
+// or operators that end it.
+//
+// Parameters:
+//   - terminators: Reserved words or operators that end the list, such as
+//     "then" in the condition of an if or ";;" in a case item; none for the
+//     top-level list
+//
+// Returns:
+//   - *List: The pipelines, which may be empty
+//   - error: ErrSyntax wrapped with the offending token
+func (tree *treeParser) parseList(terminators ...string) (*List, error) {
+	tree.skipNewlines()
+
+	list := &List{Position: tree.peek().pos}
+
+	isEnd := func() bool {
+		return tree.peek().kind == tokenEOF || tree.isReservedWord(terminators...) || tree.isOperator(terminators...)
+	}
+
+	for !isEnd() {
+		pipeline, err := tree.parsePipeline()
+
+		if err != nil {
+			return nil, err
+		}
+
+		list.Pipelines = append(list.Pipelines, pipeline)
+
+		if isEnd() {
+			break
+		}
+
+		if !tree.isOperator("&&", "||", ";", "\n") {
+			return nil, tree.unexpectedToken(tree.peek(), "")
+		}
+
+		op := tree.next()
+
+		if op.text == "&&" || op.text == "||" {
+			tree.skipNewlines()
+
+			if tree.peek().kind == tokenEOF {
+				return nil, tree.unexpectedToken(op, "a command")
+			}
+
+			if isEnd() {
+				return nil, tree.unexpectedToken(tree.peek(), "a command")
+			}
+
+			list.Operators = append(list.Operators, op.text)
+			continue
+		}
+
+		// ; and newline end the pipeline unconditionally
+		tree.skipNewlines()
+
+		if !isEnd() {
+			list.Operators = append(list.Operators, ";")
+		}
+	}
+
+	return list, nil
+}
+
+// parseCompoundList parses the non-empty list inside a compound command,
+// which must be followed by one of the given reserved words. The reserved
+// word is left for the caller to consume.
+func (tree *treeParser) parseCompoundList(terminators ...string) (*List, error) {
+	list, err := tree.parseList(terminators...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if tree.peek().kind == tokenEOF {
+		return nil, tree.unexpectedEnd(quoteWords(terminators))
+	}
+
+	if len(list.Pipelines) == 0 {
+		return nil, tree.unexpectedToken(tree.peek(), "a command")
+	}
+
+	return list, nil
+}
+
+// parsePipeline parses commands separated by "|", optionally preceded by
+// "!". Each further "!" inverts the status again.
+func (tree *treeParser) parsePipeline() (*Pipeline, error) {
+	pipeline := &Pipeline{Position: tree.peek().pos}
+
+	for tree.isReservedWord("!") {
+		op := tree.next()
+		pipeline.Negated = !pipeline.Negated
+
+		if tree.peek().kind == tokenEOF {
+			return nil, tree.unexpectedToken(op, "a command")
+		}
+	}
+
+	for {
+		command, err := tree.parseCommand()
+
+		if err != nil {
+			return nil, err
+		}
+
+		pipeline.Commands = append(pipeline.Commands, command)
+
+		if !tree.isOperator("|") {
+			return pipeline, nil
+		}
+
+		op := tree.next()
+		tree.skipNewlines()
+
+		if tree.peek().kind == tokenEOF {
+			return nil, tree.unexpectedToken(op, "a command")
+		}
+	}
+}
+
+// parseCommand parses a single command of a pipeline.
+func (tree *treeParser) parseCommand() (Command, error) {
+
+	// aliases are expanded before reserved words are recognised, so an
+	// alias value may start a compound command
+	if err := tree.expandAlias(); err != nil {
+		return nil, err
+	}
+
+	tok := tree.peek()
+
+	if tok.kind == tokenArithmetic {
+		tree.next()
+		return &ArithmeticCommand{Position: tok.pos, Expr: tok.text}, nil
+	}
+
+	if tree.isOperator("(") {
+		return tree.parseSubshell()
+	}
+
+	switch {
+	case tree.isReservedWord("if"):
+		return tree.parseIfClause()
+	case tree.isReservedWord("for"):
+		return tree.parseForClause()
+	case tree.isReservedWord("while", "until"):
+		return tree.parseWhileClause()
+	case tree.isReservedWord("case"):
+		return tree.parseCaseClause()
+	case tree.isReservedWord("{"):
+		return tree.parseBraceGroup()
+	case tree.isReservedWord("function") || tree.isFunctionName():
+		return tree.parseFunctionDefinition()
+	case tree.isReservedWord(closingWords...):
+		return nil, tree.unexpectedToken(tok, "a command")
+	}
+
+	command := &SimpleCommand{Position: tok.pos}
+
+	for tree.peek().kind == tokenWord || tree.peek().kind == tokenRedirection {
+		if tree.peek().kind == tokenRedirection {
+			redirect, err := tree.parseRedirect()
+
+			if err != nil {
+				return nil, err
+			}
+
+			command.Redirects = append(command.Redirects, redirect)
+			continue
+		}
+
+		if tree.index == tree.aliasNext {
+			tree.aliasNext = -1
+
+			if err := tree.expandAlias(); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		word := tree.next().word
+
+		if len(command.Words) == 0 && word.isAssignment() {
+			command.Assignments = append(command.Assignments, word)
+
+			// the command name may follow the assignments
+			tree.aliasNext = tree.index
+			continue
+		}
+
+		command.Words = append(command.Words, word)
+	}
+
+	if len(command.Assignments) == 0 && len(command.Words) == 0 && len(command.Redirects) == 0 {
+		return nil, tree.unexpectedToken(tree.peek(), "a command")
+	}
+
+	return command, nil
+}
+
+// expandAlias replaces an alias name in the next token with the tokens of
+// the alias value, as long as the token is an unquoted word naming an
+// alias.
+//
+// The value is lexed on its own and spliced into the token stream, so it
+// may contain several words, operators and even compound commands:
+// `alias l='ls | less'` makes `l -a` parse as `ls | less -a`. Expansion
+// repeats on the first word of the value, except for aliases that are
+// already being expanded, so `alias ls='ls -F'` does not loop. When a value
+// ends in a blank, the word that follows it is checked for an alias too, as
+// in `alias sudo='sudo '`. Reserved words are never aliases.
+//
+// Returns:
+//   - error: Quoting errors from lexing an alias value
+//
+// Example (with ll aliased to "ls -l"):
+//
+//	ll /tmp → ls -l /tmp
+func (tree *treeParser) expandAlias() error {
+	for {
+		tok := tree.peek()
+
+		if tree.parser == nil || tree.parser.aliases == nil || tok.kind != tokenWord {
+			return nil
+		}
+
+		name, ok := tok.word.literal()
+
+		if !ok || slices.Contains(tok.aliases, name) || tree.isReservedWord(reservedWords...) {
+			return nil
+		}
+
+		value, ok := tree.parser.aliases(name)
+
+		if !ok {
+			return nil
+		}
+
+		tokens, err := tree.parser.lex(value)
+
+		if err != nil {
+			return fmt.Errorf("alias %s: %w", name, err)
+		}
+
+		// drop the EOF, and point errors at the alias name
+		tokens = tokens[:len(tokens)-1]
+
+		for i := range tokens {
+			tokens[i].pos = tok.pos
+			tokens[i].aliases = append(slices.Clip(tok.aliases), name)
+		}
+
+		tree.tokens = slices.Concat(tree.tokens[:tree.index], tokens, tree.tokens[tree.index+1:])
+
+		if tree.aliasNext > tree.index {
+			tree.aliasNext += len(tokens) - 1
+		}
+
+		if strings.TrimRightFunc(value, isBlank) != value {
+			tree.aliasNext = tree.index + len(tokens)
+		}
+	}
+}
+
+// parseRedirect parses a redirection operator and its target word.
+func (tree *treeParser) parseRedirect() (*Redirect, error) {
+	op := tree.next()
+	target := tree.peek()
+
+	if target.kind != tokenWord {
+		return nil, tree.unexpectedToken(target, "a word")
+	}
+
+	tree.next()
+
+	return &Redirect{Position: op.pos, Operator: op.text, Target: target.word}, nil
+}
+
+// parseRedirects parses the redirections that follow a compound command,
+// such as the "> log" of `if x; then y; fi > log`.
+func (tree *treeParser) parseRedirects() ([]*Redirect, error) {
+	var redirects []*Redirect
+
+	for tree.peek().kind == tokenRedirection {
+		redirect, err := tree.parseRedirect()
+
+		if err != nil {
+			return nil, err
+		}
+
+		redirects = append(redirects, redirect)
+	}
+
+	return redirects, nil
+}
+
+// parseIfClause parses an if command, starting at its "if":
+//
+//	if list; then list; [elif list; then list;]... [else list;] fi
+func (tree *treeParser) parseIfClause() (*IfClause, error) {
+	keyword := tree.next()
+	clause := &IfClause{Position: keyword.pos}
+
+	for {
+		condition, err := tree.parseCompoundList("then")
+
+		if err != nil {
+			return nil, err
+		}
+
+		tree.next()
+		body, err := tree.parseCompoundList("elif", "else", "fi")
+
+		if err != nil {
+			return nil, err
+		}
+
+		clause.Branches = append(clause.Branches, &IfBranch{Position: keyword.pos, Condition: condition, Body: body})
+
+		keyword = tree.next()
+
+		if word, _ := keyword.word.literal(); word != "elif" {
+			break
+		}
+	}
+
+	if word, _ := keyword.word.literal(); word == "else" {
+		body, err := tree.parseCompoundList("fi")
+
+		if err != nil {
+			return nil, err
+		}
+
+		clause.Else = body
+		tree.next()
+	}
+
+	redirects, err := tree.parseRedirects()
+
+	if err != nil {
+		return nil, err
+	}
+
+	clause.Redirects = redirects
+
+	return clause, nil
+}
+
+// parseForClause parses a for loop, starting at its "for":
+//
+//	for name [in word...]; do list; done
+//	for ((init; condition; update)); do list; done
+func (tree *treeParser) parseForClause() (Command, error) {
+	keyword := tree.next()
+
+	if tree.peek().kind == tokenArithmetic {
+		return tree.parseArithmeticForClause(keyword)
+	}
+
+	clause := &ForClause{Position: keyword.pos}
+	name := tree.peek()
+
+	if name.kind != tokenWord {
+		return nil, tree.unexpectedToken(name, "a name")
+	}
+
+	value, ok := name.word.literal()
+
+	if !ok || !isValidName(value) {
+		return nil, tree.unexpectedToken(name, "a name")
+	}
+
+	clause.Name = value
+	tree.next()
+	tree.skipNewlines()
+
+	if tree.isReservedWord("in") {
+		tree.next()
+		clause.Words = []*Word{}
+
+		for tree.peek().kind == tokenWord {
+			clause.Words = append(clause.Words, tree.next().word)
+		}
+
+		if !tree.isOperator(";", "\n") {
+			return nil, tree.unexpectedToken(tree.peek(), "`;' or a newline")
+		}
+
+		tree.next()
+	} else if tree.isOperator(";") {
+		tree.next()
+	}
+
+	body, err := tree.parseLoopBody()
+
+	if err != nil {
+		return nil, err
+	}
+
+	clause.Body = body
+
+	if clause.Redirects, err = tree.parseRedirects(); err != nil {
+		return nil, err
+	}
+
+	return clause, nil
+}
+
+// parseArithmeticForClause parses the rest of a for ((...)) loop, after its
+// "for".
+func (tree *treeParser) parseArithmeticForClause(keyword token) (Command, error) {
+	header := tree.next()
+	exprs := strings.Split(header.text, ";")
+
+	if len(exprs) != 3 {
+		return nil, newParseError(tree.text, header.pos.Offset, ErrSyntax, "three expressions", "(("+header.text+"))")
+	}
+
+	clause := &ArithmeticForClause{
+		Position:  keyword.pos,
+		Init:      strings.TrimSpace(exprs[0]),
+		Condition: strings.TrimSpace(exprs[1]),
+		Update:    strings.TrimSpace(exprs[2]),
+	}
+
+	if tree.isOperator(";") {
+		tree.next()
+	}
+
+	body, err := tree.parseLoopBody()
+
+	if err != nil {
+		return nil, err
+	}
+
+	clause.Body = body
+
+	if clause.Redirects, err = tree.parseRedirects(); err != nil {
+		return nil, err
+	}
+
+	return clause, nil
+}
+
+// parseWhileClause parses a while or until loop, starting at its keyword:
+//
+//	while list; do list; done
+func (tree *treeParser) parseWhileClause() (*WhileClause, error) {
+	keyword := tree.next()
+	until, _ := keyword.word.literal()
+
+	clause := &WhileClause{Position: keyword.pos, Until: until == "until"}
+
+	condition, err := tree.parseCompoundList("do")
+
+	if err != nil {
+		return nil, err
+	}
+
+	clause.Condition = condition
+
+	body, err := tree.parseLoopBody()
+
+	if err != nil {
+		return nil, err
+	}
+
+	clause.Body = body
+
+	if clause.Redirects, err = tree.parseRedirects(); err != nil {
+		return nil, err
+	}
+
+	return clause, nil
+}
+
+// parseLoopBody parses the "do list; done" that ends every loop, skipping
+// any newlines in front of the do.
+func (tree *treeParser) parseLoopBody() (*List, error) {
+	tree.skipNewlines()
+
+	if !tree.isReservedWord("do") {
+		if tree.peek().kind == tokenEOF {
+			return nil, tree.unexpectedEnd("`do'")
+		}
+
+		return nil, tree.unexpectedToken(tree.peek(), "`do'")
+	}
+
+	tree.next()
+	body, err := tree.parseCompoundList("done")
+
+	if err != nil {
+		return nil, err
+	}
+
+	tree.next()
+
+	return body, nil
+}
+
+// parseCaseClause parses a case command, starting at its "case":
+//
+//	case word in [(]pattern[|pattern]...) list ;; ... esac
+func (tree *treeParser) parseCaseClause() (*CaseClause, error) {
+	keyword := tree.next()
+	word := tree.peek()
+
+	if word.kind != tokenWord {
+		return nil, tree.unexpectedToken(word, "a word")
+	}
+
+	tree.next()
+	tree.skipNewlines()
+
+	if !tree.isReservedWord("in") {
+		return nil, tree.unexpectedToken(tree.peek(), "`in'")
+	}
+
+	tree.next()
+	tree.skipNewlines()
+
+	clause := &CaseClause{Position: keyword.pos, Word: word.word}
+
+	for !tree.isReservedWord("esac") {
+		item, err := tree.parseCaseItem()
+
+		if err != nil {
+			return nil, err
+		}
+
+		clause.Items = append(clause.Items, item)
+	}
+
+	tree.next()
+	redirects, err := tree.parseRedirects()
+
+	if err != nil {
+		return nil, err
+	}
+
+	clause.Redirects = redirects
+
+	return clause, nil
+}
+
+// parseCaseItem parses one item of a case command: its patterns, its body
+// and the operator that ends it, or up to the esac for the last item.
+func (tree *treeParser) parseCaseItem() (*CaseItem, error) {
+	if tree.peek().kind == tokenEOF {
+		return nil, tree.unexpectedEnd("`esac'")
+	}
+
+	item := &CaseItem{Position: tree.peek().pos, Terminator: ";;"}
+
+	if tree.isOperator("(") {
+		tree.next()
+	}
+
+	for {
+		pattern := tree.peek()
+
+		if pattern.kind != tokenWord {
+			return nil, tree.unexpectedToken(pattern, "a pattern")
+		}
+
+		item.Patterns = append(item.Patterns, tree.next().word)
+
+		if !tree.isOperator("|") {
+			break
+		}
+
+		tree.next()
+	}
+
+	if !tree.isOperator(")") {
+		return nil, tree.unexpectedToken(tree.peek(), "`)'")
+	}
+
+	tree.next()
+	body, err := tree.parseList(append([]string{"esac"}, caseTerminators...)...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	item.Body = body
+
+	if tree.isOperator(caseTerminators...) {
+		item.Terminator = tree.next().text
+		tree.skipNewlines()
+	}
+
+	if tree.peek().kind == tokenEOF {
+		return nil, tree.unexpectedEnd("`esac'")
+	}
+
+	return item, nil
+}
+
+// isFunctionName reports whether the next tokens are a word followed by
+// "()", which starts a function definition.
+func (tree *treeParser) isFunctionName() bool {
+	if tree.index+2 >= len(tree.tokens) || tree.peek().kind != tokenWord {
+		return false
+	}
+
+	left, right := tree.tokens[tree.index+1], tree.tokens[tree.index+2]
+
+	return left.kind == tokenOperator && left.text == "(" && right.kind == tokenOperator && right.text == ")"
+}
+
+// parseFunctionDefinition parses a function definition, starting at its
+// name or at the "function" keyword:
+//
+//	name() { list; }
+//	function name [()] { list; }
+func (tree *treeParser) parseFunctionDefinition() (*FunctionDefinition, error) {
+	start := tree.peek()
+
+	if tree.isReservedWord("function") {
+		tree.next()
+	}
+
+	name := tree.peek()
+
+	if name.kind != tokenWord {
+		return nil, tree.unexpectedToken(name, "a name")
+	}
+
+	value, ok := name.word.literal()
+
+	if !ok || strings.Contains(value, "=") || tree.isReservedWord(closingWords...) {
+		return nil, tree.unexpectedToken(name, "a name")
+	}
+
+	tree.next()
+
+	if tree.isOperator("(") {
+		tree.next()
+
+		if !tree.isOperator(")") {
+			return nil, tree.unexpectedToken(tree.peek(), "`)'")
+		}
+
+		tree.next()
+	}
+
+	tree.skipNewlines()
+
+	if !tree.isReservedWord(compoundWords...) && !tree.isOperator("(") {
+		if tree.peek().kind == tokenEOF {
+			return nil, tree.unexpectedEnd("a compound command")
+		}
+
+		return nil, tree.unexpectedToken(tree.peek(), "a compound command")
+	}
+
+	bodyStart := tree.peek().pos.Offset
+	body, err := tree.parseCommand()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &FunctionDefinition{
+		Position: start.pos,
+		Name:     value,
+		Body:     body,
+		Source:   strings.TrimRightFunc(tree.text[bodyStart:tree.peek().pos.Offset], unicode.IsSpace),
+	}, nil
+}
+
+// parseSubshell parses a ( list ) subshell, starting at its "(".
+func (tree *treeParser) parseSubshell() (*Subshell, error) {
+	paren := tree.next()
+	body, err := tree.parseCompoundList(")")
+
+	if err != nil {
+		return nil, err
+	}
+
+	tree.next()
+	redirects, err := tree.parseRedirects()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Subshell{Position: paren.pos, Body: body, Redirects: redirects}, nil
+}
+
+// parseBraceGroup parses a { list; } group, starting at its "{".
+func (tree *treeParser) parseBraceGroup() (*BraceGroup, error) {
+	keyword := tree.next()
+	body, err := tree.parseCompoundList("}")
+
+	if err != nil {
+		return nil, err
+	}
+
+	tree.next()
+	redirects, err := tree.parseRedirects()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &BraceGroup{Position: keyword.pos, Body: body, Redirects: redirects}, nil
+}
+
+// unexpectedToken returns the syntax error for a token that cannot appear
+// where it was found.
+//
+// Parameters:
+//   - tok: The token
+//   - expected: What would have been valid in its place, for the message;
+//     "" when there is no short description
+//
+// Returns:
+//   - error: A *ParseError wrapping ErrSyntax
+func (tree *treeParser) unexpectedToken(tok token, expected string) error {
+	text := tok.text
+
+	switch tok.kind {
+	case tokenEOF:
+		text = "newline"
+	case tokenWord:
+		text = tok.word.Raw
+	case tokenArithmetic:
+		text = "(("
+	}
+
+	if text == "\n" {
+		text = "newline"
+	}
+
+	return newParseError(tree.text, tok.pos.Offset, ErrSyntax, expected, text)
+}
+
+// unexpectedEnd returns the syntax error for tokens that end while expected
+// is still missing.
+func (tree *treeParser) unexpectedEnd(expected string) error {
+	return newParseError(tree.text, tree.peek().pos.Offset, ErrSyntax, expected, endOfFile)
+}
+
+// quoteWords lists reserved words or operators for an error message:
+// "`fi'", "`then' or `fi'", "`a', `b' or `c'".
+func quoteWords(words []string) string {
+	quoted := make([]string, len(words))
+
+	for i, word := range words {
+		quoted[i] = "`" + word + "'"
+	}
+
+	if len(quoted) < 2 {
+		return strings.Join(quoted, "")
+	}
+
+	return strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1]
+}
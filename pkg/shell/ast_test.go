@@ -0,0 +1,394 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// describeList renders a syntax tree compactly for comparison: pipelines
+// separated by their operators, commands by " | ", words by their source
+// text, assignments with a trailing "=" marker and redirections in braces.
+// Compound commands are written out with their reserved words.
+func describeList(list *List) string {
+	var b strings.Builder
+
+	for i, pipeline := range list.Pipelines {
+		if i > 0 {
+			b.WriteString(" " + list.Operators[i-1] + " ")
+		}
+
+		if pipeline.Negated {
+			b.WriteString("! ")
+		}
+
+		for j, command := range pipeline.Commands {
+			if j > 0 {
+				b.WriteString(" | ")
+			}
+
+			b.WriteString(describeCommand(command))
+		}
+	}
+
+	return b.String()
+}
+
+// describeCommand renders a single command in the notation of describeList.
+func describeCommand(command Command) string {
+	switch command := command.(type) {
+	case *ArithmeticCommand:
+		return "((" + command.Expr + "))"
+
+	case *SimpleCommand:
+		var fields []string
+
+		for _, word := range command.Assignments {
+			fields = append(fields, "="+word.Raw)
+		}
+
+		for _, word := range command.Words {
+			fields = append(fields, word.Raw)
+		}
+
+		return "[" + strings.Join(append(fields, describeRedirects(command.Redirects)...), " ") + "]"
+
+	case *IfClause:
+		var fields []string
+
+		for i, branch := range command.Branches {
+			keyword := "if"
+			if i > 0 {
+				keyword = "elif"
+			}
+
+			fields = append(fields, keyword, describeList(branch.Condition), "then", describeList(branch.Body))
+		}
+
+		if command.Else != nil {
+			fields = append(fields, "else", describeList(command.Else))
+		}
+
+		return strings.Join(append(append(fields, "fi"), describeRedirects(command.Redirects)...), " ")
+
+	case *CaseClause:
+		fields := []string{"case", command.Word.Raw, "in"}
+
+		for _, item := range command.Items {
+			var patterns []string
+
+			for _, pattern := range item.Patterns {
+				patterns = append(patterns, pattern.Raw)
+			}
+
+			fields = append(fields, strings.Join(patterns, "|")+")", describeList(item.Body), item.Terminator)
+		}
+
+		return strings.Join(append(append(fields, "esac"), describeRedirects(command.Redirects)...), " ")
+
+	case *BraceGroup:
+		return strings.Join(append([]string{"{", describeList(command.Body), "}"}, describeRedirects(command.Redirects)...), " ")
+
+	case *Subshell:
+		return strings.Join(append([]string{"(", describeList(command.Body), ")"}, describeRedirects(command.Redirects)...), " ")
+
+	case *FunctionDefinition:
+		return command.Name + "() " + describeCommand(command.Body)
+
+	case *ForClause:
+		fields := []string{"for", command.Name}
+
+		if command.Words != nil {
+			fields = append(fields, "in")
+
+			for _, word := range command.Words {
+				fields = append(fields, word.Raw)
+			}
+		}
+
+		fields = append(fields, "do", describeList(command.Body), "done")
+
+		return strings.Join(append(fields, describeRedirects(command.Redirects)...), " ")
+
+	case *ArithmeticForClause:
+		fields := []string{"for", "((" + command.Init + ";" + command.Condition + ";" + command.Update + "))", "do", describeList(command.Body), "done"}
+
+		return strings.Join(append(fields, describeRedirects(command.Redirects)...), " ")
+
+	case *WhileClause:
+		keyword := "while"
+		if command.Until {
+			keyword = "until"
+		}
+
+		fields := []string{keyword, describeList(command.Condition), "do", describeList(command.Body), "done"}
+
+		return strings.Join(append(fields, describeRedirects(command.Redirects)...), " ")
+	}
+
+	return fmt.Sprintf("%T", command)
+}
+
+// describeRedirects renders redirections as "{operator target}".
+func describeRedirects(redirects []*Redirect) []string {
+	var fields []string
+
+	for _, redirect := range redirects {
+		fields = append(fields, "{"+redirect.Operator+" "+redirect.Target.Raw+"}")
+	}
+
+	return fields
+}
+
+// describeParts renders the parts of a word, naming each kind of part.
+func describeParts(parts []WordPart) string {
+	var fields []string
+
+	for _, part := range parts {
+		switch part := part.(type) {
+		case *Literal:
+			if part.Escaped {
+				fields = append(fields, "esc("+part.Value+")")
+			} else {
+				fields = append(fields, "lit("+part.Value+")")
+			}
+		case *SingleQuoted:
+			fields = append(fields, "sq("+part.Value+")")
+		case *DoubleQuoted:
+			fields = append(fields, "dq("+describeParts(part.Parts)+")")
+		case *Expansion:
+			kind := map[ExpansionKind]string{ParameterExpansion: "param", CommandSubstitution: "cmd", ArithmeticExpansion: "arith", ProcessSubstitution: "proc"}[part.Kind]
+			fields = append(fields, kind+"("+part.Text+")")
+		}
+	}
+
+	return strings.Join(fields, " ")
+}
+
+func TestParseTree(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		input       string
+		expected    string
+		expectedErr error
+	}{
+		{name: "simple command", input: "ls -l /tmp", expected: "[ls -l /tmp]"},
+		{name: "empty input", input: "  \n\n ", expected: ""},
+		{name: "list operators", input: "make && ./app || echo failed; echo done", expected: "[make] && [./app] || [echo failed] ; [echo done]"},
+		{name: "operators without spaces", input: "a&&b||c;d", expected: "[a] && [b] || [c] ; [d]"},
+		{name: "pipeline", input: "ls | grep go | wc -l", expected: "[ls] | [grep go] | [wc -l]"},
+		{name: "negated pipeline", input: "! grep -q x f | wc && ! ! true", expected: "! [grep -q x f] | [wc] && [true]"},
+		{name: "negated compound command", input: "! { a; }", expected: "! { [a] }"},
+		{name: "quoted bang is a word", input: "'!' a; echo !", expected: "['!' a] ; [echo !]"},
+		{name: "newlines separate commands", input: "echo a\n\necho b\n", expected: "[echo a] ; [echo b]"},
+		{name: "newline after an operator", input: "make &&\n./app |\nwc", expected: "[make] && [./app] | [wc]"},
+		{name: "trailing semicolon", input: "echo a;", expected: "[echo a]"},
+		{name: "quoted operators are words", input: `echo "a|b" 'c;d' e\&\&f`, expected: `[echo "a|b" 'c;d' e\&\&f]`},
+		{name: "lone ampersand is a word", input: "echo a & b", expected: "[echo a & b]"},
+		{name: "redirections", input: "sort -r < in.txt > out.txt 2>> err.log", expected: "[sort -r {< in.txt} {> out.txt} {2>> err.log}]"},
+		{name: "quoted redirection operators are words", input: `echo ">" '2>' \< x`, expected: `[echo ">" '2>' \< x]`},
+		{name: "process substitutions are words", input: "diff <(ls a) >(wc -l)<(ls b)", expected: "[diff <(ls a) >(wc -l)<(ls b)]"},
+		{name: "redirection from a process substitution", input: "cat < <(ls)", expected: "[cat {< <(ls)}]"},
+		{name: "redirection only", input: "> out.txt", expected: "[{> out.txt}]"},
+		{name: "assignments", input: "LANG=C FOO=\"a b\" sort x=1", expected: `[=LANG=C =FOO="a b" sort x=1]`},
+		{name: "assignment only", input: "x=1", expected: "[=x=1]"},
+		{name: "array assignment", input: "arr=(a 'b c' [5]=$x) n[1]=2", expected: "[=arr=(a 'b c' [5]=$x) =n[1]=2]"},
+		{name: "array assignment across lines", input: "arr=(a\nb)\necho", expected: "[=arr=(a\nb)] ; [echo]"},
+		{name: "quoted name is not an assignment", input: `"x"=1`, expected: `["x"=1]`},
+		{name: "arithmetic command", input: "((x = 1 | 2)) && echo", expected: "((x = 1 | 2)) && [echo]"},
+		{name: "redirections without spaces", input: "echo hi>out.txt 2>&1|wc<in", expected: "[echo hi {> out.txt} {2>& 1}] | [wc {< in}]"},
+		{name: "duplication target touching a redirection", input: "cmd 2>&1>out", expected: "[cmd {2>& 1} {> out}]"},
+		{name: "duplication to stderr touching a redirection", input: "echo x 1>&2>/dev/null", expected: "[echo x {1>& 2} {> /dev/null}]"},
+		{name: "input duplication", input: "cat <&0 0<&0", expected: "[cat {<& 0} {0<& 0}]"},
+		{name: "combined redirections", input: "make &>log; make &>>log >&all", expected: "[make {&> log}] ; [make {&>> log} {>& all}]"},
+		{name: "io-number must touch the operator", input: "echo 2 >x a2>y 2>>z", expected: "[echo 2 a2 {> x} {> y} {2>> z}]"},
+		{name: "io-number only precedes < and >", input: "echo 2&>x", expected: "[echo 2 {&> x}]"},
+		{name: "operators inside words split them", input: "a;b|c&&d", expected: "[a] ; [b] | [c] && [d]"},
+		{name: "expansions keep their operators", input: "echo $(a | b; c) ${x:-a&&b} `d|e`", expected: "[echo $(a | b; c) ${x:-a&&b} `d|e`]"},
+		{name: "if", input: "if a; then b; fi", expected: "if [a] then [b] fi"},
+		{name: "if with elif and else", input: "if a; then b\nelif c && d; then e; f\nelse g; fi", expected: "if [a] then [b] elif [c] && [d] then [e] ; [f] else [g] fi"},
+		{name: "if across lines", input: "if a\nthen\n  b\nfi\necho", expected: "if [a] then [b] fi ; [echo]"},
+		{name: "nested if with redirection", input: "if if a; then b; fi; then c; fi >out | wc", expected: "if if [a] then [b] fi then [c] fi {> out} | [wc]"},
+		{name: "arithmetic condition", input: "if ((x > 1)); then ((x--)); fi", expected: "if ((x > 1)) then ((x--)) fi"},
+		{name: "reserved words only at command start", input: "echo if then fi; \"if\" a", expected: `[echo if then fi] ; ["if" a]`},
+		{name: "for", input: "for x in a \"b c\"; do echo $x; done", expected: `for x in a "b c" do [echo $x] done`},
+		{name: "for without in", input: "for x; do echo; done", expected: "for x do [echo] done"},
+		{name: "for with empty word list", input: "for x in; do echo; done", expected: "for x in do [echo] done"},
+		{name: "for across lines", input: "for x in a b\ndo\n  echo $x\ndone", expected: "for x in a b do [echo $x] done"},
+		{name: "reserved words as for words", input: "for x in do done; do echo; done", expected: "for x in do done do [echo] done"},
+		{name: "arithmetic for", input: "for ((i = 0; i < 3; i++)); do echo; done > out", expected: "for ((i = 0;i < 3;i++)) do [echo] done {> out}"},
+		{name: "arithmetic for with empty parts", input: "for ((;;))\ndo break; done", expected: "for ((;;)) do [break] done"},
+		{name: "while", input: "while ((n < 3)); do ((n++)); done", expected: "while ((n < 3)) do ((n++)) done"},
+		{name: "until piped", input: "until a || b; do c; done | wc", expected: "until [a] || [b] do [c] done | [wc]"},
+		{name: "case", input: "case $x in a|b) echo ab;; \"*\") echo star ;& (*) echo any;;& esac", expected: `case $x in a|b) [echo ab] ;; "*") [echo star] ;& *) [echo any] ;;& esac`},
+		{name: "case across lines", input: "case $x in\n  a)\n    echo a\n    ;;\n  *) echo b\nesac > out", expected: "case $x in a) [echo a] ;; *) [echo b] ;; esac {> out}"},
+		{name: "case with empty body and no items", input: "case x in a) ;; esac; case y in esac", expected: "case x in a)  ;; esac ; case y in esac"},
+		{name: "case patterns are words", input: "case x in if|[a-z]*) echo;; esac", expected: "case x in if|[a-z]*) [echo] ;; esac"},
+		{name: "function", input: "greet() { echo hi $1; }; greet you", expected: "greet() { [echo hi $1] } ; [greet you]"},
+		{name: "function with spaces and newlines", input: "f ( )\n{\n  a\n  b\n} > out", expected: "f() { [a] ; [b] } {> out}"},
+		{name: "function keyword", input: "function f { a; }; function g() { b; }", expected: "f() { [a] } ; g() { [b] }"},
+		{name: "function names may have dashes", input: "my-func() { a; }", expected: "my-func() { [a] }"},
+		{name: "braces are words elsewhere", input: "echo { }", expected: "[echo { }]"},
+		{name: "subshell", input: "(cd /tmp; make) && echo", expected: "( [cd /tmp] ; [make] ) && [echo]"},
+		{name: "subshell across lines with redirection", input: "(\n  a\n  b\n) > out | wc", expected: "( [a] ; [b] ) {> out} | [wc]"},
+		{name: "nested subshells", input: "( (a); b)", expected: "( ( [a] ) ; [b] )"},
+		{name: "brace group", input: "{ a; b; } 2> err || c", expected: "{ [a] ; [b] } {2> err} || [c]"},
+		{name: "brace group across lines", input: "{\n  a\n}", expected: "{ [a] }"},
+		{name: "function with a subshell body", input: "f() (cd /tmp; a)", expected: "f() ( [cd /tmp] ; [a] )"},
+		{name: "function with a loop body", input: "f() for x; do a; done", expected: "f() for x do [a] done"},
+		{name: "nested loops", input: "while a; do for x in y; do b; done; done", expected: "while [a] do for x in y do [b] done done"},
+		{name: "leading semicolon", input: "; ls", expectedErr: ErrSyntax},
+		{name: "double semicolon", input: "ls ; ;", expectedErr: ErrSyntax},
+		{name: "empty pipeline stage", input: "ls | | wc", expectedErr: ErrSyntax},
+		{name: "trailing pipe", input: "ls |", expectedErr: ErrSyntax},
+		{name: "trailing and", input: "ls &&", expectedErr: ErrSyntax},
+		{name: "missing redirection target", input: "echo >", expectedErr: ErrSyntax},
+		{name: "redirection target is an operator", input: "echo > | wc", expectedErr: ErrSyntax},
+		{name: "word after arithmetic command", input: "((1)) x", expectedErr: ErrSyntax},
+		{name: "parentheses later in a command", input: "echo ((a))", expectedErr: ErrSyntax},
+		{name: "unexpected closing parenthesis", input: "echo a)", expectedErr: ErrSyntax},
+		{name: "empty condition", input: "if then b; fi", expectedErr: ErrSyntax},
+		{name: "empty body", input: "if a; then fi", expectedErr: ErrSyntax},
+		{name: "missing fi", input: "if a; then b", expectedErr: ErrSyntax},
+		{name: "fi without if", input: "echo a; fi", expectedErr: ErrSyntax},
+		{name: "word after fi", input: "if a; then b; fi c", expectedErr: ErrSyntax},
+		{name: "invalid for variable", input: "for 1x in a; do b; done", expectedErr: ErrSyntax},
+		{name: "for without do", input: "for x in a; echo; done", expectedErr: ErrSyntax},
+		{name: "for words without separator", input: "for x in a do b; done", expectedErr: ErrSyntax},
+		{name: "arithmetic for with two parts", input: "for ((i = 0; i < 3)); do b; done", expectedErr: ErrSyntax},
+		{name: "missing done", input: "while a; do b", expectedErr: ErrSyntax},
+		{name: "empty loop body", input: "while a; do done", expectedErr: ErrSyntax},
+		{name: "done without loop", input: "echo; done", expectedErr: ErrSyntax},
+		{name: "case without in", input: "case x a) b;; esac", expectedErr: ErrSyntax},
+		{name: "case pattern without parenthesis", input: "case x in a b;; esac", expectedErr: ErrSyntax},
+		{name: "missing esac", input: "case x in a) b;;", expectedErr: ErrSyntax},
+		{name: "case terminator outside case", input: "echo a;; echo b", expectedErr: ErrSyntax},
+		{name: "case terminator in if", input: "if a; then b;; fi", expectedErr: ErrSyntax},
+		{name: "esac without case", input: "echo; esac", expectedErr: ErrSyntax},
+		{name: "bang without a command", input: "!", expectedErr: ErrSyntax},
+		{name: "bang before an operator", input: "! && a", expectedErr: ErrSyntax},
+		{name: "function without body", input: "f()", expectedErr: ErrSyntax},
+		{name: "empty subshell", input: "( )", expectedErr: ErrSyntax},
+		{name: "unclosed subshell", input: "(a; b", expectedErr: ErrSyntax},
+		{name: "word after subshell", input: "(a) b", expectedErr: ErrSyntax},
+		{name: "brace group without separator", input: "{ a }", expectedErr: ErrSyntax},
+		{name: "closing brace without group", input: "a; }", expectedErr: ErrSyntax},
+		{name: "function body is not a group", input: "f() echo", expectedErr: ErrSyntax},
+		{name: "function with empty body", input: "f() { }", expectedErr: ErrSyntax},
+		{name: "unclosed function body", input: "f() { a;", expectedErr: ErrSyntax},
+		{name: "quoted function name", input: "function 'f' { a; }", expectedErr: ErrSyntax},
+		{name: "unclosed quote", input: `echo "a`, expectedErr: ErrUnclosedQuote},
+		{name: "trailing backslash", input: `echo a\`, expectedErr: ErrUnescapedCharacter},
+		{name: "unclosed expansion", input: "echo $(a", expectedErr: ErrUnclosedExpansion},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			list, err := NewDefaultParser().ParseTree(tt.input)
+
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Errorf("Expected error: %v got %v", tt.expectedErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Expected no error got %v", err)
+				return
+			}
+
+			if got := describeList(list); got != tt.expected {
+				t.Errorf("input: %q\nexpected: %s\ngot:      %s", tt.input, tt.expected, got)
+			}
+
+		})
+
+	}
+
+}
+
+func TestParseTree_WordParts(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "literal", input: "hello", expected: "lit(hello)"},
+		{name: "mixed quoting", input: `pre"a $x"'*'`, expected: "lit(pre) dq(lit(a ) param(x)) sq(*)"},
+		{name: "escapes", input: `a\ b\*`, expected: "lit(a) esc( ) lit(b) esc(*)"},
+		{name: "escapes inside double quotes", input: `"\$x \n \""`, expected: `dq(esc($) lit(x \n ) esc("))`},
+		{name: "expansions", input: "${HOME}$(date)$((1+2))`id`", expected: "param(HOME) cmd(date) arith(1+2) cmd(id)"},
+		{name: "lone dollar is literal", input: "5$", expected: "lit(5$)"},
+		{name: "process substitution", input: "a<(ls -l)>(wc)", expected: "lit(a) proc(ls -l) proc(wc)"},
+		{name: "empty quotes", input: `""''`, expected: "dq() sq()"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			list, err := NewDefaultParser().ParseTree(tt.input)
+
+			if err != nil {
+				t.Errorf("Expected no error got %v", err)
+				return
+			}
+
+			word := list.Pipelines[0].Commands[0].(*SimpleCommand).Words[0]
+
+			if got := describeParts(word.Parts); got != tt.expected {
+				t.Errorf("input: %q\nexpected: %s\ngot:      %s", tt.input, tt.expected, got)
+			}
+
+		})
+
+	}
+
+}
+
+func TestParseTree_Positions(t *testing.T) {
+
+	list, err := NewDefaultParser().ParseTree("echo hi\nls | wc  'é' $x")
+
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+
+	second := list.Pipelines[1]
+	wc := second.Commands[1].(*SimpleCommand)
+	quoted := wc.Words[1]
+	expansion := wc.Words[2].Parts[0]
+
+	tests := []struct {
+		name     string
+		node     Node
+		expected string
+	}{
+		{name: "list", node: list, expected: "0 1:1"},
+		{name: "second pipeline", node: second, expected: "8 2:1"},
+		{name: "pipeline command", node: wc, expected: "13 2:6"},
+		{name: "quoted word", node: quoted, expected: "17 2:10"},
+		{name: "expansion after a multibyte character", node: expansion, expected: "22 2:14"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			pos := tt.node.Pos()
+
+			if got := fmt.Sprintf("%d %s", pos.Offset, pos); got != tt.expected {
+				t.Errorf("expected position %s got %s", tt.expected, got)
+			}
+
+		})
+
+	}
+
+}
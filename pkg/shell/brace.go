@@ -0,0 +1,373 @@
+package shell
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// expandBraces performs brace expansion on a raw command line.
+//
+// Brace expansion is a purely textual pass that runs before Parse handles
+// quotes and "$" expansions. Every word of the line is expanded on its own
+// with expandBraceWord and the results are joined with single spaces, so
+// the returned line still contains its quotes and escapes for the parser.
+//
+// Braces that are quoted, escaped or part of an expansion such as ${var} or
+// $(cmd) stay literal. Leading NAME=value assignments are not expanded,
+// matching other shells.
+//
+// Parameters:
+//   - line: The raw command line
+//
+// Returns:
+//   - string: The line with every brace expression expanded
+//
+// Example:
+//
+//	expandBraces(`mkdir -p dir/{src,test} "{a,b}"`)
+//	// → `mkdir -p dir/src dir/test "{a,b}"`
+func expandBraces(line string) string {
+	if !strings.Contains(line, "{") {
+		return line
+	}
+
+	words := splitRawWords(line)
+	expanded := make([]string, 0, len(words))
+	isAssigning := true
+
+	for _, word := range words {
+		if _, _, ok := splitAssignment(word); ok && isAssigning {
+			expanded = append(expanded, word)
+			continue
+		}
+
+		isAssigning = false
+		expanded = append(expanded, expandBraceWord(word)...)
+	}
+
+	return strings.Join(expanded, " ")
+}
+
+// expandBraceWord expands the brace expressions in a single raw word.
+//
+// Two forms are recognised:
+//   - {a,b,c}: One word per comma-separated alternative; alternatives may
+//     be empty or contain further brace expressions, as in {a,b{1,2}}
+//   - {x..y[..step]}: A sequence of integers or single letters from x to y,
+//     counting down when y < x. Integers written with a leading zero are
+//     zero-padded to a common width
+//
+// Expressions expand left to right, so a{b,c}d{e,f} gives abde abdf acde
+// acdf. A "{" without a matching "}", or a body that is neither a list nor
+// a sequence (such as {a} or {}), is left literal.
+//
+// Parameters:
+//   - word: A raw word, quotes and escapes included
+//
+// Returns:
+//   - []string: The expanded words (just word if it has no brace expression)
+//
+// Examples:
+//
+//	expandBraceWord("file.{go,md}")  → []string{"file.go", "file.md"}
+//	expandBraceWord("{08..10}")      → []string{"08", "09", "10"}
+//	expandBraceWord("{a..e..2}")     → []string{"a", "c", "e"}
+func expandBraceWord(word string) []string {
+	active := activeCharacters(word)
+
+	for open := 0; open < len(word); open++ {
+		if word[open] != '{' || !active[open] {
+			continue
+		}
+
+		close, commas := matchBrace(word, active, open)
+
+		if close < 0 {
+			continue
+		}
+
+		var items []string
+
+		if len(commas) > 0 {
+			start := open + 1
+
+			for _, comma := range commas {
+				items = append(items, word[start:comma])
+				start = comma + 1
+			}
+
+			items = append(items, word[start:close])
+		} else if sequence, ok := braceSequence(word[open+1 : close]); ok {
+			items = sequence
+		} else {
+			continue
+		}
+
+		prefix := word[:open]
+		suffixes := expandBraceWord(word[close+1:])
+		expanded := []string{}
+
+		for _, item := range items {
+			for _, middle := range expandBraceWord(item) {
+				for _, suffix := range suffixes {
+					expanded = append(expanded, prefix+middle+suffix)
+				}
+			}
+		}
+
+		return expanded
+	}
+
+	return []string{word}
+}
+
+// matchBrace finds the "}" that closes the active "{" at open, along with
+// the active commas at the top level of the expression.
+//
+// Returns:
+//   - int: Index of the closing "}", or -1 if the brace is never closed
+//   - []int: Indexes of the top-level commas
+func matchBrace(word string, active []bool, open int) (int, []int) {
+	depth := 0
+	var commas []int
+
+	for i := open + 1; i < len(word); i++ {
+		if !active[i] {
+			continue
+		}
+
+		switch word[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return i, commas
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				commas = append(commas, i)
+			}
+		}
+	}
+
+	return -1, nil
+}
+
+// braceSequence expands the body of a {x..y} or {x..y..step} expression.
+//
+// The endpoints must both be integers or both be single ASCII letters. The
+// sign of step is ignored; the direction always goes from x towards y, and
+// a step of 0 counts as 1.
+//
+// Returns:
+//   - []string: The sequence
+//   - bool: false if body is not a valid sequence
+func braceSequence(body string) ([]string, bool) {
+	parts := strings.Split(body, "..")
+
+	if len(parts) != 2 && len(parts) != 3 {
+		return nil, false
+	}
+
+	step := int64(1)
+
+	if len(parts) == 3 {
+		n, err := strconv.ParseInt(parts[2], 10, 64)
+
+		if err != nil {
+			return nil, false
+		}
+
+		step = max(n, -n, 1)
+	}
+
+	if isSequenceLetter(parts[0]) && isSequenceLetter(parts[1]) {
+		first, last := int64(parts[0][0]), int64(parts[1][0])
+		return countSequence(first, last, step, func(n int64) string {
+			return string(rune(n))
+		}), true
+	}
+
+	first, errFirst := strconv.ParseInt(parts[0], 10, 64)
+	last, errLast := strconv.ParseInt(parts[1], 10, 64)
+
+	if errFirst != nil || errLast != nil {
+		return nil, false
+	}
+
+	// a leading zero on either endpoint pads every number to the same width
+	width := 0
+	if hasLeadingZero(parts[0]) || hasLeadingZero(parts[1]) {
+		width = max(len(parts[0]), len(parts[1]))
+	}
+
+	return countSequence(first, last, step, func(n int64) string {
+		digits := strconv.FormatInt(max(n, -n), 10)
+		sign := ""
+
+		if n < 0 {
+			sign = "-"
+		}
+
+		if pad := width - len(sign) - len(digits); pad > 0 {
+			digits = strings.Repeat("0", pad) + digits
+		}
+
+		return sign + digits
+	}), true
+}
+
+// countSequence returns format(n) for n from first to last in increments
+// of step, counting down when last < first.
+func countSequence(first, last, step int64, format func(int64) string) []string {
+	var items []string
+
+	// compare distances rather than stepping past last, which could overflow
+	if first <= last {
+		for n := first; ; n += step {
+			items = append(items, format(n))
+			if last-n < step {
+				break
+			}
+		}
+	} else {
+		for n := first; ; n -= step {
+			items = append(items, format(n))
+			if n-last < step {
+				break
+			}
+		}
+	}
+
+	return items
+}
+
+// isSequenceLetter reports whether s is a single ASCII letter.
+func isSequenceLetter(s string) bool {
+	return len(s) == 1 && s[0] < unicode.MaxASCII && unicode.IsLetter(rune(s[0]))
+}
+
+// hasLeadingZero reports whether a decimal integer is written with a
+// leading zero, as in 01 or -007.
+func hasLeadingZero(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	return len(s) > 1 && s[0] == '0'
+}
+
+// splitRawWords splits a raw command line at unquoted whitespace without
+// removing quotes, escapes or expansions from the words.
+//
+// Example:
+//
+//	splitRawWords(`echo "a b" $(x y)`) → []string{"echo", `"a b"`, "$(x y)"}
+func splitRawWords(line string) []string {
+	active := activeCharacters(line)
+	words := []string{}
+	start := -1
+
+	for i, r := range line {
+		if active[i] && unicode.IsSpace(r) {
+			if start >= 0 {
+				words = append(words, line[start:i])
+				start = -1
+			}
+			continue
+		}
+
+		if start < 0 {
+			start = i
+		}
+	}
+
+	if start >= 0 {
+		words = append(words, line[start:])
+	}
+
+	return words
+}
+
+// activeCharacters reports, for every byte of line, whether it is an
+// unquoted character that the shell may interpret.
+//
+// Bytes inside single or double quotes, escaped by a backslash, or inside
+// ${...}, $(...), $((...)), `...`, ((...)), <(...) and >(...) are
+// inactive, as are the quotes and backslashes themselves. The scan follows
+// the same rules as splitOnOperators.
+//
+// Example:
+//
+//	activeCharacters(`a"b"`) → []bool{true, false, false, false}
+func activeCharacters(line string) []bool {
+	active := make([]bool, len(line))
+
+	runeReader := strings.NewReader(line)
+	currState := stateOutside
+	isEscaping := false
+
+	for {
+		pos := len(line) - runeReader.Len()
+		ch, _, err := runeReader.ReadRune()
+
+		if err != nil {
+			break
+		}
+
+		if isEscaping {
+			isEscaping = false
+			continue
+		}
+
+		if currState == stateOutside && ch == '$' && strings.HasPrefix(line[pos+1:], "'") {
+			runeReader.ReadRune()
+			currState = stateANSIQuote
+			continue
+		}
+
+		if (currState == stateOutside || currState == stateDoubleQuote) && (ch == '$' || ch == '`') {
+			skipExpansion(runeReader, ch)
+			continue
+		}
+
+		switch currState {
+		case stateOutside:
+			if ch == '\\' {
+				isEscaping = true
+			} else if ch == '\'' {
+				currState = stateSingleQuote
+			} else if ch == '"' {
+				currState = stateDoubleQuote
+			} else if strings.HasPrefix(line[pos:], "((") {
+				runeReader.ReadRune()
+				readArithmetic(runeReader)
+			} else if isProcessSubstitution(line[pos:]) {
+				runeReader.ReadRune()
+				readParenthesized(runeReader)
+			} else {
+				active[pos] = true
+			}
+
+		case stateSingleQuote:
+			if ch == '\'' {
+				currState = stateOutside
+			}
+
+		case stateDoubleQuote:
+			if ch == '\\' {
+				isEscaping = true
+			} else if ch == '"' {
+				currState = stateOutside
+			}
+
+		case stateANSIQuote:
+			if ch == '\\' {
+				isEscaping = true
+			} else if ch == '\'' {
+				currState = stateOutside
+			}
+		}
+	}
+
+	return active
+}
@@ -0,0 +1,53 @@
+package shell
+
+import "testing"
+
+func TestExpandBraces(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "no braces", input: "echo hello", expected: "echo hello"},
+		{name: "list", input: "mkdir -p dir/{src,test,docs}", expected: "mkdir -p dir/src dir/test dir/docs"},
+		{name: "prefix and suffix", input: "echo a{b,c}d", expected: "echo abd acd"},
+		{name: "two expressions", input: "echo {a,b}{1,2}", expected: "echo a1 a2 b1 b2"},
+		{name: "nested", input: "echo {a,b{1,2}}", expected: "echo a b1 b2"},
+		{name: "empty alternative", input: "echo file{,.bak}", expected: "echo file file.bak"},
+		{name: "numeric range", input: "echo {1..5}", expected: "echo 1 2 3 4 5"},
+		{name: "descending range", input: "echo {3..1}", expected: "echo 3 2 1"},
+		{name: "negative range", input: "echo {-1..1}", expected: "echo -1 0 1"},
+		{name: "zero padded range", input: "echo {08..11}", expected: "echo 08 09 10 11"},
+		{name: "zero padded negative range", input: "echo {-01..1}", expected: "echo -01 000 001"},
+		{name: "range with step", input: "echo {0..10..5}", expected: "echo 0 5 10"},
+		{name: "step does not overshoot", input: "echo {1..10..4}", expected: "echo 1 5 9"},
+		{name: "letter range with step", input: "echo {a..z..5}", expected: "echo a f k p u z"},
+		{name: "descending letters", input: "echo {c..a}", expected: "echo c b a"},
+		{name: "range inside list", input: "echo {x,{1..3}}", expected: "echo x 1 2 3"},
+		{name: "single item is literal", input: "echo {a}", expected: "echo {a}"},
+		{name: "empty braces are literal", input: "echo {}", expected: "echo {}"},
+		{name: "unclosed brace is literal", input: "echo {a,b", expected: "echo {a,b"},
+		{name: "mixed range is literal", input: "echo {1..z}", expected: "echo {1..z}"},
+		{name: "double quoted braces are literal", input: `echo "{a,b}"`, expected: `echo "{a,b}"`},
+		{name: "single quoted comma is literal", input: `echo {a',b'}`, expected: `echo {a',b'}`},
+		{name: "escaped brace is literal", input: `echo \{a,b}`, expected: `echo \{a,b}`},
+		{name: "quotes inside alternatives are kept", input: `echo {"a b",c}`, expected: `echo "a b" c`},
+		{name: "parameter expansion is untouched", input: "echo ${HOME}{1,2}", expected: "echo ${HOME}1 ${HOME}2"},
+		{name: "command substitution is untouched", input: "echo $(echo {a,b})", expected: "echo $(echo {a,b})"},
+		{name: "leading assignment is not expanded", input: "x={a,b} env", expected: "x={a,b} env"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			if got := expandBraces(tt.input); got != tt.expected {
+				t.Errorf("expandBraces(%q)\nexpected: %q\ngot:      %q", tt.input, tt.expected, got)
+			}
+
+		})
+
+	}
+
+}
@@ -0,0 +1,565 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+)
+
+// runCompound runs the body of a compound command with its redirections
+// applied once, for the command as a whole.
+//
+// The redirections are expanded and applied on top of baseBindings, and the
+// resulting streams become the shell's own stdin, Out and Err while body
+// runs, so every command inside it inherits them: in
+// `if x; then a; b; fi > log` both a and b write to log. The shell's
+// streams are restored and the redirection files closed afterwards.
+//
+// Parameters:
+//   - redirects: The redirections written after the compound command
+//   - baseBindings: I/O streams the command inherits, such as pipe ends
+//   - body: Runs the compound command and returns its status
+//
+// Returns:
+//   - int: Exit status of body, or 1 when a redirection fails
+//   - error: Errors from body, or from command substitutions in the
+//     redirection targets that cannot be parsed
+func (shell *Shell) runCompound(redirects []*Redirect, baseBindings IOBindings, body func() (int, error)) (int, error) {
+
+	specs, err := shell.expandRedirects(redirects, nil)
+
+	// failed expansions fail the command, not the shell
+	if err != nil && shell.expansionFailure(err) {
+		return 1, nil
+	}
+
+	if err != nil {
+		return 2, err
+	}
+
+	ioBindings, cleanup, err := shell.redirectionManager.ApplyRedirections(specs, baseBindings)
+
+	if err != nil {
+		fmt.Fprintln(shell.Err, "redirection error:", err)
+		return 1, nil
+	}
+
+	if cleanup != nil {
+		defer cleanup()
+	}
+
+	// temporarily swap shell I/O for the commands inside
+	prevIn, prevOut, prevErr := shell.stdin, shell.Out, shell.Err
+	shell.stdin, shell.Out, shell.Err = ioBindings.Stdin, ioBindings.Stdout, ioBindings.Stderr
+
+	defer func() {
+		shell.stdin, shell.Out, shell.Err = prevIn, prevOut, prevErr
+	}()
+
+	return body()
+}
+
+// subshell returns a copy of the shell for running commands in isolation,
+// as ( list ), pipeline stages and command substitutions do.
+//
+// The copy starts with the shell's working directory, variables, functions,
+// aliases, options and positional parameters, but has its own tables, so nothing it
+// changes is visible to the shell it was made from. It gets its own parser
+// and expander bound to the copy, so $name inside it reads the copy's
+// variables and its aliases are the copy's.
+//
+// Returns:
+//   - *Shell: The copy, sharing the I/O streams of the shell
+func (shell *Shell) subshell() *Shell {
+	sub := *shell
+
+	sub.vars = make(map[string]*shellVariable, len(shell.vars))
+
+	for name, v := range shell.vars {
+		sub.vars[name] = v.clone()
+	}
+
+	sub.functions = maps.Clone(shell.functions)
+	sub.options = maps.Clone(shell.options)
+	sub.aliases = maps.Clone(shell.aliases)
+	sub.params = slices.Clone(shell.params)
+	sub.substitutions = slices.Clone(shell.substitutions)
+	sub.frames = make([]*callFrame, len(shell.frames))
+
+	for i, frame := range shell.frames {
+		sub.frames[i] = &callFrame{saved: maps.Clone(frame.saved)}
+	}
+
+	// command lookup follows the copy's PATH
+	if _, ok := shell.executor.(*DefaultExecutor); ok {
+		sub.executor = &DefaultExecutor{LookupFunc: sub.Lookup}
+	}
+
+	sub.bindParser()
+
+	return &sub
+}
+
+// bindParser gives the shell a parser whose expansions and aliases are
+// resolved against the shell itself.
+func (shell *Shell) bindParser() {
+	parser := NewDefaultParser()
+	shell.expander = shellExpander{shell: shell, parser: parser}
+	parser.SetExpander(shell.expander)
+	parser.SetAliases(shell.lookupAlias)
+	shell.parser = parser
+}
+
+// runSubshell runs the body of a ( list ) subshell in a copy of the shell.
+//
+// exit, return, break and continue inside the subshell only end the
+// subshell, and its status is that of the last command it ran.
+//
+// Parameters:
+//   - subshell: The parsed subshell
+//
+// Returns:
+//   - int: Exit status of the last command in the subshell
+//   - error: Errors from command substitutions that cannot be parsed
+//
+// Example:
+//
+//	$ (cd /tmp; pwd); pwd
+//	/tmp
+//	/home/user
+func (shell *Shell) runSubshell(subshell *Subshell) (int, error) {
+	sub := shell.subshell()
+	err := sub.runList(subshell.Body)
+
+	if sub.globFailure(err) {
+		return 1, nil
+	}
+
+	if err != nil && !isControlFlow(err) {
+		return sub.lastStatus, err
+	}
+
+	return sub.lastStatus, nil
+}
+
+// runIfClause executes an if command.
+//
+// The condition of each branch runs in turn; the body of the first one that
+// succeeds (exit status 0) runs and gives the status of the whole command.
+// Otherwise the else body runs, and without one the status is 0.
+//
+// Parameters:
+//   - clause: The parsed if command
+//
+// Returns:
+//   - int: Exit status of the body that ran, or 0
+//   - error: ErrExit when the exit builtin runs, or errors from command
+//     substitutions that cannot be parsed
+//
+// Example:
+//
+//	$ if test -d /tmp; then echo yes; else echo no; fi
+//	yes
+func (shell *Shell) runIfClause(clause *IfClause) (int, error) {
+
+	for _, branch := range clause.Branches {
+
+		if err := shell.runList(branch.Condition); err != nil {
+			return shell.lastStatus, err
+		}
+
+		if shell.lastStatus == 0 {
+			err := shell.runList(branch.Body)
+			return shell.lastStatus, err
+		}
+	}
+
+	if clause.Else != nil {
+		err := shell.runList(clause.Else)
+		return shell.lastStatus, err
+	}
+
+	return 0, nil
+}
+
+// runCaseClause executes a case command.
+//
+// The word is expanded without field splitting or filename expansion and
+// matched against the patterns of each item in order, with matchPattern.
+// Patterns are expanded only when they are reached, in pattern form, so
+// quoted characters in them match literally: "*" only matches a star. The
+// body of the first matching item runs, and then its terminator decides:
+// ";;" ends the command, ";&" runs the next body as well without testing
+// its patterns, and ";;&" goes on testing the following items.
+//
+// Parameters:
+//   - clause: The parsed case command
+//
+// Returns:
+//   - int: Exit status of the last body that ran, 0 when none did, or 1
+//     when the word or a pattern cannot be expanded
+//   - error: ErrExit, a break or continue, or errors from command
+//     substitutions that cannot be parsed
+//
+// Example:
+//
+//	$ case main.go in *.txt) echo text ;; *.go|*.mod) echo go ;; esac
+//	go
+func (shell *Shell) runCaseClause(clause *CaseClause) (int, error) {
+
+	word, _, err := shell.parser.expandSingleWord(clause.Word)
+
+	// failed expansions fail the command, not the shell
+	if err != nil && shell.expansionFailure(err) {
+		return 1, nil
+	}
+
+	if err != nil {
+		return 2, err
+	}
+
+	status := 0
+	isFallingThrough := false
+
+	for _, item := range clause.Items {
+
+		if !isFallingThrough {
+			matched, err := shell.matchCaseItem(item, word)
+
+			if err != nil && shell.expansionFailure(err) {
+				return 1, nil
+			}
+
+			if err != nil {
+				return 2, err
+			}
+
+			if !matched {
+				continue
+			}
+		}
+
+		status = 0
+
+		if len(item.Body.Pipelines) > 0 {
+			err := shell.runList(item.Body)
+			status = shell.lastStatus
+
+			if err != nil {
+				return status, err
+			}
+		}
+
+		switch item.Terminator {
+		case ";&":
+			isFallingThrough = true
+		case ";;&":
+			isFallingThrough = false
+		default:
+			return status, nil
+		}
+	}
+
+	return status, nil
+}
+
+// matchCaseItem reports whether word matches any of the patterns of a case
+// item, expanding them one at a time until one matches.
+func (shell *Shell) matchCaseItem(item *CaseItem, word string) (bool, error) {
+	for _, patternWord := range item.Patterns {
+		_, pattern, err := shell.parser.expandSingleWord(patternWord)
+
+		if err != nil {
+			return false, err
+		}
+
+		if matchPattern(pattern, word) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// loopControl is returned by the break and continue builtins to unwind the
+// enclosing loops. Like ErrExit it travels up through runList and the
+// compound commands until a loop handles it.
+type loopControl struct {
+	isContinue bool // continue rather than break
+	levels     int  // Number of enclosing loops to unwind, at least 1
+}
+
+// Error describes the loop control as the builtin that produced it.
+func (c *loopControl) Error() string {
+	if c.isContinue {
+		return fmt.Sprintf("continue %d", c.levels)
+	}
+
+	return fmt.Sprintf("break %d", c.levels)
+}
+
+// isControlFlow reports whether err is ErrExit, a break or continue, or a
+// return, which end commands early without being failures to report.
+func isControlFlow(err error) bool {
+	var control *loopControl
+	var ret *returnControl
+	return errors.Is(err, ErrExit) || errors.As(err, &control) || errors.As(err, &ret)
+}
+
+// loopAction is what a loop does after its condition or body returns.
+type loopAction int
+
+const (
+	loopNext     loopAction = iota // Carry on with the iteration
+	loopContinue                   // Start the next iteration
+	loopBreak                      // Leave the loop
+)
+
+// loopFlow decides how a loop proceeds after its condition or body returned
+// err.
+//
+// A break or continue for this loop alone is handled here; one that targets
+// outer loops leaves this loop and is returned, one level shorter, for the
+// enclosing loop to handle. Any other error also leaves the loop and is
+// returned unchanged.
+func loopFlow(err error) (loopAction, error) {
+	var control *loopControl
+
+	if !errors.As(err, &control) {
+		if err != nil {
+			return loopBreak, err
+		}
+
+		return loopNext, nil
+	}
+
+	if control.levels > 1 {
+		return loopBreak, &loopControl{isContinue: control.isContinue, levels: control.levels - 1}
+	}
+
+	if control.isContinue {
+		return loopContinue, nil
+	}
+
+	return loopBreak, nil
+}
+
+// runForClause executes a for loop over a list of words.
+//
+// The words are expanded once, before the first iteration, exactly like the
+// arguments of a simple command; the body then runs once per field with the
+// loop variable set to it. The variable keeps its last value after the
+// loop. Without "in", the loop runs over the positional parameters, as
+// if the words were "$@".
+//
+// Parameters:
+//   - clause: The parsed for loop
+//
+// Returns:
+//   - int: Exit status of the last body that ran, 0 when none did, or 1
+//     when the words cannot be expanded
+//   - error: ErrExit, a break or continue for an outer loop, or errors
+//     from command substitutions that cannot be parsed
+//
+// Example:
+//
+//	$ for name in a b; do echo "hi $name"; done
+//	hi a
+//	hi b
+func (shell *Shell) runForClause(clause *ForClause) (int, error) {
+
+	// without "in", the words are "$@"
+	fields := slices.Clone(shell.params)
+	var err error
+
+	if clause.Words != nil {
+		fields, err = shell.parser.ExpandWords(clause.Words)
+	}
+
+	// failed expansions fail the command, not the shell
+	if err != nil && shell.expansionFailure(err) {
+		return 1, nil
+	}
+
+	if err != nil {
+		return 2, err
+	}
+
+	shell.loopDepth++
+	defer func() { shell.loopDepth-- }()
+
+	status := 0
+
+	for _, field := range fields {
+		shell.setVar(clause.Name, field)
+
+		action, err := loopFlow(shell.runList(clause.Body))
+		status = shell.lastStatus
+
+		if action == loopBreak {
+			return status, err
+		}
+	}
+
+	return status, nil
+}
+
+// runArithmeticForClause executes a for ((init; condition; update)) loop.
+//
+// The init expression is evaluated once; then, while the condition is
+// non-zero (or empty), the body runs followed by the update expression. An
+// expression that fails to evaluate ends the loop with status 1.
+//
+// Parameters:
+//   - clause: The parsed loop
+//
+// Returns:
+//   - int: Exit status of the last body that ran, 0 when none did, or 1
+//     when an expression fails
+//   - error: ErrExit, a break or continue for an outer loop, or errors
+//     from command substitutions that cannot be parsed
+//
+// Example:
+//
+//	$ for ((i = 0; i < 3; i++)); do echo $i; done
+//	0
+//	1
+//	2
+func (shell *Shell) runArithmeticForClause(clause *ArithmeticForClause) (int, error) {
+
+	// evaluate reports the value of an expression, "1" when it is empty;
+	// failures are printed and end the loop
+	evaluate := func(expr string) (string, bool) {
+		if expr == "" {
+			return "1", true
+		}
+
+		value, err := shell.expander.ExpandArithmetic(expr)
+
+		if err != nil && !shell.expansionFailure(err) {
+			fmt.Fprintln(shell.Err, err)
+		}
+
+		return value, err == nil
+	}
+
+	if _, ok := evaluate(clause.Init); !ok {
+		return 1, nil
+	}
+
+	shell.loopDepth++
+	defer func() { shell.loopDepth-- }()
+
+	status := 0
+
+	for {
+		value, ok := evaluate(clause.Condition)
+
+		if !ok {
+			return 1, nil
+		}
+
+		if value == "0" {
+			return status, nil
+		}
+
+		action, err := loopFlow(shell.runList(clause.Body))
+		status = shell.lastStatus
+
+		if action == loopBreak {
+			return status, err
+		}
+
+		if _, ok := evaluate(clause.Update); !ok {
+			return 1, nil
+		}
+	}
+}
+
+// runWhileClause executes a while or until loop.
+//
+// The condition list runs before every iteration; a while loop runs its
+// body as long as the condition succeeds, an until loop as long as it
+// fails.
+//
+// Parameters:
+//   - clause: The parsed loop
+//
+// Returns:
+//   - int: Exit status of the last body that ran, or 0 when none did
+//   - error: ErrExit, a break or continue for an outer loop, or errors
+//     from command substitutions that cannot be parsed
+//
+// Example:
+//
+//	$ n=0; while ((n < 2)); do echo $n; ((n++)); done
+//	0
+//	1
+func (shell *Shell) runWhileClause(clause *WhileClause) (int, error) {
+
+	shell.loopDepth++
+	defer func() { shell.loopDepth-- }()
+
+	status := 0
+
+	for {
+		action, err := loopFlow(shell.runList(clause.Condition))
+
+		if action == loopBreak {
+			return shell.lastStatus, err
+		}
+
+		if action == loopContinue {
+			continue
+		}
+
+		if (shell.lastStatus == 0) == clause.Until {
+			return status, nil
+		}
+
+		action, err = loopFlow(shell.runList(clause.Body))
+		status = shell.lastStatus
+
+		if action == loopBreak {
+			return status, err
+		}
+	}
+}
+
+// loopControlBuiltin returns the break or continue builtin.
+//
+// Both take an optional count of enclosing loops to leave or skip to the
+// next iteration of, 1 by default; a count larger than the number of
+// enclosing loops applies to the outermost one. Outside a loop they print
+// a warning and do nothing.
+func loopControlBuiltin(name string) Builtin {
+	return func(args []string, shell *Shell) (int, error) {
+
+		levels := 1
+
+		if len(args) > 0 {
+			n, err := strconv.Atoi(args[0])
+
+			if err != nil {
+				fmt.Fprintf(shell.Err, "%s: %s: numeric argument required\n", name, args[0])
+				return 1, nil
+			}
+
+			if n < 1 {
+				fmt.Fprintf(shell.Err, "%s: %d: loop count out of range\n", name, n)
+				return 1, nil
+			}
+
+			levels = n
+		}
+
+		if shell.loopDepth == 0 {
+			fmt.Fprintf(shell.Err, "%s: only meaningful in a `for', `while', or `until' loop\n", name)
+			return 0, nil
+		}
+
+		return 0, &loopControl{isContinue: name == "continue", levels: min(levels, shell.loopDepth)}
+	}
+}
@@ -0,0 +1,306 @@
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runScript evaluates script in a new shell and returns what it wrote to
+// stdout, along with the final exit status.
+func runScript(t *testing.T, script string) (string, int) {
+	t.Helper()
+
+	var stdout bytes.Buffer
+	sh := New(strings.NewReader(""), &stdout, io.Discard)
+
+	if err := sh.evaluate(script); err != nil && !errors.Is(err, ErrExit) {
+		t.Fatalf("Expected no error got %v", err)
+	}
+
+	return stdout.String(), sh.lastStatus
+}
+
+func TestRunIfClause(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		script         string
+		expected       string
+		expectedStatus int
+	}{
+		{name: "true condition", script: "if ((1)); then echo yes; fi", expected: "yes\n"},
+		{name: "false condition", script: "if ((0)); then echo yes; fi", expected: ""},
+		{name: "else branch", script: "if ((0)); then echo yes; else echo no; fi", expected: "no\n"},
+		{name: "first true elif", script: "if ((0)); then echo a; elif ((0)); then echo b; elif ((1)); then echo c; elif ((1)); then echo d; fi", expected: "c\n"},
+		{name: "last command of the condition decides", script: "if ((1)); ((0)); then echo yes; else echo no; fi", expected: "no\n"},
+		{name: "and-or condition", script: "if ((0)) || ((1)); then echo yes; fi", expected: "yes\n"},
+		{name: "status of the body", script: "if ((1)); then ((0)); fi", expectedStatus: 1},
+		{name: "status without a branch", script: "((0)); if ((0)); then echo; fi", expectedStatus: 0},
+		{name: "nested", script: "if ((1)); then if ((0)); then echo a; else echo b; fi; echo c; fi", expected: "b\nc\n"},
+		{name: "multi-line", script: "x=2\nif ((x == 2))\nthen\n  echo two\nfi", expected: "two\n"},
+		{name: "exit inside a body", script: "if ((1)); then exit 4; fi; echo after", expectedStatus: 4},
+		{name: "piped", script: "if ((1)); then echo a; echo b; fi | cat", expected: "a\nb\n"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, status := runScript(t, tt.script)
+
+			if got != tt.expected {
+				t.Errorf("script: %q\nexpected: %q\ngot:      %q", tt.script, tt.expected, got)
+			}
+
+			if status != tt.expectedStatus {
+				t.Errorf("expected status %d got %d", tt.expectedStatus, status)
+			}
+
+		})
+
+	}
+
+}
+
+func TestRunLoops(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		script         string
+		expected       string
+		expectedStatus int
+	}{
+		{name: "for over words", script: "for x in a 'b c' d; do echo $x; done", expected: "a\nb c\nd\n"},
+		{name: "for over expansions", script: "v='1 2'; for x in $(echo 1 2) \"$v\" {a,b}; do echo \"<$x>\"; done", expected: "<1>\n<2>\n<1 2>\n<a>\n<b>\n"},
+		{name: "for keeps the last value", script: "for x in a b; do ((1)); done; echo $x", expected: "b\n"},
+		{name: "for over nothing", script: "((0)); for x in; do echo $x; done", expectedStatus: 0},
+		{name: "for without in uses the positional parameters", script: "set -- a 'b c'; for x; do echo \"[$x]\"; done", expected: "[a]\n[b c]\n"},
+		{name: "for without in inside a function", script: "f() { for x\ndo echo $x; done; }; f 1 2", expected: "1\n2\n"},
+		{name: "for status", script: "for x in 1 0; do ((x)); done", expectedStatus: 1},
+		{name: "arithmetic for", script: "for ((i = 0; i < 3; i++)); do echo $i; done", expected: "0\n1\n2\n"},
+		{name: "arithmetic for without a condition", script: "for ((i = 0; ; i++)); do ((i == 2)) && break; echo $i; done", expected: "0\n1\n"},
+		{name: "while", script: "n=0; while ((n < 3)); do echo $n; ((n++)); done", expected: "0\n1\n2\n"},
+		{name: "until", script: "n=0; until ((n == 2)); do echo $n; ((n++)); done", expected: "0\n1\n"},
+		{name: "while that never runs", script: "while ((0)); do echo a; done", expectedStatus: 0},
+		{name: "break", script: "for x in a b c; do if [ $x = b ]; then break; fi; echo $x; done; echo end", expected: "a\nend\n"},
+		{name: "continue", script: "for x in a b c; do if [ $x = b ]; then continue; fi; echo $x; done", expected: "a\nc\n"},
+		{name: "break 2", script: "for x in 1 2; do for y in a b; do echo $x$y; break 2; done; done; echo end", expected: "1a\nend\n"},
+		{name: "continue 2", script: "for x in 1 2; do for y in a b; do echo $x$y; continue 2; done; echo never; done", expected: "1a\n2a\n"},
+		{name: "break count above the loop depth", script: "while ((1)); do break 5; done; echo end", expected: "end\n"},
+		{name: "continue in arithmetic for runs the update", script: "for ((i = 0; i < 3; i++)); do ((i == 1)) && continue; echo $i; done", expected: "0\n2\n"},
+		{name: "break in a while condition", script: "n=0; while ((n < 2)) || break; do echo $n; ((n++)); done; echo end", expected: "0\n1\nend\n"},
+		{name: "break outside a loop", script: "break; echo after", expected: "after\n"},
+		{name: "invalid loop count", script: "for x in a; do break 0; echo $x; done", expected: "a\n", expectedStatus: 0},
+		{name: "break in a pipeline stage", script: "for x in a b; do echo | break; echo $x; done", expected: "a\nb\n"},
+		{name: "exit inside a loop", script: "for x in a b; do exit 3; done; echo after", expectedStatus: 3},
+		{name: "loop piped", script: "for x in b a; do echo $x; done | sort", expected: "a\nb\n"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, status := runScript(t, tt.script)
+
+			if got != tt.expected {
+				t.Errorf("script: %q\nexpected: %q\ngot:      %q", tt.script, tt.expected, got)
+			}
+
+			if status != tt.expectedStatus {
+				t.Errorf("expected status %d got %d", tt.expectedStatus, status)
+			}
+
+		})
+
+	}
+
+}
+
+func TestRunCaseClause(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		script         string
+		expected       string
+		expectedStatus int
+	}{
+		{name: "first match", script: "case main.go in *.txt) echo text;; *.go) echo go;; *) echo other;; esac", expected: "go\n"},
+		{name: "alternatives", script: "case b in a|b|c) echo abc;; esac", expected: "abc\n"},
+		{name: "no match", script: "((0)); case x in a) echo a;; esac", expected: "", expectedStatus: 0},
+		{name: "question mark and brackets", script: "case a7 in ?[0-9]) echo yes;; esac", expected: "yes\n"},
+		{name: "negated bracket", script: "case 7 in [!0-9]) echo letter;; *) echo digit;; esac", expected: "digit\n"},
+		{name: "expanded word", script: "f=notes.txt; case $f in *.txt) echo text;; esac", expected: "text\n"},
+		{name: "word is not split", script: "v='a b'; case $v in 'a b') echo whole;; esac", expected: "whole\n"},
+		{name: "inside a command substitution", script: "echo $(case x in x) echo c;; esac) $(case y in (x) ;; *) echo d;; esac)", expected: "c d\n"},
+		{name: "expanded pattern", script: "p='*.go'; case x.go in $p) echo glob;; esac", expected: "glob\n"},
+		{name: "quoted star is literal", script: "case abc in \"*\") echo star;; *) echo other;; esac", expected: "other\n"},
+		{name: "quoted star matches a star", script: "case '*' in '*') echo star;; esac", expected: "star\n"},
+		{name: "escaped pattern characters", script: "case 'a?' in a\\?) echo q;; esac; case ab in a\\?) echo q2;; esac", expected: "q\n"},
+		{name: "quoted expansion in pattern", script: "p='*'; case x in \"$p\") echo star;; *) echo other;; esac", expected: "other\n"},
+		{name: "fall through", script: "case a in a) echo a;& b) echo b;& c) echo c;; d) echo d;; esac", expected: "a\nb\nc\n"},
+		{name: "continue testing", script: "case ab in a*) echo a;;& *c) echo c;;& *b) echo b;; esac", expected: "a\nb\n"},
+		{name: "last item without terminator", script: "case x in x) echo x\nesac", expected: "x\n"},
+		{name: "status of the body", script: "case x in x) ((0));; esac", expectedStatus: 1},
+		{name: "empty body", script: "((0)); case x in x) ;; esac", expectedStatus: 0},
+		{name: "break inside a loop", script: "for x in a b c; do case $x in b) break;; esac; echo $x; done", expected: "a\n"},
+		{name: "piped", script: "case x in x) echo b; echo a;; esac | sort", expected: "a\nb\n"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, status := runScript(t, tt.script)
+
+			if got != tt.expected {
+				t.Errorf("script: %q\nexpected: %q\ngot:      %q", tt.script, tt.expected, got)
+			}
+
+			if status != tt.expectedStatus {
+				t.Errorf("expected status %d got %d", tt.expectedStatus, status)
+			}
+
+		})
+
+	}
+
+}
+
+func TestRunCompound_LoopRedirection(t *testing.T) {
+
+	out := filepath.Join(t.TempDir(), "out.txt")
+
+	got, _ := runScript(t, "for x in a b; do echo $x; done > "+out+"; echo c")
+
+	if got != "c\n" {
+		t.Errorf("expected only %q on stdout, got %q", "c\n", got)
+	}
+
+	content, err := os.ReadFile(out)
+
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+
+	// opened once for the whole loop, so the second iteration does not truncate it
+	if string(content) != "a\nb\n" {
+		t.Errorf("expected %q in the file, got %q", "a\nb\n", content)
+	}
+
+}
+
+func TestRunCompound_Redirection(t *testing.T) {
+
+	out := filepath.Join(t.TempDir(), "out.txt")
+
+	got, _ := runScript(t, "if ((1)); then echo a; echo b; fi > "+out+"; echo c")
+
+	if got != "c\n" {
+		t.Errorf("expected only %q on stdout, got %q", "c\n", got)
+	}
+
+	content, err := os.ReadFile(out)
+
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+
+	if string(content) != "a\nb\n" {
+		t.Errorf("expected %q in the file, got %q", "a\nb\n", content)
+	}
+
+}
+
+func TestRun_CompoundCommandScript(t *testing.T) {
+
+	var stdout bytes.Buffer
+	sh := New(strings.NewReader("if ((0))\nthen\n  echo no\nelse\n  echo yes\nfi\n"), &stdout, io.Discard)
+
+	if err := sh.Run(); err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+
+	// one prompt per command, and a continuation prompt per extra line
+	expected := "$ > > > > > yes\n$ "
+
+	if got := stdout.String(); got != expected {
+		t.Errorf("expected %q got %q", expected, got)
+	}
+
+}
+
+func TestRunSubshell(t *testing.T) {
+
+	dir := t.TempDir()
+
+	tests := []struct {
+		name           string
+		script         string
+		expected       string
+		expectedStatus int
+	}{
+		{name: "variables do not leak", script: "x=1; (x=2; echo $x); echo $x", expected: "2\n1\n"},
+		{name: "cd does not leak", script: "cd " + dir + "; (cd /; pwd); pwd", expected: "/\n" + dir + "\n"},
+		{name: "functions do not leak", script: "f() { echo outer; }; (f() { echo inner; }; f); f", expected: "inner\nouter\n"},
+		{name: "exit only ends the subshell", script: "(echo a; exit 3; echo b); echo $((1 + 1))", expected: "a\n2\n"},
+		{name: "status of the last command", script: "( ((1)); ((0)) )", expectedStatus: 1},
+		{name: "break inside a subshell", script: "for x in a b; do (break); echo $x; done", expected: "a\nb\n"},
+		{name: "piped", script: "(echo a; echo b) | cat", expected: "a\nb\n"},
+		{name: "brace group shares the shell", script: "x=1; { x=2; cd /; }; echo $x; pwd", expected: "2\n/\n"},
+		{name: "brace group status", script: "{ ((1)); ((0)); }", expectedStatus: 1},
+		{name: "function with a subshell body", script: "f() (x=2; cd /); x=1; cd " + dir + "; f; echo $x; pwd", expected: "1\n" + dir + "\n"},
+		{name: "pipeline assignments do not leak", script: "x=1; x=2 | x=3; echo $x", expected: "1\n"},
+		{name: "command substitution assignments do not leak", script: "x=1; echo $(x=2; cd /; echo $x) $x; pwd", expected: "2 1\n" + dir + "\n"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			script := tt.script
+			if !strings.HasPrefix(script, "cd ") {
+				script = "cd " + dir + "; " + script
+			}
+
+			got, status := runScript(t, script)
+
+			if got != tt.expected {
+				t.Errorf("script: %q\nexpected: %q\ngot:      %q", tt.script, tt.expected, got)
+			}
+
+			if status != tt.expectedStatus {
+				t.Errorf("expected status %d got %d", tt.expectedStatus, status)
+			}
+
+		})
+
+	}
+
+}
+
+func TestRunSubshell_RelativePaths(t *testing.T) {
+
+	dir := t.TempDir()
+
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+
+	script := "cd " + dir + "; (cd sub && echo inside > file.txt && echo *.txt); cat sub/file.txt"
+	got, _ := runScript(t, script)
+
+	// redirections and globs follow the subshell's directory
+	if got != "file.txt\ninside\n" {
+		t.Errorf("expected %q got %q", "file.txt\ninside\n", got)
+	}
+
+	if wd, _ := os.Getwd(); wd == filepath.Join(dir, "sub") {
+		t.Errorf("expected cd not to change the process's working directory")
+	}
+
+}
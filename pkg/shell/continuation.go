@@ -0,0 +1,499 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// continuation describes whether a command is complete and, if not, how the
+// next line of input joins it.
+type continuation int
+
+const (
+	inputComplete    continuation = iota // The command can run as it is
+	continueJoined                       // Trailing backslash: drop it and join the next line directly
+	continueQuoted                       // Open quote or expansion: the newline is part of the text
+	continueSpaced                       // Trailing |, && or ||: the next line is the rest of the command
+	continueCompound                     // Open if, case, loop, { or (: the newline separates commands
+)
+
+// readCommand reads the next complete command from the shell's input.
+//
+// The first line is read as is. While the text is incomplete, the shell
+// prints the continuation prompt ($PS2, "> " by default) and reads another
+// line, joining it as described by inputContinuation:
+//   - Unclosed quotes and expansions, process substitutions included, keep
+//     the newline: echo "a⏎b" prints two lines
+//   - A trailing backslash is removed along with the newline
+//   - A trailing |, && or || continues the pipeline or list
+//   - An if, case, loop, { or ( that has not been closed keeps reading until
+//     its fi, esac, done, } or ), as does the ( of an array assignment,
+//     and a function header such as `f()` keeps reading until its body.
+//     A syntax error before the end of the lines read so far, as in
+//     `if | x`, is reported at once instead
+//
+// Here-document bodies are read right after the line that introduces them
+// (see readHereDocuments), also with the continuation prompt.
+//
+// Returns:
+//   - *commandText: The complete command, or what was read so far when it
+//     is incomplete; nil with io.EOF and I/O errors
+//   - error: io.EOF when the input is exhausted before a command starts,
+//     a *ParseError when it ends in the middle of one (pointing at the
+//     open quote, or at the end for an unfinished command), or I/O errors
+//
+// Example:
+//
+//	$ echo "first
+//	> second"
+//	first
+//	second
+func (shell *Shell) readCommand() (*commandText, error) {
+	line, err := shell.readLine()
+
+	if err != nil {
+		return nil, err
+	}
+
+	command := &commandText{}
+
+	if err := shell.readHereDocuments(command, line); err != nil {
+		return command, err
+	}
+
+	for {
+		mode := inputContinuation(command.text)
+
+		if mode == inputComplete {
+			return command, nil
+		}
+
+		// more lines cannot mend a syntax error inside an open compound
+		// command, such as `if | x`
+		if mode == continueCompound {
+			if err := prematureSyntaxError(command.text); err != nil {
+				return command, err
+			}
+		}
+
+		if shell.interactive {
+			fmt.Fprint(shell.Out, shell.ps2())
+		}
+
+		line, err := shell.readLine()
+
+		if errors.Is(err, io.EOF) {
+			// the parser can tell which quote or compound command is open
+			if _, err := NewDefaultParser().ParseTree(command.text); err != nil {
+				return command, err
+			}
+
+			return command, newParseError(command.text, len(command.text), ErrSyntax, "", endOfFile)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		// the newline between the lines becomes part of the text, or is
+		// replaced by a space, or removed along with the backslash
+		switch mode {
+		case continueJoined:
+			command.text = command.text[:len(command.text)-1]
+		case continueSpaced:
+			command.write(" ", len(command.source), false)
+		default:
+			command.write("\n", len(command.source), true)
+		}
+
+		// here-documents only start outside quotes
+		if mode == continueSpaced || mode == continueCompound {
+			if err := shell.readHereDocuments(command, line); err != nil {
+				return command, err
+			}
+			continue
+		}
+
+		command.write(line, command.addLine(line), true)
+	}
+}
+
+// prematureSyntaxError returns the syntax error of an incomplete command
+// that is found before the end of its text, or nil. An error at the end,
+// such as a missing fi or done, only means that the command goes on.
+func prematureSyntaxError(text string) error {
+	_, err := NewDefaultParser().ParseTree(text)
+
+	var parseErr *ParseError
+
+	if !errors.As(err, &parseErr) || parseErr.Found == endOfFile {
+		return nil
+	}
+
+	if parseErr.Position.Offset >= len(strings.TrimRightFunc(text, unicode.IsSpace)) {
+		return nil
+	}
+
+	return err
+}
+
+// readLine reads one line from the shell's input without its line ending.
+//
+// A final line that is not terminated by a newline is still returned;
+// io.EOF is only reported once no text is left.
+func (shell *Shell) readLine() (string, error) {
+	line, err := shell.in.ReadString('\n')
+
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+
+	shell.lineNumber++
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// ps2 returns the continuation prompt: the value of PS2, or "> " when it
+// is unset.
+func (shell *Shell) ps2() string {
+	if prompt, ok := shell.getVar("PS2"); ok {
+		return prompt
+	}
+
+	return "> "
+}
+
+// inputContinuation reports whether text is a complete command and, if it
+// is not, how the next line continues it.
+//
+// The checks are made in order: quotes, escapes and expansions first (so
+// that keywords and operators inside them are ignored), then trailing
+// operators, then compound commands.
+//
+// Parameters:
+//   - text: The command text read so far
+//
+// Returns:
+//   - continuation: inputComplete, or the way the next line joins text
+//
+// Examples:
+//
+//	inputContinuation(`echo "a`)          → continueQuoted
+//	inputContinuation(`echo a \`)         → continueJoined
+//	inputContinuation(`ls |`)             → continueSpaced
+//	inputContinuation(`if true; then`)    → continueCompound
+//	inputContinuation(`echo done`)        → inputComplete
+func inputContinuation(text string) continuation {
+	runeReader := strings.NewReader(text)
+	currState := stateOutside
+	isEscaping := false
+
+	for {
+		pos := len(text) - runeReader.Len()
+		ch, _, err := runeReader.ReadRune()
+
+		if err != nil {
+			break
+		}
+
+		if isEscaping {
+			isEscaping = false
+			continue
+		}
+
+		if currState == stateOutside && ch == '$' && strings.HasPrefix(text[pos+1:], "'") {
+			runeReader.ReadRune()
+			currState = stateANSIQuote
+			continue
+		}
+
+		if (currState == stateOutside || currState == stateDoubleQuote) && (ch == '$' || ch == '`') {
+			if skipExpansion(runeReader, ch) != nil {
+				return continueQuoted
+			}
+			continue
+		}
+
+		switch currState {
+		case stateOutside:
+			if ch == '\\' {
+				isEscaping = true
+			} else if ch == '\'' {
+				currState = stateSingleQuote
+			} else if ch == '"' {
+				currState = stateDoubleQuote
+			} else if strings.HasPrefix(text[pos:], "((") {
+				runeReader.ReadRune()
+				if _, err := readArithmetic(runeReader); err != nil {
+					return continueQuoted
+				}
+			} else if isProcessSubstitution(text[pos:]) {
+				runeReader.ReadRune()
+				if _, err := readParenthesized(runeReader); err != nil {
+					return continueQuoted
+				}
+			}
+
+		case stateSingleQuote:
+			if ch == '\'' {
+				currState = stateOutside
+			}
+
+		case stateDoubleQuote:
+			if ch == '\\' {
+				isEscaping = true
+			} else if ch == '"' {
+				currState = stateOutside
+			}
+
+		case stateANSIQuote:
+			if ch == '\\' {
+				isEscaping = true
+			} else if ch == '\'' {
+				currState = stateOutside
+			}
+		}
+	}
+
+	if isEscaping {
+		return continueJoined
+	}
+
+	if currState != stateOutside {
+		return continueQuoted
+	}
+
+	trimmed := strings.TrimRightFunc(text, unicode.IsSpace)
+
+	if strings.HasSuffix(trimmed, "|") || strings.HasSuffix(trimmed, "&&") {
+		if active := activeCharacters(trimmed); active[len(trimmed)-1] {
+			return continueSpaced
+		}
+	}
+
+	if openCompoundCommands(text) > 0 || endsWithFunctionHeader(text) {
+		return continueCompound
+	}
+
+	return inputComplete
+}
+
+// endsWithFunctionHeader reports whether text ends with the header of a
+// function definition whose body is still to come, `f()` or `function f`,
+// possibly followed by newlines.
+func endsWithFunctionHeader(text string) bool {
+	tokens, err := NewDefaultParser().lex(text)
+
+	if err != nil {
+		return false
+	}
+
+	// n is the number of tokens before the trailing newlines and EOF
+	n := len(tokens) - 1
+	for n > 0 && tokens[n-1].kind == tokenOperator && tokens[n-1].text == "\n" {
+		n--
+	}
+
+	// the header must start a command
+	startsCommand := func(i int) bool {
+		return i == 0 || tokens[i-1].kind == tokenOperator
+	}
+
+	if n >= 3 && startsCommand(n-3) {
+		if tree := (&treeParser{tokens: tokens, index: n - 3}); tree.isFunctionName() {
+			return true
+		}
+	}
+
+	if n >= 2 && startsCommand(n-2) && tokens[n-1].kind == tokenWord {
+		if tree := (&treeParser{tokens: tokens, index: n - 2}); tree.isReservedWord("function") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compoundClosers maps the reserved words that open a compound command to
+// the word that closes it. Loops open with their keyword, so that a do on
+// a line of its own is still part of the loop.
+var compoundClosers = map[string]string{
+	"if":    "fi",
+	"case":  "esac",
+	"for":   "done",
+	"while": "done",
+	"until": "done",
+	"{":     "}",
+}
+
+// openCompoundCommands returns the number of compound commands that are
+// still open at the end of text.
+//
+// The parentheses of an array assignment, NAME=(...), count as a compound
+// command, so its elements may span lines.
+//
+// Reserved words only count at the start of a command: at the beginning of
+// the text, after a separator (; & | ( ) or a newline), or after a word
+// such as then or do that is followed by a command. Quoted words and words
+// inside expansions never count, so `echo if` and `echo "{"` are complete.
+//
+// Example:
+//
+//	openCompoundCommands("if true; then\n  while x; do") → 2
+//	openCompoundCommands("for i in a b") → 1
+func openCompoundCommands(text string) int {
+	active := activeCharacters(text)
+
+	var open []string
+	commandStart := true
+	wordStart := -1
+
+	handleWord := func(word string) {
+		if !commandStart {
+			return
+		}
+
+		if closer, ok := compoundClosers[word]; ok {
+			open = append(open, closer)
+			// the words of case and for are not commands
+			commandStart = word != "case" && word != "for"
+			return
+		}
+
+		switch word {
+		case "fi", "esac", "done", "}":
+			if len(open) > 0 && open[len(open)-1] == word {
+				open = open[:len(open)-1]
+			}
+			commandStart = false
+		case "then", "else", "elif", "do", "!":
+			// a command follows
+		default:
+			commandStart = false
+		}
+	}
+
+	for i := 0; i <= len(text); i++ {
+		isSeparator := i < len(text) && active[i] && strings.IndexByte(";&|()\n", text[i]) >= 0
+		isSpace := i < len(text) && active[i] && (text[i] == ' ' || text[i] == '\t')
+
+		if i < len(text) && !isSeparator && !isSpace {
+			if wordStart < 0 {
+				wordStart = i
+			}
+			continue
+		}
+
+		word := ""
+
+		if wordStart >= 0 {
+			word = text[wordStart:i]
+			handleWord(word)
+			wordStart = -1
+		}
+
+		if !isSeparator {
+			continue
+		}
+
+		switch text[i] {
+		case '(':
+			// a subshell, or the elements of NAME=(...)
+			if commandStart || isArrayAssignment(word) {
+				open = append(open, ")")
+			}
+		case ')':
+			if len(open) > 0 && open[len(open)-1] == ")" {
+				open = open[:len(open)-1]
+			}
+		}
+
+		commandStart = true
+	}
+
+	return len(open)
+}
+
+// commandText is a command read by readCommand: the text that is parsed,
+// and the input it was read from. The two differ where lines were joined
+// and where here-document bodies were moved into the command, so the text
+// keeps a map back to the input for reporting errors.
+type commandText struct {
+	text     string          // The command as it is parsed
+	source   string          // The lines read, separated by newlines
+	lines    int             // The number of lines in source
+	segments []sourceSegment // The pieces of text, in order
+}
+
+// sourceSegment is a piece of a commandText's text.
+type sourceSegment struct {
+	text     int  // Where the piece starts in the text
+	source   int  // Where it comes from in the source
+	verbatim bool // Whether it was copied from the source as it is; otherwise every offset maps to source
+}
+
+// String returns the text of the command.
+func (command *commandText) String() string {
+	return command.text
+}
+
+// addLine appends a line read from the input to the source and returns the
+// offset at which it starts there.
+func (command *commandText) addLine(line string) int {
+	if command.lines > 0 {
+		command.source += "\n"
+	}
+
+	start := len(command.source)
+	command.source += line
+	command.lines++
+
+	return start
+}
+
+// write appends s to the text. A verbatim s is the part of the source that
+// starts at offset source; any other s stands for the source there.
+func (command *commandText) write(s string, source int, verbatim bool) {
+	if s == "" {
+		return
+	}
+
+	command.segments = append(command.segments, sourceSegment{text: len(command.text), source: source, verbatim: verbatim})
+	command.text += s
+}
+
+// sourceOffset returns the offset in the source of a byte offset in the
+// text.
+func (command *commandText) sourceOffset(offset int) int {
+	// the last segment starting at or before offset holds it
+	i := sort.Search(len(command.segments), func(i int) bool {
+		return command.segments[i].text > offset
+	}) - 1
+
+	if i < 0 {
+		return offset
+	}
+
+	segment := command.segments[i]
+
+	if !segment.verbatim {
+		return segment.source
+	}
+
+	return min(segment.source+offset-segment.text, len(command.source))
+}
+
+// locate returns err, an error in the text of the command, positioned in
+// the source instead, so that it reports the line and column the user
+// typed.
+func (command *commandText) locate(err *ParseError) *ParseError {
+	located := *err
+	located.Source = command.source
+	located.Position = positionAt(command.source, command.sourceOffset(err.Position.Offset))
+
+	return &located
+}
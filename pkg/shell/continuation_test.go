@@ -0,0 +1,260 @@
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestInputContinuation(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		input    string
+		expected continuation
+	}{
+		{name: "complete command", input: "echo hello", expected: inputComplete},
+		{name: "open double quote", input: `echo "hello`, expected: continueQuoted},
+		{name: "open single quote", input: `echo 'it`, expected: continueQuoted},
+		{name: "closed quotes", input: `echo "a" 'b'`, expected: inputComplete},
+		{name: "open command substitution", input: "x=$(echo", expected: continueQuoted},
+		{name: "open parameter expansion", input: "echo ${HOME", expected: continueQuoted},
+		{name: "open arithmetic command", input: "((x = 1 +", expected: continueQuoted},
+		{name: "trailing backslash", input: `echo a \`, expected: continueJoined},
+		{name: "trailing backslash in double quotes", input: `echo "a \`, expected: continueJoined},
+		{name: "escaped backslash", input: `echo a \\`, expected: inputComplete},
+		{name: "backslash in single quotes", input: `echo '\`, expected: continueQuoted},
+		{name: "open ANSI-C quote", input: `echo $'it\'s`, expected: continueQuoted},
+		{name: "closed ANSI-C quote", input: `echo $'it\'s' |`, expected: continueSpaced},
+		{name: "trailing pipe", input: "ls |", expected: continueSpaced},
+		{name: "trailing and", input: "make &&  ", expected: continueSpaced},
+		{name: "trailing or", input: "cd src ||", expected: continueSpaced},
+		{name: "quoted pipe", input: `echo "|"`, expected: inputComplete},
+		{name: "escaped pipe", input: `echo \|`, expected: inputComplete},
+		{name: "open if", input: "if true; then", expected: continueCompound},
+		{name: "closed if", input: "if true; then echo; fi", expected: inputComplete},
+		{name: "open brace group", input: "{ echo a", expected: continueCompound},
+		{name: "closed brace group", input: "{ echo a; }", expected: inputComplete},
+		{name: "open loop", input: "for x in a b; do\necho $x", expected: continueCompound},
+		{name: "nested constructs", input: "while true; do\nif x; then\nfi", expected: continueCompound},
+		{name: "for before its do", input: "for i in a b", expected: continueCompound},
+		{name: "for without in before its do", input: "for i", expected: continueCompound},
+		{name: "while before its do", input: "while true", expected: continueCompound},
+		{name: "until before its do", input: "until test -f x", expected: continueCompound},
+		{name: "closed loop with do on its own line", input: "for i in a\ndo echo $i\ndone", expected: inputComplete},
+		{name: "loop words are not keywords", input: "for x in if do while; do echo; done", expected: inputComplete},
+		{name: "keywords only count at command start", input: "echo if do {", expected: inputComplete},
+		{name: "quoted keyword", input: `"if" true`, expected: inputComplete},
+		{name: "open subshell", input: "(cd src", expected: continueCompound},
+		{name: "open process substitution", input: "diff <(ls", expected: continueQuoted},
+		{name: "closed process substitution", input: "diff <(ls) <(ls -a)", expected: inputComplete},
+		{name: "case patterns in a substitution", input: "x=$(case a in a) echo;; esac)", expected: inputComplete},
+		{name: "open case in a substitution", input: "x=$(case a in a) echo;;", expected: continueQuoted},
+		{name: "open array assignment", input: "arr=(a b", expected: continueCompound},
+		{name: "closed array assignment", input: "arr=(a b)", expected: inputComplete},
+		{name: "function header", input: "greet()", expected: continueCompound},
+		{name: "function keyword header", input: "function greet\n", expected: continueCompound},
+		{name: "open function body", input: "greet() {", expected: continueCompound},
+		{name: "complete function", input: "greet() { echo hi; }", expected: inputComplete},
+		{name: "function as an argument", input: "echo function greet", expected: inputComplete},
+		{name: "case patterns", input: "case x in a) echo;; (b) echo;; esac", expected: inputComplete},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			if got := inputContinuation(tt.input); got != tt.expected {
+				t.Errorf("inputContinuation(%q) = %v, expected %v", tt.input, got, tt.expected)
+			}
+
+		})
+
+	}
+
+}
+
+func TestReadCommand(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		input       string
+		expected    string
+		expectedErr error
+	}{
+		{name: "single line", input: "echo hi\nnext\n", expected: "echo hi"},
+		{name: "last line without newline", input: "echo hi", expected: "echo hi"},
+		{name: "quote continues with a newline", input: "echo \"a\nb\"\n", expected: "echo \"a\nb\""},
+		{name: "backslash joins lines", input: "echo a\\\nb\n", expected: "echo ab"},
+		{name: "pipe continues with a space", input: "ls |\ngrep go\n", expected: "ls | grep go"},
+		{name: "compound command", input: "if x; then\n  y\nfi\n", expected: "if x; then\n  y\nfi"},
+		{name: "for with do on its own line", input: "for i in a b\ndo echo $i\ndone\nnext\n", expected: "for i in a b\ndo echo $i\ndone"},
+		{name: "while with do on its own line", input: "while true\ndo\n  break\ndone\n", expected: "while true\ndo\n  break\ndone"},
+		{name: "for without in", input: "for i\ndo echo $i\ndone\n", expected: "for i\ndo echo $i\ndone"},
+		{name: "here-document inside a compound command", input: "{\ncat <<E\nbody\nE\n}\n", expected: "{\ncat  << \"body\n\" \n}"},
+		{name: "end of input inside a quote", input: "echo \"open\n", expectedErr: ErrUnclosedQuote},
+		{name: "end of input inside a command", input: "if true; then\n", expectedErr: ErrSyntax},
+		{name: "no input", input: "", expectedErr: io.EOF},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			sh := New(strings.NewReader(tt.input), io.Discard, io.Discard)
+			res, err := sh.readCommand()
+
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Errorf("Expected error: %v got %v", tt.expectedErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Expected no error got %v", err)
+				return
+			}
+
+			if res.String() != tt.expected {
+				t.Errorf("input: %q\nexpected: %q\ngot:      %q", tt.input, tt.expected, res.String())
+			}
+
+		})
+
+	}
+
+}
+
+func TestRun_ReportsParseErrors(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		input       string
+		interactive bool
+		expected    string
+	}{
+		{name: "script line and column", input: "echo a\n\nls | | wc\n", expected: "build.sh:3:6: syntax error near unexpected token `|' (expected a command)\n"},
+		{name: "line inside a multi-line command", input: "if true\nthen\nfi\n", expected: "build.sh:3:1: syntax error near unexpected token `fi' (expected a command)\n"},
+		{name: "unclosed quote points at the quote", input: "echo a\necho \"open\n", expected: "build.sh:2:6: unclosed quote: unexpected end of file (expected `\"')\n"},
+		{name: "unfinished command at end of input", input: "while true; do\n", expected: "build.sh:1:15: syntax error: unexpected end of file (expected `done')\n"},
+		{name: "error inside a substitution", input: "echo\necho $(if)\n", expected: "build.sh:2: syntax error: unexpected end of file (expected `then')\n"},
+		{name: "line after a here-document", input: "cat <<EOF >/dev/null\na\nb\nEOF\nls | | wc\n", expected: "build.sh:5:6: syntax error near unexpected token `|' (expected a command)\n"},
+		{name: "line with a here-document", input: "cat <<EOF | | wc\nbody\nEOF\n", expected: "build.sh:1:13: syntax error near unexpected token `|' (expected a command)\n"},
+		{name: "here-document without a delimiter", input: "echo\ncat << \n", expected: "build.sh:2:8: syntax error near unexpected token `newline' (expected a delimiter)\n"},
+		{name: "line joined by a backslash", input: "echo a \\\n  b | | c\n", expected: "build.sh:2:7: syntax error near unexpected token `|' (expected a command)\n"},
+		{name: "pipeline continued on the next line", input: "ls |\n  | wc\n", expected: "build.sh:2:3: syntax error near unexpected token `|' (expected a command)\n"},
+		{name: "interactive caret", input: "ls | | wc\n", interactive: true, expected: "syntax error near unexpected token `|' (expected a command)\nls | | wc\n     ^\n"},
+		{name: "interactive caret on a here-document line", input: "cat <<EOF | | wc\nbody\nEOF\n", interactive: true, expected: "syntax error near unexpected token `|' (expected a command)\ncat <<EOF | | wc\n            ^\n"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			var stderr bytes.Buffer
+			sh := New(strings.NewReader(tt.input), io.Discard, &stderr)
+
+			if !tt.interactive {
+				sh.SetScript("build.sh", nil)
+			}
+
+			if err := sh.Run(); err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+
+			if got := stderr.String(); got != tt.expected {
+				t.Errorf("input: %q\nexpected: %q\ngot:      %q", tt.input, tt.expected, got)
+			}
+
+			if status := sh.ExitStatus(); status != 2 {
+				t.Errorf("expected status 2 got %d", status)
+			}
+
+		})
+
+	}
+
+}
+
+func TestRun_SyntaxErrorInOpenCommand(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		input          string
+		expected       string
+		expectedErrors string
+	}{
+		{name: "operator inside an open if", input: "if | x\necho after\n", expected: "after\n", expectedErrors: "build.sh:1:4: syntax error near unexpected token `|' (expected a command)\n"},
+		{name: "for without do", input: "for x in a b; echo $x\necho after\n", expected: "after\n", expectedErrors: "build.sh:1:15: syntax error near unexpected token `echo' (expected `do')\n"},
+		{name: "error on a later line", input: "while true\ndo echo a; fi\necho after\n", expected: "after\n", expectedErrors: "build.sh:2:12: syntax error near unexpected token `fi' (expected a command)\n"},
+		{name: "open commands still continue", input: "for x in a b\ndo\necho $x\ndone\ncase x\nin x) echo c;; esac\n", expected: "a\nb\nc\n"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			var stdout, stderr bytes.Buffer
+			sh := New(strings.NewReader(tt.input), &stdout, &stderr)
+			sh.SetScript("build.sh", nil)
+
+			if err := sh.Run(); err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+
+			if got := stdout.String(); got != tt.expected {
+				t.Errorf("input: %q\nexpected: %q\ngot:      %q", tt.input, tt.expected, got)
+			}
+
+			if got := stderr.String(); got != tt.expectedErrors {
+				t.Errorf("input: %q\nexpected errors: %q\ngot:             %q", tt.input, tt.expectedErrors, got)
+			}
+
+		})
+
+	}
+
+}
+
+func TestRun_MultiLineLoops(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "for with do on its own line", input: "for i in a b\ndo\n  echo $i\ndone\n", expected: "a\nb\n"},
+		{name: "while with do on its own line", input: "n=0\nwhile ((n < 2))\ndo\n  echo $n; ((n++))\ndone\n", expected: "0\n1\n"},
+		{name: "until with do on its own line", input: "until true\ndo echo never\ndone\necho after\n", expected: "after\n"},
+		{name: "words on several lines", input: "for i in a \\\n  b\ndo echo $i; done\n", expected: "a\nb\n"},
+		{name: "nested loops", input: "for i in 1 2\ndo\n  for j in a\n  do echo $i$j\n  done\ndone\n", expected: "1a\n2a\n"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			var stdout, stderr bytes.Buffer
+			sh := New(strings.NewReader(tt.input), &stdout, &stderr)
+			sh.SetScript("loop.sh", nil)
+
+			if err := sh.Run(); err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+
+			if stderr.Len() > 0 {
+				t.Errorf("unexpected errors: %q", stderr.String())
+			}
+
+			if got := stdout.String(); got != tt.expected {
+				t.Errorf("input: %q\nexpected: %q\ngot:      %q", tt.input, tt.expected, got)
+			}
+
+		})
+
+	}
+
+}
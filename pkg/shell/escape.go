@@ -0,0 +1,169 @@
+package shell
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// escapeMode selects which backslash escapes decodeEscapes understands.
+type escapeMode int
+
+const (
+	ansiEscapes escapeMode = iota // $'...' strings: \nnn octal, \' \" \? and \cX
+	echoEscapes                   // echo -e: \0nnn octal and \c to stop output
+)
+
+// readANSIQuoted reads the text of a $'...' string up to the closing quote,
+// without decoding it. The reader must be positioned after the opening
+// quote. A backslash escapes the next character, so \' does not end the
+// string.
+//
+// Returns:
+//   - string: The raw text between the quotes
+//   - error: ErrUnclosedQuote if the text ends first
+func readANSIQuoted(runeReader io.RuneScanner) (string, error) {
+	var raw strings.Builder
+	isEscaping := false
+
+	for {
+		ch, _, err := runeReader.ReadRune()
+
+		if err == io.EOF {
+			return "", ErrUnclosedQuote
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		if ch == '\'' && !isEscaping {
+			return raw.String(), nil
+		}
+
+		isEscaping = ch == '\\' && !isEscaping
+		raw.WriteRune(ch)
+	}
+}
+
+// simpleEscapes maps the single-character escapes shared by $'...' and
+// echo -e to the characters they stand for.
+var simpleEscapes = map[byte]string{
+	'a': "\a", 'b': "\b", 'e': "\x1b", 'E': "\x1b", 'f': "\f",
+	'n': "\n", 'r': "\r", 't': "\t", 'v': "\v", '\\': "\\",
+}
+
+// decodeEscapes replaces the backslash escapes in text with the characters
+// they stand for.
+//
+// Supported escapes:
+//   - \a \b \e \E \f \n \r \t \v \\ : Control characters and backslash
+//   - \xHH       : Byte with hex value HH (one or two digits)
+//   - \uHHHH     : Unicode character (one to four hex digits)
+//   - \UHHHHHHHH : Unicode character (one to eight hex digits)
+//   - \nnn       : Byte with octal value nnn, in $'...' (one to three digits)
+//   - \0nnn      : Byte with octal value nnn, in echo -e (zero to three digits)
+//   - \' \" \?   : The character itself, in $'...'
+//   - \cX        : Control character X, in $'...'; in echo -e, \c ends the
+//     output instead
+//
+// Any other backslash is kept along with the character after it.
+//
+// Parameters:
+//   - text: The text to decode
+//   - mode: ansiEscapes or echoEscapes
+//
+// Returns:
+//   - string: The decoded text
+//   - bool: true when echo -e output stops at a \c
+//
+// Example:
+//
+//	decodeEscapes(`a\tb\x41é`, ansiEscapes) → "a\tbAé", false
+func decodeEscapes(text string, mode escapeMode) (string, bool) {
+	var decoded strings.Builder
+
+	for i := 0; i < len(text); i++ {
+		if text[i] != '\\' || i+1 == len(text) {
+			decoded.WriteByte(text[i])
+			continue
+		}
+
+		i++
+		ch := text[i]
+
+		if value, ok := simpleEscapes[ch]; ok {
+			decoded.WriteString(value)
+			continue
+		}
+
+		switch {
+		case ch == 'x' || ch == 'u' || ch == 'U':
+			maxDigits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[ch]
+			digits := prefixLength(text[i+1:], maxDigits, isHexDigit)
+
+			if digits == 0 {
+				decoded.WriteString(text[i-1 : i+1])
+				continue
+			}
+
+			value, _ := strconv.ParseUint(text[i+1:i+1+digits], 16, 32)
+			i += digits
+
+			if ch == 'x' {
+				decoded.WriteByte(byte(value))
+			} else if utf8.ValidRune(rune(value)) {
+				decoded.WriteRune(rune(value))
+			}
+
+		case mode == echoEscapes && ch == '0', mode == ansiEscapes && isOctalDigit(ch):
+			// echo's \0 prefix is not one of the digits
+			start := i
+			if mode == echoEscapes {
+				start++
+			}
+
+			digits := prefixLength(text[start:], 3, isOctalDigit)
+			value, _ := strconv.ParseUint("0"+text[start:start+digits], 8, 16)
+			decoded.WriteByte(byte(value))
+			i = start + digits - 1
+
+		case mode == echoEscapes && ch == 'c':
+			return decoded.String(), true
+
+		case mode == ansiEscapes && ch == 'c' && i+1 < len(text):
+			i++
+			decoded.WriteByte(text[i] & 0x1f)
+
+		case mode == ansiEscapes && (ch == '\'' || ch == '"' || ch == '?'):
+			decoded.WriteByte(ch)
+
+		default:
+			decoded.WriteString(text[i-1 : i+1])
+		}
+	}
+
+	return decoded.String(), false
+}
+
+// prefixLength returns how many of the first max bytes of s satisfy valid.
+func prefixLength(s string, max int, valid func(byte) bool) int {
+	n := 0
+
+	for n < len(s) && n < max && valid(s[n]) {
+		n++
+	}
+
+	return n
+}
+
+// isHexDigit reports whether ch is a hexadecimal digit.
+func isHexDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9' || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+// isOctalDigit reports whether ch is an octal digit.
+func isOctalDigit(ch byte) bool {
+	return '0' <= ch && ch <= '7'
+}
@@ -0,0 +1,83 @@
+package shell
+
+import (
+	"testing"
+)
+
+func TestDecodeEscapes(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		input        string
+		mode         escapeMode
+		expected     string
+		expectedStop bool
+	}{
+		{name: "control characters", input: `a\tb\nc\r\a\b\f\v`, mode: ansiEscapes, expected: "a\tb\nc\r\a\b\f\v"},
+		{name: "escape character", input: `\e[1m\E`, mode: ansiEscapes, expected: "\x1b[1m\x1b"},
+		{name: "hex bytes", input: `\x41\x4a\x7g\xg`, mode: ansiEscapes, expected: "AJ\ag\\xg"},
+		{name: "unicode", input: `é☺\U0001F600`, mode: ansiEscapes, expected: "é☺😀"},
+		{name: "octal", input: `\101\60\0`, mode: ansiEscapes, expected: "A0\x00"},
+		{name: "quotes", input: `\'\"\?\\`, mode: ansiEscapes, expected: `'"?\`},
+		{name: "control letter", input: `\cA\c[`, mode: ansiEscapes, expected: "\x01\x1b"},
+		{name: "unknown escapes are kept", input: `\q\é`, mode: ansiEscapes, expected: `\q\é`},
+		{name: "trailing backslash", input: `a\`, mode: ansiEscapes, expected: `a\`},
+		{name: "echo octal needs a zero", input: `\0101\101\0`, mode: echoEscapes, expected: "A\\101\x00"},
+		{name: "echo keeps quotes escaped", input: `\'\"`, mode: echoEscapes, expected: `\'\"`},
+		{name: "echo stops at \\c", input: `a\tb\cde`, mode: echoEscapes, expected: "a\tb", expectedStop: true},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, stop := decodeEscapes(tt.input, tt.mode)
+
+			if got != tt.expected {
+				t.Errorf("input: %q\nexpected: %q\ngot:      %q", tt.input, tt.expected, got)
+			}
+
+			if stop != tt.expectedStop {
+				t.Errorf("expected stop %v got %v", tt.expectedStop, stop)
+			}
+
+		})
+
+	}
+
+}
+
+func TestEchoBuiltin(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		script   string
+		expected string
+	}{
+		{name: "plain", script: `echo a  b`, expected: "a b\n"},
+		{name: "no newline", script: `echo -n a; echo b`, expected: "ab\n"},
+		{name: "escapes", script: `echo -e 'a\tb\x41\0102'`, expected: "a\tbAB\n"},
+		{name: "escapes off by default", script: `echo 'a\tb'`, expected: "a\\tb\n"},
+		{name: "combined options", script: `echo -ne 'a\n'; echo -eE 'b\n'`, expected: "a\nb\\n\n"},
+		{name: "stop output", script: `echo -e 'a\cb' c; echo d`, expected: "ad\n"},
+		{name: "options end at the first word", script: `echo a -n`, expected: "a -n\n"},
+		{name: "not an option", script: `echo -nx -; echo --`, expected: "-nx -\n--\n"},
+		{name: "ANSI-C quoting", script: `echo $'tab:\there' $'é'`, expected: "tab:\there é\n"},
+		{name: "ANSI-C quoting in substitutions", script: `echo "$(echo $'a)\'b')"`, expected: "a)'b\n"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, _ := runScript(t, tt.script)
+
+			if got != tt.expected {
+				t.Errorf("script: %q\nexpected: %q\ngot:      %q", tt.script, tt.expected, got)
+			}
+
+		})
+
+	}
+
+}
@@ -4,7 +4,11 @@ import (
 	"context"
 	"errors"
 	"io"
+	"io/fs"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"syscall"
 )
 
 // Executor defines the interface for executing external commands.
@@ -49,14 +53,17 @@ type Executor interface {
 	//
 	// Returns:
 	//   - int:    Exit code of the process (0 for success, non-zero for failure).
-	//            Returns -1 if the command is not found or other execution errors occur.
-	//   - error: ErrNotFound if the executable is not found in PATH,
-	//            nil otherwise (exit codes are returned as the int, not as errors).
+	//            Returns -1 if the command is not found.
+	//   - error: ErrNotFound if the executable is not found in PATH, the
+	//            reason the process could not be started, nil otherwise
+	//            (exit codes are returned as the int, not as errors).
 	//
 	// Exit code behavior:
-	//   - 0:      Successful execution
-	//   - 1-255: Command-specific error codes
-	//   - -1:    Command not found or execution failure
+	//   - 0:       Successful execution
+	//   - 1-255:   Command-specific error codes
+	//   - 126/127: The process could not be started (not executable / gone)
+	//   - 128+N:   Killed by signal N
+	//   - -1:      Command not found
 	//
 	// Example:
 	//
@@ -123,9 +130,33 @@ var ErrNotFound = errors.New("not found")
 //	}
 //	// After execution, stdout. String() contains command output
 type IOBindings struct {
-	Stdin  io.Reader // Input stream for the command (file descriptor 0)
-	Stdout io.Writer // Output stream for normal output (file descriptor 1)
-	Stderr io.Writer // Output stream for error messages (file descriptor 2)
+	Stdin      io.Reader  // Input stream for the command (file descriptor 0)
+	Stdout     io.Writer  // Output stream for normal output (file descriptor 1)
+	Stderr     io.Writer  // Output stream for error messages (file descriptor 2)
+	Env        []string   // Environment for external commands as "NAME=value" (nil inherits the process environment)
+	Dir        string     // Working directory for external commands and relative file names ("" is the process's own)
+	ExtraFiles []*os.File // Files external commands inherit as descriptors 3, 4, ...; nil entries are closed
+}
+
+// resolve returns the path of a file name relative to the working
+// directory of the bindings. Absolute names, and every name when Dir is
+// empty, are returned unchanged.
+//
+// Example:
+//
+//	IOBindings{Dir: "/tmp"}.resolve("out.txt") → "/tmp/out.txt"
+func (io IOBindings) resolve(name string) string {
+	return resolvePath(io.Dir, name)
+}
+
+// resolvePath joins a relative name onto dir; an absolute name or an empty
+// dir leaves the name as it is.
+func resolvePath(dir, name string) string {
+	if dir == "" || filepath.IsAbs(name) {
+		return name
+	}
+
+	return filepath.Join(dir, name)
 }
 
 // DefaultExecutor executes external commands using os/exec.
@@ -209,11 +240,17 @@ type DefaultExecutor struct {
 // Exit code extraction:
 //   - Normal exit (status 0):     Returns 0, nil
 //   - Normal exit (status N):     Returns N, nil
-//   - Abnormal termination:         Returns -1, nil
-//   - Command not found:           Returns -1, ErrNotFound
+//   - Killed by signal N:         Returns 128+N, nil (137 for SIGKILL)
+//   - Command not found:          Returns -1, ErrNotFound
+//   - Failed to start:            Returns 127 and the cause when the file
+//     has disappeared, 126 and the cause otherwise (exec format error,
+//     permission denied, an argument containing NUL, ...)
 //
 // I/O binding:
-//   - Only Stdout and Stderr are bound (Stdin could be added if needed)
+//   - Stdin, Stdout and Stderr are all bound; a nil Stdin reads from the null device
+//   - Env becomes the process environment; a nil Env inherits the shell's own
+//   - Dir becomes the working directory; an empty Dir inherits the shell process's
+//   - ExtraFiles are passed on as descriptors 3 and up, for process substitutions
 //   - Streams are connected directly to the process
 //   - No buffering is added by the executor
 //
@@ -224,8 +261,10 @@ type DefaultExecutor struct {
 //   - io:   I/O stream bindings
 //
 // Returns:
-//   - int:   Exit code (-1 if not found or error, 0-255 for normal exit)
-//   - error: ErrNotFound if executable not in PATH, nil otherwise
+//   - int:   Exit status (-1 if not found, 126 or 127 if it cannot be
+//     started, 128+N if killed by signal N, the exit code otherwise)
+//   - error: ErrNotFound if executable not in PATH, the reason it could not
+//     be started, nil otherwise
 //
 // Examples:
 //
@@ -276,17 +315,40 @@ func (e *DefaultExecutor) Execute(ctx context.Context, name string, args []strin
 
 	externalCmd := exec.CommandContext(ctx, path, args...)
 	externalCmd.Args = append([]string{name}, args...)
+	externalCmd.Env = io.Env
+	externalCmd.Dir = io.Dir
+	externalCmd.Stdin = io.Stdin
 	externalCmd.Stdout = io.Stdout
 	externalCmd.Stderr = io.Stderr
+	externalCmd.ExtraFiles = io.ExtraFiles
 
-	if err := externalCmd.Run(); err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return exitErr.ExitCode(), nil
+	err := externalCmd.Run()
+
+	// the process never started
+	if externalCmd.Process == nil {
+		var pathErr *os.PathError
+
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+
+		if errors.Is(err, fs.ErrNotExist) {
+			return 127, err
 		}
 
-		return -1, nil
+		return 126, err
 	}
 
-	return 0, nil
+	return exitStatus(externalCmd.ProcessState), nil
+
+}
+
+// exitStatus returns the shell status of a finished process: its exit code,
+// or 128 plus the signal number when a signal killed it.
+func exitStatus(state *os.ProcessState) int {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
 
+	return state.ExitCode()
 }
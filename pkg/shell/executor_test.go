@@ -0,0 +1,58 @@
+package shell
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDefaultExecutor_Status(t *testing.T) {
+
+	dir := t.TempDir()
+
+	// executable, but neither a binary nor a script with a #! line
+	if err := os.WriteFile(filepath.Join(dir, "garbage"), []byte("not a program\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		script         string
+		expectedStatus int
+		expectedErr    string
+	}{
+		{name: "exit code", script: "sh -c 'exit 3'", expectedStatus: 3},
+		{name: "killed by a signal", script: "sh -c 'kill -9 $$'", expectedStatus: 137},
+		{name: "terminated by a signal", script: "sh -c 'kill -TERM $$'", expectedStatus: 143},
+		{name: "exec format error", script: "PATH=" + dir + ":$PATH; garbage", expectedStatus: 126, expectedErr: "garbage: exec format error\n"},
+		{name: "argument containing NUL", script: "cat $'a\\0b'", expectedStatus: 126, expectedErr: "cat: invalid argument\n"},
+		{name: "not found", script: "nosuchcommand", expectedStatus: 127, expectedErr: "nosuchcommand: command not found\n"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			var stderr bytes.Buffer
+			sh := New(strings.NewReader(""), io.Discard, &stderr)
+
+			if err := sh.evaluate(tt.script); err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+
+			if sh.lastStatus != tt.expectedStatus {
+				t.Errorf("expected status %d got %d", tt.expectedStatus, sh.lastStatus)
+			}
+
+			if got := stderr.String(); got != tt.expectedErr {
+				t.Errorf("expected error output %q got %q", tt.expectedErr, got)
+			}
+
+		})
+
+	}
+
+}
@@ -0,0 +1,654 @@
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/user"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrBadSubstitution is returned when a parameter expansion cannot be
+// interpreted, such as ${} or a name containing invalid characters.
+//
+// Example input that triggers this error:
+//
+//	$ echo ${not a name}
+//	${not a name}: bad substitution
+var ErrBadSubstitution = errors.New("bad substitution")
+
+// ErrParameterUnset is returned by ${var:?} and ${var?} when the variable
+// is unset (or, for the ":" form, empty) and no message was given.
+var ErrParameterUnset = errors.New("parameter null or not set")
+
+// ErrCannotAssign is returned by ${1:=word} and similar, which try to assign
+// a default to a parameter that is not a variable.
+var ErrCannotAssign = errors.New("cannot assign in this way")
+
+// ExpansionError reports an expansion that failed while a command line was
+// being parsed.
+//
+// Expansion errors are command failures rather than fatal parse errors: the
+// shell prints the error, skips the command and sets its status to 1.
+// ExpansionError wraps a sentinel (ErrBadSubstitution, ErrParameterUnset, or
+// a custom message from ${var:?message}) so errors.Is keeps working.
+//
+// Example:
+//
+//	$ echo ${TARGET:?no target given}
+//	TARGET: no target given
+type ExpansionError struct {
+	Param string // Parameter or expansion text the error refers to
+	Err   error  // Underlying cause
+}
+
+// Error formats the error as "param: cause", matching other shells.
+func (e *ExpansionError) Error() string {
+	return e.Param + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying cause for use with errors.Is.
+func (e *ExpansionError) Unwrap() error {
+	return e.Err
+}
+
+// shellExpander adapts a Shell to the Expander interface so DefaultParser
+// can resolve expansions against the shell's variable table.
+//
+// Words nested inside an expansion (the default in ${var:-word}, patterns
+// and replacements) are expanded with the same parser, so they may contain
+// quotes and further expansions. Quoted characters in patterns match
+// literally, so ${file%'.*'} only removes a literal ".*".
+type shellExpander struct {
+	shell  *Shell
+	parser *DefaultParser
+}
+
+// paramOperators lists the operators that may follow the name in ${name...},
+// longest first so that "##" is not mistaken for "#".
+var paramOperators = []string{
+	":-", ":=", ":?", ":+",
+	"-", "=", "?", "+",
+	"##", "#", "%%", "%",
+	"//", "/#", "/%", "/",
+}
+
+// ExpandParameter resolves the body of a $name or ${...} expansion.
+//
+// Supported forms:
+//   - name          : Value of the variable (empty if unset)
+//   - #name         : Length of the value in characters
+//   - name:-word    : word if name is unset or empty, else its value
+//   - name:=word    : Like :- but also assigns word to name
+//   - name:?msg     : Error with msg if name is unset or empty
+//   - name:+word    : word if name is set and non-empty, else empty
+//   - name#pat      : Remove the shortest prefix matching pat
+//   - name##pat     : Remove the longest prefix matching pat
+//   - name%pat      : Remove the shortest suffix matching pat
+//   - name%%pat     : Remove the longest suffix matching pat
+//   - name/pat/rep  : Replace the first match of pat with rep
+//   - name//pat/rep : Replace every match
+//   - name/#pat/rep : Replace a match at the start
+//   - name/%pat/rep : Replace a match at the end
+//
+// The name may also be a positional parameter (1, 2, ... or 10 inside
+// braces) or one of the special parameters #, @, *, ?, $, ! and 0 (see
+// getParam); those cannot be assigned with :=.
+//
+// Arrays add the forms:
+//   - name[sub]       : The element at index or key sub; the operators above
+//     apply to it, as in ${arr[1]:-none}
+//   - name[@]         : Every element, joined by spaces (see ExpandList for
+//     "${name[@]}", which is one word per element)
+//   - name[*]         : Every element, joined by the first character of IFS
+//   - !name[@]        : The indices or keys
+//   - #name[@]        : The number of elements
+//   - name[@]:off:len : A slice of the elements
+//
+// A name without a subscript is element 0 of an array.
+//
+// The -, =, ? and + operators without a colon only test whether the variable
+// is set, so an empty value counts as set.
+//
+// Parameters:
+//   - expr: The name or the text between the braces of ${...}
+//
+// Returns:
+//   - string: The expanded value
+//   - error: *ExpansionError for bad substitutions and ${var:?} failures
+//
+// Examples (with path=/usr/local/bin/go):
+//
+//	${path##*/}        → "go"
+//	${path%/*}         → "/usr/local/bin"
+//	${path//\//:}      → ":usr:local:bin:go"
+//	${missing:-none}   → "none"
+//	${#path}           → "17"
+//	${#arr[@]}         → "3" (with arr=(a b c))
+func (e shellExpander) ExpandParameter(expr string) (string, error) {
+
+	// ${#arr[@]} and ${#@} count the values
+	if list, ok := parseListExpansion(strings.TrimPrefix(expr, "#")); ok && len(expr) > 1 && expr[0] == '#' && !list.keys && !list.hasSlice {
+		values, err := e.ExpandList(expr[1:])
+		return strconv.Itoa(len(values)), err
+	}
+
+	// ${#name} is the length of the value
+	if len(expr) > 1 && expr[0] == '#' && paramRefLength(expr[1:]) == len(expr)-1 {
+		value, _, err := e.lookup(expr[1:])
+		return strconv.Itoa(utf8.RuneCountInString(value)), err
+	}
+
+	// outside "${arr[@]}", the values of a list are joined into one
+	if list, ok := parseListExpansion(expr); ok {
+		values, err := e.ExpandList(expr)
+		return strings.Join(values, list.joinSeparator(e.FieldSeparators())), err
+	}
+
+	nameEnd := paramRefLength(expr)
+	name, rest := expr[:nameEnd], expr[nameEnd:]
+
+	if name == "" {
+		return "", &ExpansionError{Param: "${" + expr + "}", Err: ErrBadSubstitution}
+	}
+
+	value, isSet, err := e.lookup(name)
+
+	if err != nil {
+		return "", err
+	}
+
+	if rest == "" {
+		return value, nil
+	}
+
+	op := matchOperator(rest, paramOperators)
+
+	if op == "" {
+		return "", &ExpansionError{Param: "${" + expr + "}", Err: ErrBadSubstitution}
+	}
+
+	word := rest[len(op):]
+
+	// with a colon, an empty value is treated like an unset one
+	isNull := !isSet
+	if strings.HasPrefix(op, ":") {
+		isNull = !isSet || value == ""
+	}
+
+	switch strings.TrimPrefix(op, ":") {
+	case "-":
+		if isNull {
+			return e.parser.ExpandWord(word)
+		}
+		return value, nil
+
+	case "=":
+		base, subscript, hasSubscript := splitSubscript(name)
+
+		if isNull && (!isValidName(base) || subscript == "@" || subscript == "*") {
+			return "", &ExpansionError{Param: "$" + name, Err: ErrCannotAssign}
+		}
+
+		if isNull {
+			expanded, err := e.parser.ExpandWord(word)
+			if err != nil {
+				return "", err
+			}
+
+			if !hasSubscript {
+				e.shell.setVar(name, expanded)
+				return expanded, nil
+			}
+
+			key, err := e.elementKey(base, subscript)
+			if err != nil {
+				return "", err
+			}
+
+			e.shell.setElement(base, key, expanded)
+			return expanded, nil
+		}
+		return value, nil
+
+	case "?":
+		if isNull {
+			if word == "" {
+				return "", &ExpansionError{Param: name, Err: ErrParameterUnset}
+			}
+
+			message, err := e.parser.ExpandWord(word)
+			if err != nil {
+				return "", err
+			}
+			return "", &ExpansionError{Param: name, Err: errors.New(message)}
+		}
+		return value, nil
+
+	case "+":
+		if isNull {
+			return "", nil
+		}
+		return e.parser.ExpandWord(word)
+
+	case "#", "##":
+		pattern, err := e.parser.ExpandPattern(word)
+		if err != nil {
+			return "", err
+		}
+		return stripPrefix(value, pattern, op == "##"), nil
+
+	case "%", "%%":
+		pattern, err := e.parser.ExpandPattern(word)
+		if err != nil {
+			return "", err
+		}
+		return stripSuffix(value, pattern, op == "%%"), nil
+	}
+
+	// substitution: ${name/pattern/replacement}
+	rawPattern, rawReplacement := splitSubstitution(word)
+
+	pattern, err := e.parser.ExpandPattern(rawPattern)
+	if err != nil {
+		return "", err
+	}
+
+	replacement, err := e.parser.ExpandWord(rawReplacement)
+	if err != nil {
+		return "", err
+	}
+
+	return replacePattern(value, pattern, replacement, op), nil
+}
+
+// lookup returns the value of a parameter reference, the name part of a
+// ${...} expansion, and whether it is set.
+//
+// A reference is a parameter name (see getParam) or an array element,
+// NAME[subscript]. The subscript is expanded like a word and then resolved
+// by elementKey; the subscripts @ and * stand for all the values, joined
+// as for "$@" and "$*".
+func (e shellExpander) lookup(ref string) (string, bool, error) {
+	name, subscript, hasSubscript := splitSubscript(ref)
+
+	if !hasSubscript || !isValidName(name) {
+		value, isSet := e.shell.getParam(ref)
+		return value, isSet, nil
+	}
+
+	if subscript == "@" || subscript == "*" {
+		list, _ := parseListExpansion(ref)
+		values, err := e.ExpandList(ref)
+		return strings.Join(values, list.joinSeparator(e.FieldSeparators())), len(values) > 0, err
+	}
+
+	key, err := e.elementKey(name, subscript)
+
+	if err != nil {
+		return "", false, err
+	}
+
+	value, isSet := e.shell.getElement(name, key)
+	return value, isSet, nil
+}
+
+// elementKey expands the subscript of an array reference and resolves it
+// into the key of the element (see Shell.elementKey).
+func (e shellExpander) elementKey(name, subscript string) (string, error) {
+	expanded, err := e.parser.ExpandWord(subscript)
+
+	if err != nil {
+		return "", err
+	}
+
+	return e.shell.elementKey(name, expanded)
+}
+
+// ExpandCommand runs a command substitution and returns its output.
+//
+// The command is executed as a command list by a subshell whose Out is a
+// buffer, so builtins, external commands and pipelines all go
+// through the usual dispatch with their stdout bound to that buffer through
+// IOBindings. Stderr is not captured. Assignments and cd inside the
+// substitution do not affect the shell, and an exit only ends the
+// substitution. Here-documents in the command take their bodies from its
+// following lines (see embedHereDocuments). Trailing newlines are removed
+// from the output. The substitution's exit status is kept in
+// shell.substitutionStatus, which gives the status of a command made only
+// of assignments.
+//
+// Parameters:
+//   - command: The command text from $(...) or `...`
+//
+// Returns:
+//   - string: The captured output without trailing newlines
+//   - error: Syntax errors from the command
+//
+// Example:
+//
+//	$ echo "today is $(date +%A)"
+//	today is Friday
+func (e shellExpander) ExpandCommand(command string) (string, error) {
+	var output bytes.Buffer
+
+	substitution := e.shell.subshell()
+	substitution.Out = &output
+
+	command, err := substitution.embedHereDocuments(command)
+
+	if err != nil {
+		return "", err
+	}
+
+	err = substitution.evaluate(command)
+
+	if substitution.globFailure(err) {
+		substitution.lastStatus = 1
+	} else if err != nil && !isControlFlow(err) {
+		return "", err
+	}
+
+	e.shell.substitutionStatus = substitution.lastStatus
+
+	return strings.TrimRight(output.String(), "\n"), nil
+}
+
+// ExpandList returns the values of a list expansion: the positional
+// parameters of the running function or script for $@ and $*, the elements
+// of an array for ${arr[@]} and ${arr[*]}, or its indices or keys for
+// ${!arr[@]}. An unset array has no values.
+//
+// A slice, ${arr[@]:offset:length}, takes length values (or all the rest)
+// starting at the element with the first index at or after offset; for
+// associative arrays offset counts elements instead. Both are arithmetic
+// expressions, and a negative offset counts back from the end. Slices of
+// $@ start at $0, so ${@:1} is every parameter.
+//
+// Parameters:
+//   - expr: The text of the expansion, one of the list forms (see
+//     listExpansion)
+//
+// Returns:
+//   - []string: The values in order
+//   - error: *ExpansionError for invalid offsets and lengths
+//
+// Example:
+//
+//	$ arr=(a b c d)
+//	$ printf '[%s]' "${arr[@]:1:2}"
+//	[b][c]
+func (e shellExpander) ExpandList(expr string) ([]string, error) {
+	list, _ := parseListExpansion(expr)
+
+	var keys, values []string
+	isIndexed := true
+
+	if list.name == "@" {
+		values = e.shell.params
+
+		for i := range values {
+			keys = append(keys, strconv.Itoa(i+1))
+		}
+
+		// slices of $@ count $0 as the parameter before $1
+		if list.hasSlice {
+			keys = append([]string{"0"}, keys...)
+			values = append([]string{e.shell.name}, values...)
+		}
+	} else if v, ok := e.shell.vars[list.name]; ok {
+		keys, values, isIndexed = v.keys(), v.values(), v.kind != assocVar
+	}
+
+	if list.keys {
+		return keys, nil
+	}
+
+	if !list.hasSlice {
+		return values, nil
+	}
+
+	return e.sliceList(list.slice, keys, values, isIndexed)
+}
+
+// sliceList selects the values of ${arr[@]:offset:length} (see ExpandList).
+//
+// Parameters:
+//   - slice: The "offset[:length]" text, expanded and evaluated here
+//   - keys: The indices of the values, or associative keys
+//   - values: The values, in order
+//   - isIndexed: Whether offset refers to indices rather than positions
+func (e shellExpander) sliceList(slice string, keys, values []string, isIndexed bool) ([]string, error) {
+	offsetText, lengthText, hasLength := strings.Cut(slice, ":")
+
+	offset, err := e.ExpandArithmetic(offsetText)
+	if err != nil {
+		return nil, err
+	}
+
+	start, _ := strconv.Atoi(offset)
+
+	if isIndexed {
+		last := -1
+		if len(keys) > 0 {
+			last, _ = strconv.Atoi(keys[len(keys)-1])
+		}
+
+		if start < 0 {
+			start += last + 1
+		}
+
+		// the position of the first element at or after the index
+		index := start
+		start = len(keys)
+		for i, key := range keys {
+			if n, _ := strconv.Atoi(key); n >= index {
+				start = i
+				break
+			}
+		}
+	} else if start < 0 {
+		start += len(values)
+	}
+
+	if start < 0 || start > len(values) {
+		return []string{}, nil
+	}
+
+	values = values[start:]
+
+	if !hasLength {
+		return values, nil
+	}
+
+	length, err := e.ExpandArithmetic(lengthText)
+	if err != nil {
+		return nil, err
+	}
+
+	n, _ := strconv.Atoi(length)
+
+	if n < 0 {
+		return nil, &ExpansionError{Param: strings.TrimSpace(lengthText), Err: ErrNegativeLength}
+	}
+
+	return values[:min(n, len(values))], nil
+}
+
+// FieldSeparators returns the value of IFS, which splits the results of
+// unquoted expansions into fields, or space, tab and newline when IFS is
+// unset. IFS is not inherited from the environment, so a script always
+// starts with the default.
+//
+// Example:
+//
+//	$ IFS=:; for dir in $PATH; do echo $dir; done
+//	/usr/local/bin
+//	/usr/bin
+func (e shellExpander) FieldSeparators() string {
+	if ifs, ok := e.shell.getVar("IFS"); ok {
+		return ifs
+	}
+
+	return " \t\n"
+}
+
+// ExpandArithmetic evaluates the body of a $((...)) expansion.
+//
+// The expression first undergoes parameter expansion, command substitution
+// and quote removal, so $x, ${x:-1} and $(cmd) may appear inside it; bare
+// variable names are then resolved by the evaluator itself.
+//
+// Parameters:
+//   - expr: The text between $(( and ))
+//
+// Returns:
+//   - string: The decimal result
+//   - error: *ExpansionError wrapping ErrDivisionByZero or
+//     ErrArithmeticSyntax when evaluation fails, or ErrBadSubscript for an
+//     array element that cannot exist
+//
+// Example:
+//
+//	$ n=7; echo $(( n * 6 ))
+//	42
+func (e shellExpander) ExpandArithmetic(expr string) (string, error) {
+	expanded, err := e.parser.ExpandWord(expr)
+
+	if err != nil {
+		return "", err
+	}
+
+	value, err := evalArithmetic(expanded, e.shell)
+
+	// bad array subscripts already name the element
+	var expansionErr *ExpansionError
+	if errors.As(err, &expansionErr) {
+		return "", err
+	}
+
+	if err != nil {
+		return "", &ExpansionError{Param: strings.TrimSpace(expanded), Err: err}
+	}
+
+	return strconv.FormatInt(value, 10), nil
+}
+
+// ExpandGlob performs filename expansion on a word containing unquoted
+// pattern characters.
+//
+// Matches are returned in sorted order. When nothing matches, the result
+// depends on the shell options set with shopt:
+//   - default:  The word itself, with quoting removed
+//   - nullglob: No words at all
+//   - failglob: An *ExpansionError wrapping ErrNoMatch
+//
+// Parameters:
+//   - pattern: The word in pattern form, as produced by the parser
+//
+// Returns:
+//   - []string: The words that replace the pattern
+//   - error: *ExpansionError when failglob is set and nothing matches
+//
+// Example:
+//
+//	$ echo *.go
+//	main.go shell.go
+//	$ echo *.xyz
+//	*.xyz
+func (e shellExpander) ExpandGlob(pattern string) ([]string, error) {
+	if matches := globPaths(e.shell.dir, pattern); matches != nil {
+		return matches, nil
+	}
+
+	if e.shell.options["failglob"] {
+		return nil, &ExpansionError{Param: unescapePattern(pattern), Err: ErrNoMatch}
+	}
+
+	if e.shell.options["nullglob"] {
+		return []string{}, nil
+	}
+
+	return []string{unescapePattern(pattern)}, nil
+}
+
+// ExpandTilde resolves the prefix of a tilde expansion.
+//
+// Supported prefixes:
+//   - ""   : $HOME, or the current user's home from the passwd database
+//     when HOME is unset
+//   - "+"  : $PWD, the current directory
+//   - "-"  : $OLDPWD, the previous directory
+//   - user : The home directory of user from the passwd database
+//
+// Parameters:
+//   - prefix: The text between "~" and the first "/"
+//
+// Returns:
+//   - string: The directory
+//   - bool: false for unknown users and unset PWD/OLDPWD, which leaves the
+//     tilde prefix literal
+//
+// Example:
+//
+//	$ echo ~root ~/src
+//	/root /home/user/src
+func (e shellExpander) ExpandTilde(prefix string) (string, bool) {
+	switch prefix {
+	case "":
+		if home, ok := e.shell.getVar("HOME"); ok {
+			return home, true
+		}
+
+		current, err := user.Current()
+		if err != nil {
+			return "", false
+		}
+
+		return current.HomeDir, true
+
+	case "+":
+		return e.shell.getVar("PWD")
+
+	case "-":
+		return e.shell.getVar("OLDPWD")
+	}
+
+	account, err := user.Lookup(prefix)
+	if err != nil {
+		return "", false
+	}
+
+	return account.HomeDir, true
+}
+
+// splitSubstitution splits the "pattern/replacement" part of ${name/...} at
+// the first "/" that is not escaped or quoted. Without such a "/", the
+// whole word is the pattern and the replacement is empty.
+func splitSubstitution(word string) (string, string) {
+	segments, _ := splitOnOperators(word, []string{"/"})
+
+	if len(segments) == 1 {
+		return word, ""
+	}
+
+	pattern := segments[0]
+	return pattern, word[len(pattern)+1:]
+}
+
+// expansionFailure reports whether err is an expansion error that should
+// fail the current command instead of terminating the shell, and prints it.
+// A failed match under failglob is not one: it aborts the rest of the
+// command list instead (see globFailure).
+func (shell *Shell) expansionFailure(err error) bool {
+	var expansionErr *ExpansionError
+
+	if !errors.As(err, &expansionErr) || errors.Is(err, ErrNoMatch) {
+		return false
+	}
+
+	fmt.Fprintln(shell.Err, expansionErr)
+	return true
+}
@@ -0,0 +1,117 @@
+package shell
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExpandParameter(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		script         string
+		expected       string
+		expectedStatus int
+	}{
+		// value and length
+		{name: "plain value", script: "x=abc; echo ${x}", expected: "abc\n"},
+		{name: "length", script: "x=héllo; echo ${#x}", expected: "5\n"},
+		{name: "length of unset", script: "echo ${#missing}", expected: "0\n"},
+
+		// defaults
+		{name: "default for unset", script: "echo ${missing:-none}", expected: "none\n"},
+		{name: "default for empty", script: "x=; echo ${x:-none}", expected: "none\n"},
+		{name: "no default for set", script: "x=abc; echo ${x:-none}", expected: "abc\n"},
+		{name: "dash without colon keeps empty", script: "x=; echo \"[${x-none}]\"", expected: "[]\n"},
+		{name: "dash without colon for unset", script: "echo ${missing-none}", expected: "none\n"},
+		{name: "default is expanded", script: "y=other; echo ${missing:-$y}", expected: "other\n"},
+
+		// assignments
+		{name: "assign when unset", script: "echo ${x:=set}; echo $x", expected: "set\nset\n"},
+		{name: "assign when empty", script: "x=; echo ${x:=set}; echo $x", expected: "set\nset\n"},
+		{name: "no assign when set", script: "x=abc; echo ${x:=set}; echo $x", expected: "abc\nabc\n"},
+		{name: "equals without colon keeps empty", script: "x=; echo \"[${x=set}]\"; echo \"[$x]\"", expected: "[]\n[]\n"},
+		{name: "assign an array element", script: "arr=(a); : ${arr[2]:=c}; echo ${arr[@]}", expected: "a c\n"},
+		{name: "cannot assign a positional", script: "set --; echo ${1:=x}; echo after", expected: "after\n"},
+
+		// errors
+		{name: "error when unset", script: "echo ${missing:?oops}", expected: "", expectedStatus: 1},
+		{name: "error when empty", script: "x=; echo ${x:?oops}", expected: "", expectedStatus: 1},
+		{name: "no error when set", script: "x=abc; echo ${x:?oops}", expected: "abc\n"},
+		{name: "question without colon allows empty", script: "x=; echo \"[${x?oops}]\"", expected: "[]\n"},
+		{name: "error fails only its command", script: "echo ${missing:?oops}; echo $?", expected: "1\n"},
+
+		// alternatives
+		{name: "alternative when set", script: "x=abc; echo ${x:+yes}", expected: "yes\n"},
+		{name: "no alternative when empty", script: "x=; echo \"[${x:+yes}]\"", expected: "[]\n"},
+		{name: "no alternative when unset", script: "echo \"[${missing:+yes}]\"", expected: "[]\n"},
+		{name: "plus without colon for empty", script: "x=; echo ${x+yes}", expected: "yes\n"},
+
+		// prefix and suffix removal
+		{name: "shortest prefix", script: "p=/usr/local/bin; echo ${p#*/}", expected: "usr/local/bin\n"},
+		{name: "longest prefix", script: "p=/usr/local/bin; echo ${p##*/}", expected: "bin\n"},
+		{name: "shortest suffix", script: "f=a.tar.gz; echo ${f%.*}", expected: "a.tar\n"},
+		{name: "longest suffix", script: "f=a.tar.gz; echo ${f%%.*}", expected: "a\n"},
+		{name: "no match leaves the value", script: "f=abc; echo ${f#x} ${f%x}", expected: "abc abc\n"},
+		{name: "quoted pattern is literal", script: "f='a.*b.*'; echo ${f%'.*'}", expected: "a.*b\n"},
+		{name: "pattern from a variable", script: "f=a.txt; ext=.txt; echo ${f%$ext}", expected: "a\n"},
+
+		// substitution
+		{name: "replace first", script: "x=aXbXc; echo ${x/X/-}", expected: "a-bXc\n"},
+		{name: "replace every", script: "x=aXbXc; echo ${x//X/-}", expected: "a-b-c\n"},
+		{name: "replace at the start", script: "x=abab; echo ${x/#ab/-} ${x/#b/-}", expected: "-ab abab\n"},
+		{name: "replace at the end", script: "x=abab; echo ${x/%ab/-} ${x/%a/-}", expected: "ab- abab\n"},
+		{name: "replace with a pattern", script: "x=hello.go; echo ${x/*./main.}", expected: "main.go\n"},
+		{name: "delete without replacement", script: "x=a-b-c; echo ${x//-}", expected: "abc\n"},
+		{name: "escaped slash in the pattern", script: "p=/usr/bin; echo ${p//\\//:}", expected: ":usr:bin\n"},
+		{name: "replacement is expanded", script: "x=ab; y=Z; echo ${x/b/$y}", expected: "aZ\n"},
+
+		// failures
+		{name: "bad substitution", script: "x=abc; echo ${x^}; echo after", expected: "after\n"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, status := runScript(t, tt.script)
+
+			if got != tt.expected {
+				t.Errorf("script: %q\nexpected: %q\ngot:      %q", tt.script, tt.expected, got)
+			}
+
+			if status != tt.expectedStatus {
+				t.Errorf("script: %q\nexpected status %d got %d", tt.script, tt.expectedStatus, status)
+			}
+
+		})
+
+	}
+
+}
+
+func TestRun_ParameterError(t *testing.T) {
+
+	var stdout, stderr bytes.Buffer
+	sh := New(strings.NewReader("echo ${missing:?is required}\necho status $?\necho ${x:?}\n"), &stdout, &stderr)
+	sh.SetScript("build.sh", nil)
+
+	if err := sh.Run(); err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+
+	// the failing command prints nothing and the script keeps running
+	if got, expected := stdout.String(), "status 1\n"; got != expected {
+		t.Errorf("expected %q got %q", expected, got)
+	}
+
+	if got, expected := stderr.String(), "missing: is required\nx: parameter null or not set\n"; got != expected {
+		t.Errorf("expected errors %q got %q", expected, got)
+	}
+
+	if got := sh.ExitStatus(); got != 1 {
+		t.Errorf("expected exit status 1 got %d", got)
+	}
+
+}
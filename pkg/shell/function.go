@@ -0,0 +1,143 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// callFrame holds the state of one running function call that is restored
+// when the call returns.
+type callFrame struct {
+	saved map[string]*shellVariable // Values that local variables shadowed, nil when unset
+}
+
+// returnControl is returned by the return builtin to leave the running
+// function with the given status. Like a break it travels up through the
+// commands of the function body until callFunction handles it.
+type returnControl struct {
+	status int
+}
+
+// Error describes the return as the builtin that produced it.
+func (c *returnControl) Error() string {
+	return fmt.Sprintf("return %d", c.status)
+}
+
+// callFunction runs a shell function with the given arguments.
+//
+// The arguments become the positional parameters $1, $2, ... (and $#, $@)
+// for the duration of the call, and the caller's are restored afterwards.
+// Variables declared with local inside the function get their previous
+// values back when it returns; every other assignment is global. Loops
+// around the call are not visible inside it, so break and continue only
+// apply to loops in the function body.
+//
+// Parameters:
+//   - function: The function definition
+//   - args: The arguments of the call, without the function name
+//   - ioBindings: I/O streams of the call, with its redirections applied
+//
+// Returns:
+//   - int: The status given to return, or else that of the last command
+//     of the body
+//   - error: ErrExit when the exit builtin runs, or errors from command
+//     substitutions that cannot be parsed
+//
+// Example:
+//
+//	$ greet() { local name=$1; echo "hello $name"; }
+//	$ greet world
+//	hello world
+func (shell *Shell) callFunction(function *FunctionDefinition, args []string, ioBindings IOBindings) (int, error) {
+
+	prevParams, prevDepth := shell.params, shell.loopDepth
+	frame := &callFrame{saved: map[string]*shellVariable{}}
+
+	shell.params, shell.loopDepth = args, 0
+	shell.frames = append(shell.frames, frame)
+
+	defer func() {
+		shell.frames = shell.frames[:len(shell.frames)-1]
+		shell.params, shell.loopDepth = prevParams, prevDepth
+		shell.restoreLocals(frame)
+	}()
+
+	status, err := shell.runCommand(function.Body, ioBindings)
+
+	var ret *returnControl
+
+	if errors.As(err, &ret) {
+		return ret.status, nil
+	}
+
+	return status, err
+}
+
+// declareLocal makes a variable local to the running function, saving its
+// current value to be restored when the function returns.
+func (shell *Shell) declareLocal(name string) {
+	frame := shell.frames[len(shell.frames)-1]
+
+	if _, ok := frame.saved[name]; ok {
+		return
+	}
+
+	// copy, as setVar updates the variable in place
+	var saved *shellVariable
+
+	if v, ok := shell.vars[name]; ok {
+		saved = v.clone()
+	}
+
+	frame.saved[name] = saved
+	shell.unsetVar(name)
+}
+
+// restoreLocals gives the variables declared local in frame their values
+// from before the call.
+func (shell *Shell) restoreLocals(frame *callFrame) {
+	for name, saved := range frame.saved {
+		shell.unsetVar(name)
+
+		if saved != nil {
+			shell.vars[name] = saved.clone()
+		}
+	}
+}
+
+// localBuiltin implements local, which declares variables local to the
+// running function, optionally assigning them. It takes the options of
+// declare: local [-aAx] name[=value]...
+func localBuiltin(args []string, shell *Shell) (int, error) {
+
+	if len(shell.frames) == 0 {
+		fmt.Fprintln(shell.Err, "local: can only be used in a function")
+		return 1, nil
+	}
+
+	return declareVariables("local", args, shell, true)
+}
+
+// returnBuiltin implements return, which leaves the running function with
+// the given status, or that of the last command: return [N]
+func returnBuiltin(args []string, shell *Shell) (int, error) {
+
+	if len(shell.frames) == 0 {
+		fmt.Fprintln(shell.Err, "return: can only `return' from a function")
+		return 1, nil
+	}
+
+	if len(args) == 0 {
+		return shell.lastStatus, &returnControl{status: shell.lastStatus}
+	}
+
+	code, err := strconv.Atoi(args[0])
+
+	if err != nil {
+		fmt.Fprintf(shell.Err, "return: %s: numeric argument required\n", args[0])
+		return 2, &returnControl{status: 2}
+	}
+
+	return code & 0xff, &returnControl{status: code & 0xff}
+}
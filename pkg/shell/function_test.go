@@ -0,0 +1,62 @@
+package shell
+
+import (
+	"testing"
+)
+
+func TestCallFunction(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		script         string
+		expected       string
+		expectedStatus int
+	}{
+		{name: "call", script: "greet() { echo hello; }; greet; greet", expected: "hello\nhello\n"},
+		{name: "function keyword", script: "function greet { echo hello; }; greet", expected: "hello\n"},
+		{name: "positional parameters", script: "f() { echo $1-$2-$3; }; f a 'b c'", expected: "a-b c-\n"},
+		{name: "parameter count and list", script: "f() { echo $# \"$@\" $*; }; f a b c", expected: "3 a b c a b c\n"},
+		{name: "braced parameters", script: "f() { echo ${1:-none} ${2:-none} ${#1}; }; f abc", expected: "abc none 3\n"},
+		{name: "tenth parameter", script: "f() { echo ${10} $10; }; f 1 2 3 4 5 6 7 8 9 ten", expected: "ten 10\n"},
+		{name: "parameters outside functions", script: "echo \"[$1][$#][$@]\"", expected: "[][0][]\n"},
+		{name: "parameters restored after a call", script: "inner() { echo $1; }; outer() { inner x; echo $1; }; outer y", expected: "x\ny\n"},
+		{name: "global assignment", script: "f() { v=inside; }; v=outside; f; echo $v", expected: "inside\n"},
+		{name: "local variable", script: "f() { local v=inside; echo $v; }; v=outside; f; echo $v", expected: "inside\noutside\n"},
+		{name: "local without a value", script: "f() { local v; echo \"[$v]\"; v=set; }; v=outside; f; echo $v", expected: "[]\noutside\n"},
+		{name: "local of an unset variable", script: "f() { local v=1; }; f; echo \"[${v-unset}]\"", expected: "[unset]\n"},
+		{name: "dynamic scope", script: "show() { echo $v; }; f() { local v=f; show; }; v=global; f", expected: "f\n"},
+		{name: "return status", script: "f() { return 3; echo never; }; f", expectedStatus: 3},
+		{name: "return without status", script: "f() { ((0)); return; }; f", expectedStatus: 1},
+		{name: "status of the last command", script: "f() { ((0)); }; f", expectedStatus: 1},
+		{name: "return from a loop", script: "f() { for x in a b c; do echo $x; [ $x = b ] && return 4; done; }; f", expected: "a\nb\n", expectedStatus: 4},
+		{name: "recursion", script: "count() { ((${1} > 0)) || return; echo $1; count $(($1 - 1)); }; count 3", expected: "3\n2\n1\n", expectedStatus: 1},
+		{name: "redefinition", script: "f() { echo one; }; f() { echo two; }; f", expected: "two\n"},
+		{name: "functions before PATH", script: "cat() { echo mine; }; cat /nonexistent", expected: "mine\n"},
+		{name: "builtins before functions", script: "echo() { exit 9; }; echo builtin", expected: "builtin\n"},
+		{name: "redirected call", script: "f() { echo a; echo b; }; f | sort -r", expected: "b\na\n"},
+		{name: "exit inside a function", script: "f() { exit 5; }; f; echo after", expectedStatus: 5},
+		{name: "break does not leave the caller's loop", script: "f() { break; }; for x in a b; do f 2>/dev/null; echo $x; done", expected: "a\nb\n"},
+		{name: "local outside a function", script: "local v=1; echo ${v-unset}", expected: "unset\n"},
+		{name: "return outside a function", script: "return 3; echo after", expected: "after\n"},
+		{name: "type of a function", script: "f() { echo hi; }; type f", expected: "f is a function\nf () \n{ echo hi; }\n"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, status := runScript(t, tt.script)
+
+			if got != tt.expected {
+				t.Errorf("script: %q\nexpected: %q\ngot:      %q", tt.script, tt.expected, got)
+			}
+
+			if status != tt.expectedStatus {
+				t.Errorf("expected status %d got %d", tt.expectedStatus, status)
+			}
+
+		})
+
+	}
+
+}
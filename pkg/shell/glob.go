@@ -0,0 +1,197 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ErrNoMatch is returned by filename expansion when a pattern matches no
+// files and the failglob option is set.
+//
+// Example:
+//
+//	$ shopt -s failglob
+//	$ ls *.xyz; echo never
+//	*.xyz: no match
+var ErrNoMatch = errors.New("no match")
+
+// shellOptions lists the options understood by the shopt builtin.
+var shellOptions = []string{"failglob", "nullglob"}
+
+// globFailure reports whether err is a filename expansion that failed under
+// failglob, and prints it.
+//
+// Unlike other expansion errors, which only fail their command, such a
+// failure aborts the whole command list it occurs in. It is passed up as an
+// error until the nearest subshell, command substitution or the top level
+// of Run, which call globFailure and give the aborted list status 1.
+func (shell *Shell) globFailure(err error) bool {
+	if !errors.Is(err, ErrNoMatch) {
+		return false
+	}
+
+	fmt.Fprintln(shell.Err, err)
+	return true
+}
+
+// globPaths returns the sorted paths matching a filename pattern.
+//
+// The pattern is matched one path component at a time: components without
+// pattern characters are taken literally, the others are matched with
+// matchPattern against the entries of the directories found so far. As in
+// other shells, "*" and "?" never match a "/", and a leading "." in a file
+// name must be matched explicitly, so *.go skips .hidden.go while .*.go
+// finds it. A trailing "/" restricts the matches to directories.
+//
+// Relative patterns are matched from dir, and the matches are returned
+// relative to it, as they were written.
+//
+// Parameters:
+//   - dir: The directory relative patterns start from; "" for the
+//     process's working directory
+//   - pattern: The pattern, with literal characters backslash-escaped as
+//     produced by the parser
+//
+// Returns:
+//   - []string: Matching paths in lexical order, or nil if nothing matches
+//
+// Examples (with dir holding main.go, shell.go and docs/):
+//
+//	globPaths(dir, "*.go")    → []string{"main.go", "shell.go"}
+//	globPaths(dir, "*/")      → []string{"docs/"}
+//	globPaths(dir, `\*.go`)   → nil
+func globPaths(dir, pattern string) []string {
+	components := strings.Split(pattern, "/")
+	matches := []string{""}
+
+	if components[0] == "" && len(components) > 1 {
+		matches = []string{"/"}
+		components = components[1:]
+	}
+
+	for i, component := range components {
+		isLast := i == len(components)-1
+
+		// an empty component comes from "//" or a trailing "/"
+		if component == "" {
+			if isLast {
+				matches = filterDirectories(dir, matches)
+			}
+			continue
+		}
+
+		var next []string
+
+		for _, match := range matches {
+			next = append(next, globComponent(dir, match, component)...)
+		}
+
+		if !isLast {
+			for j := range next {
+				next[j] += "/"
+			}
+		}
+
+		matches = next
+	}
+
+	if len(matches) == 0 {
+		return nil
+	}
+
+	sort.Strings(matches)
+	return matches
+}
+
+// globComponent returns the paths dir+name for every name in dir that
+// matches a single path component of a pattern, with dir taken relative to
+// base.
+func globComponent(base, dir, component string) []string {
+	if !hasPatternMeta(component) {
+		path := dir + unescapePattern(component)
+
+		if _, err := os.Lstat(resolvePath(base, path)); err != nil {
+			return nil
+		}
+
+		return []string{path}
+	}
+
+	readDir := dir
+	if readDir == "" {
+		readDir = "."
+	}
+
+	entries, err := os.ReadDir(resolvePath(base, readDir))
+
+	if err != nil {
+		return nil
+	}
+
+	explicitDot := strings.HasPrefix(component, ".") || strings.HasPrefix(component, `\.`)
+
+	var paths []string
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		if strings.HasPrefix(name, ".") && !explicitDot {
+			continue
+		}
+
+		if matchPattern(component, name) {
+			paths = append(paths, dir+name)
+		}
+	}
+
+	return paths
+}
+
+// filterDirectories keeps the paths, relative to base, that name
+// directories (following symbolic links).
+func filterDirectories(base string, paths []string) []string {
+	var dirs []string
+
+	for _, path := range paths {
+		if info, err := os.Stat(resolvePath(base, path)); err == nil && info.IsDir() {
+			dirs = append(dirs, path)
+		}
+	}
+
+	return dirs
+}
+
+// unescapePattern removes the backslash escapes from a pattern, turning it
+// back into the literal word the user typed (after quote removal).
+//
+// Example:
+//
+//	unescapePattern(`\*.go`) → "*.go"
+func unescapePattern(pattern string) string {
+	if !strings.Contains(pattern, `\`) {
+		return pattern
+	}
+
+	var builder strings.Builder
+	escaped := false
+
+	for _, r := range pattern {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+
+		builder.WriteRune(r)
+		escaped = false
+	}
+
+	// a trailing backslash escapes nothing and stays literal
+	if escaped {
+		builder.WriteRune('\\')
+	}
+
+	return builder.String()
+}
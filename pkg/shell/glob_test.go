@@ -0,0 +1,146 @@
+package shell
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGlobPaths(t *testing.T) {
+
+	dir := t.TempDir()
+
+	for _, name := range []string{"main.go", "shell.go", "notes.txt", ".hidden.go", "docs/a.md", "docs/b.md", "src/x/y.go"} {
+		path := filepath.Join(dir, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		pattern  string
+		expected []string
+	}{
+		{name: "star is sorted", pattern: "*.go", expected: []string{"main.go", "shell.go"}},
+		{name: "question mark", pattern: "?ain.go", expected: []string{"main.go"}},
+		{name: "bracket expression", pattern: "[mn]*", expected: []string{"main.go", "notes.txt"}},
+		{name: "hidden files need an explicit dot", pattern: ".*.go", expected: []string{".hidden.go"}},
+		{name: "pattern in a directory", pattern: "docs/*.md", expected: []string{"docs/a.md", "docs/b.md"}},
+		{name: "pattern on a directory component", pattern: "*/x/*.go", expected: []string{"src/x/y.go"}},
+		{name: "trailing slash keeps directories", pattern: "*/", expected: []string{"docs/", "src/"}},
+		{name: "absolute pattern", pattern: dir + "/s*.go", expected: []string{dir + "/shell.go"}},
+		{name: "escaped star is literal", pattern: `\*.go`, expected: nil},
+		{name: "no match", pattern: "*.rs", expected: nil},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			if got := globPaths(dir, tt.pattern); !equalStringSlices(got, tt.expected) {
+				t.Errorf("globPaths(%q) = %v, expected %v", tt.pattern, got, tt.expected)
+			}
+
+		})
+
+	}
+
+}
+
+func TestShopt(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		script         string
+		expected       string
+		expectedStatus int
+	}{
+		{name: "list", script: "shopt -s nullglob; shopt", expected: "failglob\toff\nnullglob\ton\n"},
+		{name: "list set options", script: "shopt -s failglob; shopt -s", expected: "failglob\ton\n"},
+		{name: "query an unset option", script: "shopt nullglob", expected: "nullglob\toff\n", expectedStatus: 1},
+		{name: "query a set option", script: "shopt -s nullglob; shopt nullglob", expected: "nullglob\ton\n"},
+		{name: "query several options", script: "shopt -s failglob; shopt failglob nullglob", expected: "failglob\ton\nnullglob\toff\n", expectedStatus: 1},
+		{name: "invalid option", script: "shopt nosuchoption", expectedStatus: 1},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, status := runScript(t, tt.script)
+
+			if got != tt.expected {
+				t.Errorf("script: %q\nexpected: %q\ngot:      %q", tt.script, tt.expected, got)
+			}
+
+			if status != tt.expectedStatus {
+				t.Errorf("expected status %d got %d", tt.expectedStatus, status)
+			}
+
+		})
+
+	}
+
+}
+
+func TestRun_Failglob(t *testing.T) {
+
+	dir := t.TempDir()
+
+	tests := []struct {
+		name           string
+		input          string
+		expected       string
+		expectedStatus int
+	}{
+		{name: "aborts the rest of the list", input: "echo *.xyz; echo never\necho $?\n", expected: "1\n"},
+		{name: "aborts an enclosing loop", input: "for i in 1 2; do echo $i; echo *.xyz; done; echo never\n", expected: "1\n", expectedStatus: 1},
+		{name: "aborts an enclosing function", input: "f() { echo *.xyz; echo never; }; f || echo never\n", expected: "", expectedStatus: 1},
+		{name: "redirection target", input: "echo a > *.xyz; echo never\n", expected: "", expectedStatus: 1},
+		{name: "subshell ends there", input: "(echo *.xyz; echo never); echo $?\n", expected: "1\n"},
+		{name: "pipeline stage ends there", input: "echo *.xyz | echo next; echo after\n", expected: "next\nafter\n"},
+		{name: "command substitution ends there", input: "x=$(echo in; echo *.xyz; echo never); echo \"[$x]\"\n", expected: "[in]\n"},
+		{name: "matches still run", input: "echo *.txt; echo after\n", expected: "one.txt\nafter\n"},
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "one.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			var stdout, stderr bytes.Buffer
+			sh := New(strings.NewReader("cd "+dir+"; shopt -s failglob\n"+tt.input), &stdout, &stderr)
+			sh.SetScript("failglob.sh", nil)
+
+			if err := sh.Run(); err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+
+			if got := stdout.String(); got != tt.expected {
+				t.Errorf("input: %q\nexpected: %q\ngot:      %q", tt.input, tt.expected, got)
+			}
+
+			if sh.lastStatus != tt.expectedStatus {
+				t.Errorf("expected status %d got %d", tt.expectedStatus, sh.lastStatus)
+			}
+
+			if !strings.Contains(stderr.String(), "*.xyz: no match") && strings.Contains(tt.input, "*.xyz") {
+				t.Errorf("expected a no match error, got %q", stderr.String())
+			}
+
+		})
+
+	}
+
+}
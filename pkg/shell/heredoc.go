@@ -0,0 +1,343 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// hereDocument describes a << or <<- redirection found on a command line.
+type hereDocument struct {
+	start, end int    // Byte range of the operator and delimiter word in the line
+	operator   string // "<<" or "<<-"
+	delimiter  string // Delimiter with quotes removed
+	quoted     bool   // Whether any part of the delimiter was quoted
+}
+
+// readHereDocuments adds a command line to command, reading the bodies of
+// its here-documents from the shell's input and embedding them in the
+// line.
+//
+// Every unquoted << or <<- operator is followed by a delimiter word. The
+// lines after the command, up to a line consisting only of the delimiter,
+// form the body; with several here-documents their bodies follow one
+// another in order. For <<- leading tabs are removed from every body line
+// and from the delimiter line, so scripts can indent them.
+//
+// The operator and delimiter are then replaced by the operator and a single
+// word holding the body, which HereDocumentHandler feeds to the command's
+// stdin:
+//   - Quoted delimiter (<<'EOF', <<"EOF" or <<\EOF): the body is literal
+//     and becomes a single-quoted word
+//   - Unquoted delimiter: the body undergoes parameter expansion, command
+//     substitution and arithmetic expansion when the command runs. It
+//     becomes a double-quoted word, escaped so that " stays literal and
+//     only \$, \`, \\ and \newline are special, as in other shells
+//
+// An empty body is replaced by a redirection from /dev/null, since the
+// parser drops empty words.
+//
+// The body lines are part of the command's source, where errors in the
+// line are reported, but not of its text.
+//
+// Parameters:
+//   - command: The command the line belongs to
+//   - line: The command line just read
+//
+// Returns:
+//   - error: ErrSyntax when an operator has no delimiter, quoting errors
+//     in the delimiter, or I/O errors from the input
+//
+// Example:
+//
+//	$ cat <<EOF
+//	> Hello, $USER
+//	> EOF
+//	Hello, alice
+func (shell *Shell) readHereDocuments(command *commandText, line string) error {
+	start := command.addLine(line)
+	docs, err := findHereDocuments(line)
+
+	// errors in the line are positioned in the source
+	var parseErr *ParseError
+
+	if errors.As(err, &parseErr) && parseErr.Source == line {
+		parseErr.Source = command.source
+		parseErr.Position = positionAt(command.source, start+parseErr.Position.Offset)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	last := 0
+
+	for _, doc := range docs {
+		body, err := shell.readHereDocumentBody(command, doc)
+
+		if err != nil {
+			return err
+		}
+
+		command.write(line[last:doc.start], start+last, true)
+		command.write(doc.redirection(body), start+doc.start, false)
+		last = doc.end
+	}
+
+	command.write(line[last:], start+last, true)
+
+	return nil
+}
+
+// readHereDocumentBody reads lines from the shell's input until the
+// delimiter of doc, adding them to the source of command. Interactive
+// shells print the continuation prompt ($PS2, "> " by default) before each
+// line.
+//
+// If the input ends first, a warning is printed and the lines read so far
+// form the body, matching the behaviour of other shells.
+func (shell *Shell) readHereDocumentBody(command *commandText, doc hereDocument) (string, error) {
+	var body strings.Builder
+
+	for {
+		if shell.interactive {
+			fmt.Fprint(shell.Out, shell.ps2())
+		}
+
+		text, err := shell.readLine()
+
+		if errors.Is(err, io.EOF) {
+			fmt.Fprintf(shell.Err, "warning: here-document delimited by end-of-file (wanted `%s')\n", doc.delimiter)
+			return body.String(), nil
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		command.addLine(text)
+
+		text, ok := doc.bodyLine(text)
+
+		if !ok {
+			return body.String(), nil
+		}
+
+		body.WriteString(text + "\n")
+	}
+}
+
+// bodyLine returns a line of input as it appears in the body of doc, with
+// the leading tabs removed for <<-, and false if it is the delimiter line
+// that ends the body.
+func (doc hereDocument) bodyLine(line string) (string, bool) {
+	if doc.operator == "<<-" {
+		line = strings.TrimLeft(line, "\t")
+	}
+
+	return line, line != doc.delimiter
+}
+
+// redirection returns the text that replaces the operator and delimiter of
+// doc once its body is known (see readHereDocuments).
+func (doc hereDocument) redirection(body string) string {
+	switch {
+	case body == "":
+		return " < /dev/null "
+	case doc.quoted:
+		return " " + doc.operator + " '" + strings.ReplaceAll(body, "'", `'\''`) + "' "
+	default:
+		return " " + doc.operator + ` "` + escapeHereDocumentBody(body) + `" `
+	}
+}
+
+// embedHereDocuments embeds the bodies of the here-documents in a command
+// text that was not read line by line, such as the body of a command or
+// process substitution:
+//
+//	x=$(cat <<EOF
+//	body
+//	EOF
+//	)
+//
+// The lines after a line with << or <<- operators are its bodies, up to
+// their delimiters, and are embedded as readHereDocuments does. A body
+// that the text ends in is cut short with the same warning.
+//
+// Returns:
+//   - string: The text with the bodies embedded
+//   - error: ErrSyntax when an operator has no delimiter, or quoting
+//     errors in the delimiter
+func (shell *Shell) embedHereDocuments(text string) (string, error) {
+	if !strings.Contains(text, "<<") {
+		return text, nil
+	}
+
+	lines := strings.Split(text, "\n")
+	var embedded strings.Builder
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		docs, err := findHereDocuments(line)
+
+		if err != nil {
+			return "", err
+		}
+
+		if i > 0 {
+			embedded.WriteString("\n")
+		}
+
+		last := 0
+
+		for _, doc := range docs {
+			var body strings.Builder
+			closed := false
+
+			for i+1 < len(lines) && !closed {
+				i++
+				text, ok := doc.bodyLine(lines[i])
+				closed = !ok
+
+				if ok {
+					body.WriteString(text + "\n")
+				}
+			}
+
+			if !closed {
+				fmt.Fprintf(shell.Err, "warning: here-document delimited by end-of-file (wanted `%s')\n", doc.delimiter)
+			}
+
+			embedded.WriteString(line[last:doc.start] + doc.redirection(body.String()))
+			last = doc.end
+		}
+
+		embedded.WriteString(line[last:])
+	}
+
+	return embedded.String(), nil
+}
+
+// findHereDocuments locates the unquoted << and <<- operators in a line,
+// along with their delimiter words. Here-strings (<<<) and operators inside
+// quotes or expansions are skipped; those in command substitutions are
+// found when the substitution runs (see embedHereDocuments).
+func findHereDocuments(line string) ([]hereDocument, error) {
+	active := activeCharacters(line)
+	isActive := func(i int) bool { return i < len(line) && active[i] }
+
+	var docs []hereDocument
+
+	for i := 0; i+1 < len(line); i++ {
+		if !isActive(i) || !isActive(i+1) || line[i] != '<' || line[i+1] != '<' {
+			continue
+		}
+
+		// <<< is a here-string
+		if isActive(i+2) && line[i+2] == '<' {
+			i += 2
+			continue
+		}
+
+		doc := hereDocument{start: i, operator: "<<"}
+		pos := i + 2
+
+		if isActive(pos) && line[pos] == '-' {
+			doc.operator = "<<-"
+			pos++
+		}
+
+		for isActive(pos) && (line[pos] == ' ' || line[pos] == '\t') {
+			pos++
+		}
+
+		wordStart := pos
+
+		for pos < len(line) && !(active[pos] && strings.ContainsRune(" \t\n;|&<>()", rune(line[pos]))) {
+			pos++
+		}
+
+		word := line[wordStart:pos]
+
+		if word == "" {
+			token := "newline"
+			if pos < len(line) {
+				token = line[pos : pos+1]
+			}
+			return nil, newParseError(line, pos, ErrSyntax, "a delimiter", token)
+		}
+
+		delimiter, err := NewDefaultParser().ExpandWord(word)
+
+		if err != nil {
+			return nil, err
+		}
+
+		doc.delimiter = delimiter
+		doc.quoted = strings.ContainsAny(word, `'"\`)
+		doc.end = pos
+
+		docs = append(docs, doc)
+		i = pos - 1
+	}
+
+	return docs, nil
+}
+
+// escapeHereDocumentBody turns the body of an unquoted here-document into
+// the contents of a double-quoted word with the same meaning.
+//
+// Inside a here-document a double quote is an ordinary character and a
+// backslash only escapes $, `, \ and a newline (which joins two lines), so
+// " and \" are escaped for the double-quoted word while expansions such as
+// $(cmd "arg") are copied verbatim.
+//
+// Example:
+//
+//	escapeHereDocumentBody(`say "hi" to $USER` + "\n") → `say \"hi\" to $USER` + "\n"
+func escapeHereDocumentBody(body string) string {
+	var escaped strings.Builder
+	runeReader := strings.NewReader(body)
+
+	for {
+		pos := len(body) - runeReader.Len()
+		ch, _, err := runeReader.ReadRune()
+
+		if err != nil {
+			break
+		}
+
+		switch ch {
+		case '$', '`':
+			skipExpansion(runeReader, ch)
+			escaped.WriteString(body[pos : len(body)-runeReader.Len()])
+
+		case '"':
+			escaped.WriteString(`\"`)
+
+		case '\\':
+			next, _, err := runeReader.ReadRune()
+
+			switch {
+			case err != nil:
+				escaped.WriteString(`\\`)
+			case next == '\n':
+				// line continuation
+			case next == '"':
+				escaped.WriteString(`\\\"`)
+			case next == '$' || next == '`' || next == '\\':
+				escaped.WriteRune('\\')
+				escaped.WriteRune(next)
+			default:
+				escaped.WriteString(`\\`)
+				runeReader.UnreadRune()
+			}
+
+		default:
+			escaped.WriteRune(ch)
+		}
+	}
+
+	return escaped.String()
+}
@@ -0,0 +1,219 @@
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadHereDocuments(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		line        string
+		input       string
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "no here-document",
+			line:     "echo a > b",
+			input:    "",
+			expected: "echo a > b",
+		},
+		{
+			name:     "unquoted delimiter",
+			line:     "cat <<EOF",
+			input:    "hello $USER\nEOF\n",
+			expected: "cat  << \"hello $USER\n\" ",
+		},
+		{
+			name:     "quoted delimiter keeps the body literal",
+			line:     "cat << 'EOF' | wc",
+			input:    "it's $USER\nEOF\n",
+			expected: "cat  << 'it'\\''s $USER\n'  | wc",
+		},
+		{
+			name:     "tabs are stripped for <<-",
+			line:     "cat <<-END",
+			input:    "\t\tindented\n\tEND\n",
+			expected: "cat  <<- \"indented\n\" ",
+		},
+		{
+			name:     "bodies follow in order",
+			line:     "cat <<A; cat <<B",
+			input:    "a\nA\nb\nB\n",
+			expected: "cat  << \"a\n\" ; cat  << \"b\n\" ",
+		},
+		{
+			name:     "empty body",
+			line:     "cat <<EOF",
+			input:    "EOF\n",
+			expected: "cat  < /dev/null ",
+		},
+		{
+			name:     "end of input ends the body",
+			line:     "cat <<EOF",
+			input:    "partial\n",
+			expected: "cat  << \"partial\n\" ",
+		},
+		{
+			name:     "here-strings and quoted operators are skipped",
+			line:     `cat <<< x "<<EOF"`,
+			input:    "",
+			expected: `cat <<< x "<<EOF"`,
+		},
+		{
+			name:     "arithmetic shift is not a here-document",
+			line:     "echo $((1 << 2)); ((x << 1))",
+			input:    "",
+			expected: "echo $((1 << 2)); ((x << 1))",
+		},
+		{
+			name:        "missing delimiter",
+			line:        "cat <<",
+			expectedErr: ErrSyntax,
+		},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			sh := New(strings.NewReader(tt.input), io.Discard, io.Discard)
+			var command commandText
+			err := sh.readHereDocuments(&command, tt.line)
+			res := command.String()
+
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Errorf("Expected error: %v got %v", tt.expectedErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Expected no error got %v", err)
+				return
+			}
+
+			if res != tt.expected {
+				t.Errorf("line: %q\nexpected: %q\ngot:      %q", tt.line, tt.expected, res)
+			}
+
+		})
+
+	}
+
+}
+
+func TestRun_HereDocumentPrompt(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		input       string
+		interactive bool
+		expected    string
+	}{
+		{name: "no prompt in scripts", input: "cat <<EOF\nbody\nEOF\n", expected: "body\n"},
+		{name: "interactive prompt", input: "cat <<EOF\nbody\nEOF\n", interactive: true, expected: "$ > > body\n$ "},
+		{name: "interactive prompt uses PS2", input: "PS2='... '\ncat <<EOF\nbody\nEOF\n", interactive: true, expected: "$ $ ... ... body\n$ "},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			var stdout bytes.Buffer
+			sh := New(strings.NewReader(tt.input), &stdout, io.Discard)
+
+			if !tt.interactive {
+				sh.SetScript("doc.sh", nil)
+			}
+
+			if err := sh.Run(); err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+
+			if got := stdout.String(); got != tt.expected {
+				t.Errorf("expected %q got %q", tt.expected, got)
+			}
+
+		})
+
+	}
+
+}
+
+func TestRun_HereDocumentInSubstitution(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "command substitution", input: "x=$(cat <<EOF\nbody $((1 + 1))\nEOF\n)\necho \"[$x]\"\n", expected: "[body 2]\n"},
+		{name: "body lines are not run", input: "x=$(cat <<EOF\necho run\nEOF\n)\necho \"[$x]\"\n", expected: "[echo run]\n"},
+		{name: "several documents", input: "echo \"$(cat <<'A'; cat <<-B\n$a\nA\n\tb\n\tB\n)\"\n", expected: "$a\nb\n"},
+		{name: "process substitution", input: "cat <(cat <<EOF\nproc\nEOF\n)\n", expected: "proc\n"},
+		{name: "here-string stays", input: "echo $(cat <<< in)\n", expected: "in\n"},
+		{name: "operator in quotes", input: "echo $(echo \"a <<b\")\n", expected: "a <<b\n"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			var stdout, stderr bytes.Buffer
+			sh := New(strings.NewReader(tt.input), &stdout, &stderr)
+			sh.SetScript("doc.sh", nil)
+
+			if err := sh.Run(); err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+
+			if stderr.Len() > 0 {
+				t.Errorf("unexpected errors: %q", stderr.String())
+			}
+
+			if got := stdout.String(); got != tt.expected {
+				t.Errorf("input: %q\nexpected: %q\ngot:      %q", tt.input, tt.expected, got)
+			}
+
+		})
+
+	}
+
+}
+
+func TestEscapeHereDocumentBody(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{name: "plain text", body: "hello\n", expected: "hello\n"},
+		{name: "double quotes are literal", body: `say "hi"`, expected: `say \"hi\"`},
+		{name: "escaped double quote keeps its backslash", body: `\"`, expected: `\\\"`},
+		{name: "special escapes are kept", body: `\$x \` + "`" + ` \\`, expected: `\$x \` + "`" + ` \\`},
+		{name: "other backslashes are literal", body: `a\nb`, expected: `a\\nb`},
+		{name: "line continuation", body: "a\\\nb", expected: "ab"},
+		{name: "expansions are copied verbatim", body: `$(echo "x") ${y:-"z"}`, expected: `$(echo "x") ${y:-"z"}`},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			if got := escapeHereDocumentBody(tt.body); got != tt.expected {
+				t.Errorf("body: %q\nexpected: %q\ngot:      %q", tt.body, tt.expected, got)
+			}
+
+		})
+
+	}
+
+}
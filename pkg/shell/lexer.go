@@ -0,0 +1,696 @@
+package shell
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// controlOperators are the operators that separate or group the commands
+// of a list or pipeline, or end the items of a case command. Longer
+// operators come first so that "||" is not read as two pipes. An unquoted newline separates commands like ";".
+var controlOperators = []string{";;&", "&&", "||", ";;", ";&", ";", "|", "(", ")", "\n"}
+
+// redirectionOperators are the operators that introduce a redirection,
+// longest first. Digits directly in front of one that starts with < or >
+// are an io-number naming the file descriptor, and become part of the
+// operator: 2> or 2>&.
+var redirectionOperators = []string{"<<<", "<<-", "&>>", "<<", ">>", ">&", "<&", "&>", "<", ">"}
+
+// operators are all the operators the lexer splits out of the text.
+var operators = slices.Concat(redirectionOperators, controlOperators)
+
+// commandPrefixWords are the reserved words that are followed by a command,
+// so that a "((" after them is an arithmetic command: if ((x > 1)). The
+// "((" after a for starts the header of an arithmetic for loop.
+var commandPrefixWords = []string{"if", "then", "elif", "else", "while", "until", "do", "for", "{"}
+
+// tokenKind identifies the kind of a token produced by the lexer.
+type tokenKind int
+
+const (
+	tokenEOF         tokenKind = iota // End of the text
+	tokenWord                         // A word, possibly quoted or containing expansions
+	tokenOperator                     // A control operator such as ";" or "|"
+	tokenRedirection                  // A redirection operator such as ">" or "2>&"
+	tokenArithmetic                   // A ((expr)) arithmetic command
+)
+
+// token is a single lexical unit of a command list.
+type token struct {
+	kind tokenKind
+	pos  Position
+	text string // The operator, or the expression of a ((expr)) command
+	word *Word  // The word, for tokenWord
+
+	aliases []string // Aliases whose values produced the token, which are not expanded again
+}
+
+// sourceReader is an io.RuneScanner over command text that keeps track of
+// the byte offset it has reached, so that syntax nodes can record where
+// they start.
+//
+// It wraps the parser's rune reader and can be handed to the read helpers
+// (readBraced, readParenthesized and so on), which keeps the offset in step
+// with everything they consume.
+type sourceReader struct {
+	reader   io.RuneScanner
+	text     string
+	offset   int // Byte offset of the next rune
+	lastSize int // Size of the last rune read, for UnreadRune
+}
+
+// ReadRune reads the next rune and advances the offset past it.
+func (s *sourceReader) ReadRune() (rune, int, error) {
+	ch, size, err := s.reader.ReadRune()
+
+	if err == nil {
+		s.offset += size
+		s.lastSize = size
+	}
+
+	return ch, size, err
+}
+
+// UnreadRune steps back over the last rune read.
+func (s *sourceReader) UnreadRune() error {
+	err := s.reader.UnreadRune()
+
+	if err == nil {
+		s.offset -= s.lastSize
+		s.lastSize = 0
+	}
+
+	return err
+}
+
+// rest returns the text that has not been read yet.
+func (s *sourceReader) rest() string {
+	return s.text[s.offset:]
+}
+
+// skip advances past the next n bytes, which must end on a rune boundary.
+func (s *sourceReader) skip(n int) {
+	for end := s.offset + n; s.offset < end; {
+		s.ReadRune()
+	}
+}
+
+// position converts a byte offset in the text into a Position.
+func (s *sourceReader) position(offset int) Position {
+	return positionAt(s.text, offset)
+}
+
+// errorAt wraps err, a quoting error from reading the quote or expansion
+// that starts at byte offset, in a *ParseError pointing at its start.
+// Errors that already have a position and I/O errors are returned as they
+// are.
+//
+// Parameters:
+//   - offset: Byte offset of the opening quote or expansion
+//   - err: The error from reading it
+//   - expected: The closing delimiter the text ended without, described
+//     for the error message
+func (s *sourceReader) errorAt(offset int, err error, expected string) error {
+	var parseErr *ParseError
+
+	if errors.As(err, &parseErr) || !isQuotingError(err) {
+		return err
+	}
+
+	return newParseError(s.text, offset, err, expected, endOfFile)
+}
+
+// isQuotingError reports whether err is one of the sentinel errors for
+// text that ends inside a quote, escape or expansion.
+func isQuotingError(err error) bool {
+	return errors.Is(err, ErrUnclosedQuote) || errors.Is(err, ErrUnescapedCharacter) || errors.Is(err, ErrUnclosedExpansion)
+}
+
+// positionAt converts a byte offset in text into a Position.
+func positionAt(text string, offset int) Position {
+	lineStart := strings.LastIndexByte(text[:offset], '\n') + 1
+
+	return Position{
+		Offset: offset,
+		Line:   strings.Count(text[:offset], "\n") + 1,
+		Column: utf8.RuneCountInString(text[lineStart:offset]) + 1,
+	}
+}
+
+// newSourceReader creates a sourceReader over text using the parser's
+// rune reader.
+func (p *DefaultParser) newSourceReader(text string) *sourceReader {
+	return &sourceReader{reader: p.newReader(text), text: text}
+}
+
+// lex splits command text into words, operators and ((expr)) arithmetic
+// commands.
+//
+// Operators are recognised wherever they appear outside quotes and
+// expansions, so `echo hi>out.txt` is the word echo, the word hi, the
+// operator > and the word out.txt. Digits that start a token and directly
+// touch a < or > operator are its io-number: `2>err` redirects file
+// descriptor 2, while in `2 >err` and `a2>err` the digits are part of an
+// ordinary word. A <( or >( starts a process substitution, which is part
+// of a word, rather than a redirection. The target of a duplication (>&
+// or <&) is always a word, so in `2>&1>out` the 1 is the target of 2>&
+// rather than the io-number of the >.
+//
+// Blanks separate words and are otherwise dropped; newlines are kept as
+// operators because they separate commands. A "((" is an arithmetic command
+// only where a command may start: at the beginning of the text, after a
+// control operator or after a reserved word such as then.
+//
+// Parameters:
+//   - text: The command text to split
+//
+// Returns:
+//   - []token: The tokens in order, ending with a tokenEOF
+//   - error: A *ParseError wrapping ErrUnclosedQuote,
+//     ErrUnescapedCharacter or ErrUnclosedExpansion for malformed words,
+//     or I/O errors
+//
+// Example:
+//
+//	lex(`ls -l|grep "a b">out 2>&1`)
+//	// → word "ls", word "-l", operator "|", word "grep", word `"a b"`,
+//	//   redirection ">", word "out", redirection "2>&", word "1", EOF
+func (p *DefaultParser) lex(text string) ([]token, error) {
+	s := p.newSourceReader(text)
+	tokens := []token{}
+	isCommandStart := true
+	isDuplicationTarget := false
+
+	for {
+		rest := strings.TrimLeftFunc(s.rest(), isBlank)
+		s.skip(len(s.rest()) - len(rest))
+
+		pos := s.position(s.offset)
+
+		if rest == "" {
+			return append(tokens, token{kind: tokenEOF, pos: pos}), nil
+		}
+
+		if isCommandStart && strings.HasPrefix(rest, "((") {
+			s.skip(2)
+			expr, err := readArithmetic(s)
+
+			if err != nil {
+				return nil, s.errorAt(pos.Offset, err, "`))'")
+			}
+
+			tokens = append(tokens, token{kind: tokenArithmetic, pos: pos, text: expr})
+			isCommandStart = false
+			continue
+		}
+
+		if op := matchRedirection(rest); op != "" && !isProcessSubstitution(rest) && !isDuplicationTarget {
+			s.skip(len(op))
+			tokens = append(tokens, token{kind: tokenRedirection, pos: pos, text: op})
+			isCommandStart = false
+			isDuplicationTarget = strings.HasSuffix(op, "&")
+			continue
+		}
+
+		isDuplicationTarget = false
+
+		if op := matchOperator(rest, controlOperators); op != "" {
+			s.skip(len(op))
+			tokens = append(tokens, token{kind: tokenOperator, pos: pos, text: op})
+			isCommandStart = true
+			continue
+		}
+
+		word, err := readWord(s, isCommandBoundary)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, token{kind: tokenWord, pos: pos, word: word})
+
+		literal, _ := word.literal()
+		isCommandStart = isCommandStart && slices.Contains(commandPrefixWords, literal)
+	}
+}
+
+// matchRedirection returns the redirection operator, with its io-number if
+// any, that prefixes rest, or "" if there is none.
+//
+// Example:
+//
+//	matchRedirection("2>&1")  → "2>&"
+//	matchRedirection("&>out") → "&>"
+//	matchRedirection("2&>x")  → ""
+func matchRedirection(rest string) string {
+	digits := strings.IndexFunc(rest, func(ch rune) bool { return ch < '0' || ch > '9' })
+
+	if digits < 0 {
+		return ""
+	}
+
+	op := matchOperator(rest[digits:], redirectionOperators)
+
+	if op == "" || (digits > 0 && op[0] != '<' && op[0] != '>') {
+		return ""
+	}
+
+	return rest[:digits+len(op)]
+}
+
+// lexFields splits text into words at unquoted whitespace only, with no
+// operators: the word splitting of the Parse compatibility API.
+func (p *DefaultParser) lexFields(text string) ([]*Word, error) {
+	s := p.newSourceReader(text)
+	words := []*Word{}
+
+	for {
+		rest := strings.TrimLeftFunc(s.rest(), unicode.IsSpace)
+		s.skip(len(s.rest()) - len(rest))
+
+		if rest == "" {
+			return words, nil
+		}
+
+		word, err := readWord(s, startsWithSpace)
+
+		if err != nil {
+			return nil, err
+		}
+
+		words = append(words, word)
+	}
+}
+
+// lexText reads the whole of text as a single word, in which unquoted
+// whitespace and operators are ordinary characters.
+func (p *DefaultParser) lexText(text string) (*Word, error) {
+	return readWord(p.newSourceReader(text), nil)
+}
+
+// isArrayAssignment reports whether text, the start of a word, is the
+// NAME= of an array assignment when a "(" follows it.
+func isArrayAssignment(text string) bool {
+	name, found := strings.CutSuffix(text, "=")
+	return found && isValidName(name)
+}
+
+// isBlank reports whether ch separates words without ending a command.
+func isBlank(ch rune) bool {
+	return ch != '\n' && unicode.IsSpace(ch)
+}
+
+// startsWithSpace reports whether rest begins with whitespace.
+func startsWithSpace(rest string) bool {
+	ch, _ := utf8.DecodeRuneInString(rest)
+	return unicode.IsSpace(ch)
+}
+
+// isCommandBoundary reports whether rest begins with whitespace or an
+// operator, either of which ends an unquoted word in a command. The < and
+// > of a process substitution belong to the word.
+func isCommandBoundary(rest string) bool {
+	return startsWithSpace(rest) || matchOperator(rest, operators) != "" && !isProcessSubstitution(rest)
+}
+
+// isProcessSubstitution reports whether rest begins with the <( or >( of a
+// process substitution.
+func isProcessSubstitution(rest string) bool {
+	return strings.HasPrefix(rest, "<(") || strings.HasPrefix(rest, ">(")
+}
+
+// readWord reads one word and splits it into its literal, quoted and
+// expansion parts.
+//
+// The word ends at the end of the text or where isBoundary reports true for
+// the remaining text outside quotes and expansions; a nil isBoundary reads
+// the whole text. The parts follow the quoting rules of the shell:
+//   - \c outside quotes is an escaped Literal holding c
+//   - '...' is a SingleQuoted part
+//   - "..." is a DoubleQuoted part holding Literal and Expansion parts;
+//     inside it a backslash only escapes $, `, " and \
+//   - $name, ${...}, $(...), `...` and $((...)) are Expansion parts; a "$"
+//     that starts none of them is literal
+//   - <(...) and >(...) outside quotes are ProcessSubstitution Expansion
+//     parts
+//   - (...) directly after an unquoted NAME= at the start of the word is
+//     an ArrayLiteral, which may contain blanks and newlines
+//   - Anything else is collected into unquoted Literal parts
+//
+// Parameters:
+//   - s: Reader positioned at the first character of the word
+//   - isBoundary: Reports whether the remaining text starts a new word
+//
+// Returns:
+//   - *Word: The word, with Raw holding its source text
+//   - error: A *ParseError wrapping ErrUnclosedQuote,
+//     ErrUnescapedCharacter or ErrUnclosedExpansion, pointing at the
+//     quote, backslash or expansion that is not closed
+func readWord(s *sourceReader, isBoundary func(rest string) bool) (*Word, error) {
+	start := s.offset
+	word := &Word{Position: s.position(start)}
+
+	var literal strings.Builder
+	literalStart := start
+
+	// flush ends the unquoted literal collected so far
+	flush := func() {
+		if literal.Len() > 0 {
+			word.Parts = append(word.Parts, &Literal{Position: s.position(literalStart), Value: literal.String()})
+			literal.Reset()
+		}
+	}
+
+	for {
+		// NAME=(...) is an array assignment, whose parentheses belong to
+		// the word rather than starting a subshell
+		if len(word.Parts) == 0 && strings.HasPrefix(s.rest(), "(") && isArrayAssignment(literal.String()) {
+			offset := s.offset
+			s.skip(1)
+			text, err := readParenthesized(s)
+
+			if err != nil {
+				return nil, s.errorAt(offset, err, "`)'")
+			}
+
+			flush()
+			word.Parts = append(word.Parts, &ArrayLiteral{Position: s.position(offset), Text: text})
+			continue
+		}
+
+		if isBoundary != nil && s.offset > start && isBoundary(s.rest()) {
+			break
+		}
+
+		offset := s.offset
+		ch, _, err := s.ReadRune()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if literal.Len() == 0 {
+			literalStart = offset
+		}
+
+		switch ch {
+		case '\\':
+			next, _, err := s.ReadRune()
+
+			if err == io.EOF {
+				return nil, s.errorAt(offset, ErrUnescapedCharacter, "a character after `\\'")
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			flush()
+			word.Parts = append(word.Parts, &Literal{Position: s.position(offset), Value: string(next), Escaped: true})
+
+		case '\'':
+			value, err := readSingleQuoted(s)
+
+			if err != nil {
+				return nil, s.errorAt(offset, err, "`''")
+			}
+
+			flush()
+			word.Parts = append(word.Parts, &SingleQuoted{Position: s.position(offset), Value: value})
+
+		case '"':
+			flush()
+			quoted, err := readDoubleQuoted(s, offset)
+
+			if err != nil {
+				return nil, s.errorAt(offset, err, "`\"'")
+			}
+
+			word.Parts = append(word.Parts, quoted)
+
+		case '$', '`':
+			// $'...' is a quoted string with backslash escapes
+			if ch == '$' && strings.HasPrefix(s.rest(), "'") {
+				s.skip(1)
+				raw, err := readANSIQuoted(s)
+
+				if err != nil {
+					return nil, s.errorAt(offset, err, "`''")
+				}
+
+				flush()
+				value, _ := decodeEscapes(raw, ansiEscapes)
+				word.Parts = append(word.Parts, &SingleQuoted{Position: s.position(offset), Value: value})
+				continue
+			}
+
+			expansion, err := readExpansion(s, ch, offset)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if expansion == nil {
+				literal.WriteRune(ch)
+				continue
+			}
+
+			flush()
+			word.Parts = append(word.Parts, expansion)
+
+		case '<', '>':
+			if !strings.HasPrefix(s.rest(), "(") {
+				literal.WriteRune(ch)
+				continue
+			}
+
+			s.skip(1)
+			command, err := readParenthesized(s)
+
+			if err != nil {
+				return nil, s.errorAt(offset, err, "`)'")
+			}
+
+			flush()
+			word.Parts = append(word.Parts, &Expansion{
+				Position: s.position(offset),
+				Kind:     ProcessSubstitution,
+				Text:     command,
+				Raw:      s.text[offset:s.offset],
+			})
+
+		default:
+			literal.WriteRune(ch)
+		}
+	}
+
+	flush()
+	word.Raw = s.text[start:s.offset]
+
+	return word, nil
+}
+
+// readSingleQuoted reads the text of a '...' string up to the closing
+// quote. The reader must be positioned after the opening quote.
+func readSingleQuoted(s *sourceReader) (string, error) {
+	var value strings.Builder
+
+	for {
+		ch, _, err := s.ReadRune()
+
+		if err == io.EOF {
+			return "", ErrUnclosedQuote
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		if ch == '\'' {
+			return value.String(), nil
+		}
+
+		value.WriteRune(ch)
+	}
+}
+
+// readDoubleQuoted reads the parts of a "..." string up to the closing
+// quote. The reader must be positioned after the opening quote, which is
+// at byte offset start.
+//
+// A backslash followed by $, `, " or \ is an escaped Literal; before any
+// other character it stays in the text, so "a\nb" keeps its backslash.
+func readDoubleQuoted(s *sourceReader, start int) (*DoubleQuoted, error) {
+	quoted := &DoubleQuoted{Position: s.position(start)}
+
+	var literal strings.Builder
+	literalStart := s.offset
+
+	flush := func() {
+		if literal.Len() > 0 {
+			quoted.Parts = append(quoted.Parts, &Literal{Position: s.position(literalStart), Value: literal.String()})
+			literal.Reset()
+		}
+	}
+
+	for {
+		offset := s.offset
+		ch, _, err := s.ReadRune()
+
+		if err == io.EOF {
+			return nil, ErrUnclosedQuote
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if literal.Len() == 0 {
+			literalStart = offset
+		}
+
+		switch ch {
+		case '"':
+			flush()
+			return quoted, nil
+
+		case '\\':
+			next, _, err := s.ReadRune()
+
+			if err == io.EOF {
+				return nil, ErrUnclosedQuote
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			if !strings.ContainsRune("$`\"\\", next) {
+				literal.WriteRune('\\')
+				literal.WriteRune(next)
+				continue
+			}
+
+			flush()
+			quoted.Parts = append(quoted.Parts, &Literal{Position: s.position(offset), Value: string(next), Escaped: true})
+
+		case '$', '`':
+			expansion, err := readExpansion(s, ch, offset)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if expansion == nil {
+				literal.WriteRune(ch)
+				continue
+			}
+
+			flush()
+			quoted.Parts = append(quoted.Parts, expansion)
+
+		default:
+			literal.WriteRune(ch)
+		}
+	}
+}
+
+// readExpansion reads the expansion introduced by ch ("$" or "`"), which
+// was read at byte offset start.
+//
+// Recognised forms are:
+//   - ${...}: A ParameterExpansion of the text between the braces
+//   - $((...)): An ArithmeticExpansion of the text up to the matching "))"
+//   - $(...): A CommandSubstitution of the text up to the matching ")"
+//   - `...`: A CommandSubstitution, with \$, \` and \\ unescaped
+//   - $name: A ParameterExpansion of the longest run of name characters
+//   - $1, $#, $@, $*: A ParameterExpansion of a single digit or special
+//     parameter character
+//
+// Parameters:
+//   - s: Reader positioned after ch
+//   - ch: "$" or "`"
+//   - start: Byte offset of ch
+//
+// Returns:
+//   - *Expansion: The expansion, or nil when a "$" starts none of these
+//     forms and is literal; the reader is then left after the "$"
+//   - error: A *ParseError wrapping ErrUnclosedExpansion for an
+//     unterminated expansion
+func readExpansion(s *sourceReader, ch rune, start int) (*Expansion, error) {
+	expansion := &Expansion{Position: s.position(start)}
+
+	finish := func(kind ExpansionKind, text string, err error) (*Expansion, error) {
+		if err != nil {
+			closer := map[ExpansionKind]string{ParameterExpansion: "`}'", CommandSubstitution: "`)'", ArithmeticExpansion: "`))'"}[kind]
+
+			if ch == '`' {
+				closer = "``'"
+			}
+
+			return nil, s.errorAt(start, err, closer)
+		}
+
+		expansion.Kind = kind
+		expansion.Text = text
+		expansion.Raw = s.text[start:s.offset]
+
+		return expansion, nil
+	}
+
+	if ch == '`' {
+		command, err := readBackquoted(s)
+		return finish(CommandSubstitution, command, err)
+	}
+
+	next, _, err := s.ReadRune()
+
+	if err != nil {
+		return nil, nil
+	}
+
+	switch {
+	case next == '{':
+		expr, err := readBraced(s)
+		return finish(ParameterExpansion, expr, err)
+
+	case next == '(':
+		// $((...)) is arithmetic, $(...) is command substitution
+		if third, _, err := s.ReadRune(); err == nil && third == '(' {
+			expr, err := readArithmetic(s)
+			return finish(ArithmeticExpansion, expr, err)
+		} else if err == nil {
+			s.UnreadRune()
+		}
+
+		command, err := readParenthesized(s)
+		return finish(CommandSubstitution, command, err)
+
+	case isNameStart(next):
+		name := strings.IndexFunc(s.rest(), func(ch rune) bool {
+			return !isNameStart(ch) && (ch < '0' || ch > '9')
+		})
+
+		if name < 0 {
+			name = len(s.rest())
+		}
+
+		s.skip(name)
+		return finish(ParameterExpansion, s.text[start+1:s.offset], nil)
+
+	case isSpecialParam(next):
+		// $1 is the first positional parameter and $10 is $1 followed by 0
+		return finish(ParameterExpansion, string(next), nil)
+	}
+
+	s.UnreadRune()
+	return nil, nil
+}
@@ -0,0 +1,79 @@
+package shell
+
+// evaluate parses text as a command list and runs it.
+//
+// Parameters:
+//   - text: The command text, which may span several lines
+//
+// Returns:
+//   - error: Syntax and parse errors, or the errors of runList
+func (shell *Shell) evaluate(text string) error {
+	list, err := shell.parser.ParseTree(text)
+
+	if err != nil {
+		return err
+	}
+
+	return shell.runList(list)
+}
+
+// runList executes a command list, short-circuiting on exit status.
+//
+// A command list is a sequence of pipelines separated by:
+//   - ; or a newline : Run the next pipeline unconditionally
+//   - &&             : Run the next pipeline only if the previous status was 0
+//   - ||             : Run the next pipeline only if the previous status was non-zero
+//
+// Pipelines are evaluated left to right. After each pipeline the shell's
+// last status is updated; a pipeline following "&&" is skipped when that
+// status is non-zero and one following "||" is skipped when it is zero.
+// Skipping a pipeline leaves the status unchanged, so
+// `false && echo a || echo b` prints "b".
+//
+// Parameters:
+//   - list: The parsed command list
+//
+// Returns:
+//   - error: Errors from command substitutions that cannot be parsed, or
+//     ErrExit when the exit builtin runs. The list's exit status is
+//     recorded in shell.lastStatus.
+//
+// Example:
+//
+//	$ cd /nonexistent && echo moved || echo stayed
+//	cd: /nonexistent: No such file or directory
+//	stayed
+func (shell *Shell) runList(list *List) error {
+
+	for i, pipeline := range list.Pipelines {
+
+		if i > 0 {
+			op := list.Operators[i-1]
+
+			if op == "&&" && shell.lastStatus != 0 {
+				continue
+			}
+
+			if op == "||" && shell.lastStatus == 0 {
+				continue
+			}
+		}
+
+		status, err := shell.runPipeline(pipeline)
+
+		// exit carries the status the shell should terminate with, and
+		// break and continue theirs to the enclosing loop
+		if isControlFlow(err) {
+			shell.lastStatus = status
+			return err
+		}
+
+		if err != nil {
+			return err
+		}
+
+		shell.lastStatus = status
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package shell
+
+import (
+	"testing"
+)
+
+func TestRunList(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		script         string
+		expected       string
+		expectedStatus int
+	}{
+		{name: "sequence runs everything", script: "echo a; false; echo b", expected: "a\nb\n"},
+		{name: "sequence status is the last", script: "true; false", expectedStatus: 1},
+		{name: "and runs after success", script: "true && echo yes", expected: "yes\n"},
+		{name: "and skips after failure", script: "false && echo yes", expectedStatus: 1},
+		{name: "or skips after success", script: "true || echo no", expected: ""},
+		{name: "or runs after failure", script: "false || echo no", expected: "no\n"},
+		{name: "external status drives and", script: "test -d /nonexistent && echo found", expectedStatus: 1},
+		{name: "builtin status drives or", script: "cd /nonexistent 2>/dev/null || echo failed", expected: "failed\n"},
+		{name: "not found drives or", script: "nosuchcommand 2>/dev/null || echo $?", expected: "127\n"},
+		{name: "chain keeps the last status", script: "false || false || true && echo ok", expected: "ok\n"},
+		{name: "skipped command keeps the status", script: "false && echo never || echo recovered", expected: "recovered\n"},
+		{name: "left to right", script: "true || echo a && echo b", expected: "b\n"},
+		{name: "semicolon resets the chain", script: "false && echo a; echo b", expected: "b\n"},
+		{name: "pipeline status drives and", script: "echo x | grep -q y && echo match", expectedStatus: 1},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, status := runScript(t, tt.script)
+
+			if got != tt.expected {
+				t.Errorf("script: %q\nexpected: %q\ngot:      %q", tt.script, tt.expected, got)
+			}
+
+			if status != tt.expectedStatus {
+				t.Errorf("expected status %d got %d", tt.expectedStatus, status)
+			}
+
+		})
+
+	}
+
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 // Parser defines the interface for command line parsing implementations.
@@ -61,35 +62,287 @@ var ErrUnclosedQuote = errors.New("unclosed quote")
 //	echo hello\
 var ErrUnescapedCharacter = errors.New("unescaped character")
 
-// DefaultParser implements the Parser interface with shell-compatible
-// quoting and escaping rules.
+// ErrSyntax is returned when a command line is well quoted but its operators
+// are arranged in a way the shell cannot interpret, such as a pipeline with
+// an empty stage.
 //
-// The parser uses a state machine to track whether it's currently inside
-// quotes and handles escape sequences according to standard shell rules:
+// The error is usually wrapped with the offending token:
 //
-// Single quotes:
-//   - Everything is literal (no escaping possible)
-//   - Cannot include a single quote inside single quotes
-//   - Example: 'hello\nworld' → "hello\nworld" (backslash literal)
+//	$ ls |
+//	syntax error near unexpected token `|'
+var ErrSyntax = errors.New("syntax error")
+
+// endOfFile is the ParseError.Found of an error at the end of the text.
+const endOfFile = "end of file"
+
+// ParseError is an error in command text at a known place: the offending
+// token, or the opening quote or expansion that is never closed.
 //
-// Double quotes:
-//   - Backslash escapes work for \" and \\
-//   - Other backslashes are preserved literally
-//   - Example: "hello\"world" → "hello"world"
-//   - Example: "hello\nworld" → "hello\nworld" (backslash literal)
-//
-// Outside quotes:
-//   - Backslash escapes the next character
-//   - Whitespace separates tokens
-//   - Example:  hello\ world → "hello world"
-//
-// The parser is designed for testability with injectable dependencies
-// (newReader and newBuilder functions).
+// It wraps one of the sentinel errors (ErrSyntax, ErrUnclosedQuote,
+// ErrUnescapedCharacter or ErrUnclosedExpansion), so errors.Is keeps
+// working, and adds what the parser was looking for and what it found
+// instead. Diagnostic renders the line of the source it points into.
+//
+// Example:
+//
+//	_, err := parser.ParseTree("ls | | wc")
+//	errors.Is(err, ErrSyntax) // true
+//	err.Error()               // "syntax error near unexpected token `|' (expected a command)"
+//
+//	var parseErr *ParseError
+//	errors.As(err, &parseErr) // parseErr.Position is line 1, column 6
+type ParseError struct {
+	Position Position // Where the error is in Source
+	Expected string   // What would have been valid, such as "`fi'" or "a command"; "" when unknown
+	Found    string   // The token found instead, or "end of file"
+	Source   string   // The text that was parsed
+	Err      error    // The sentinel error
+}
+
+// newParseError returns a *ParseError for err at byte offset in text.
+func newParseError(text string, offset int, err error, expected, found string) *ParseError {
+	return &ParseError{
+		Position: positionAt(text, offset),
+		Expected: expected,
+		Found:    found,
+		Source:   text,
+		Err:      err,
+	}
+}
+
+// Error describes the error without its position, in the words of other
+// shells: "syntax error near unexpected token `fi'" or "unclosed quote:
+// unexpected end of file", followed by what was expected if known.
+func (e *ParseError) Error() string {
+	message := e.Err.Error()
+
+	switch e.Found {
+	case "":
+	case endOfFile:
+		message += ": unexpected end of file"
+	default:
+		message += " near unexpected token `" + e.Found + "'"
+	}
+
+	if e.Expected != "" {
+		message += " (expected " + e.Expected + ")"
+	}
+
+	return message
+}
+
+// Unwrap returns the sentinel error, for errors.Is.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Diagnostic returns the line of the source that holds the error, with a
+// caret under the column of the error on the line below. Tabs before the
+// column are kept, so the caret lines up however wide they are shown.
+//
+// Example:
+//
+//	ls | | wc
+//	     ^
+func (e *ParseError) Diagnostic() string {
+	lines := strings.Split(e.Source, "\n")
+	line := lines[min(e.Position.Line, len(lines))-1]
+
+	var caret strings.Builder
+
+	for i, ch := range []rune(line) {
+		if i >= e.Position.Column-1 {
+			break
+		}
+
+		if ch == '\t' {
+			caret.WriteRune('\t')
+		} else {
+			caret.WriteRune(' ')
+		}
+	}
+
+	return line + "\n" + caret.String() + "^"
+}
+
+// DefaultParser implements the Parser interface with a lexer and a
+// recursive-descent parser for shell command text.
+//
+// ParseTree lexes the text into tokens (words, operators, redirections and
+// here-document markers) and parses them into a syntax tree of lists,
+// pipelines, simple commands and compound commands. Aliases installed with
+// SetAliases are replaced as commands are parsed. Words keep their quoted,
+// literal and expansion parts, and are expanded only when a command runs:
+//
+//   - ExpandWords expands command arguments: braces and tildes, then
+//     parameters, command and arithmetic substitutions through the
+//     Expander installed with SetExpander, then field splitting and
+//     globbing of unquoted parts
+//   - ExpandWord and ExpandPattern expand a single word without splitting,
+//     for defaults, patterns and replacements inside ${...}
+//
+// Parse combines both steps for a single command line. Quoting follows
+// the shell rules: everything inside '...' is literal, "..." allows
+// expansions and escapes only \", \\, \$ and \`, $'...' decodes C-style
+// escapes such as \t, and outside quotes a backslash escapes the next
+// character:
+//
+//	echo "a \"b\" $HOME" 'c $d' e\ f
+//	// echo, a "b" /home/user, c $d, e f
+//
+// The rune reader and token builder are injectable for testing (newReader
+// and newBuilder).
 type DefaultParser struct {
-	newReader  func(string) io.RuneReader
+	newReader  func(string) io.RuneScanner
 	newBuilder func() *strings.Builder
+	expander   Expander
+	aliases    func(name string) (string, bool) // Looks up alias values; nil disables aliases
 }
 
+// Expander resolves the expansions that DefaultParser encounters while
+// tokenizing a command line.
+//
+// The parser knows the quoting context of every "$" it sees, so it decides
+// which ones are expansions (outside quotes or inside double quotes) and
+// which are literal (inside single quotes or escaped as \$). The expander
+// only has to produce values.
+//
+// Example mock implementation for testing:
+//
+//	type mapExpander map[string]string
+//
+//	func (m mapExpander) ExpandParameter(expr string) (string, error) {
+//	    return m[expr], nil
+//	}
+//
+//	func (m mapExpander) ExpandCommand(command string) (string, error) {
+//	    return "", nil
+//	}
+//
+//	func (m mapExpander) ExpandArithmetic(expr string) (string, error) {
+//	    return "0", nil
+//	}
+//
+//	func (m mapExpander) ExpandGlob(pattern string) ([]string, error) {
+//	    return []string{pattern}, nil
+//	}
+//
+//	func (m mapExpander) ExpandTilde(prefix string) (string, bool) {
+//	    return "/home/" + prefix, true
+//	}
+//
+//	func (m mapExpander) ExpandList(expr string) ([]string, error) {
+//	    return strings.Fields(m[expr]), nil
+//	}
+//
+//	func (m mapExpander) FieldSeparators() string {
+//	    return " \t\n"
+//	}
+//
+//	func (m mapExpander) ExpandProcess(command string, output bool) (string, error) {
+//	    return "/dev/fd/63", nil
+//	}
+type Expander interface {
+	// ExpandParameter returns the value of a parameter expansion.
+	//
+	// Parameters:
+	//   - expr: The variable name from $name, or the text between the
+	//     braces of ${...}
+	//
+	// Returns:
+	//   - string: The expanded value (empty for unset variables)
+	//   - error: ErrBadSubstitution if expr cannot be interpreted
+	ExpandParameter(expr string) (string, error)
+
+	// ExpandCommand runs a command substitution and returns its output.
+	//
+	// Parameters:
+	//   - command: The command text from $(...) or `...`
+	//
+	// Returns:
+	//   - string: The command's stdout with trailing newlines removed
+	//   - error: Syntax errors in the command
+	ExpandCommand(command string) (string, error)
+
+	// ExpandArithmetic evaluates an arithmetic expansion.
+	//
+	// Parameters:
+	//   - expr: The expression text from $((...))
+	//
+	// Returns:
+	//   - string: The result in decimal
+	//   - error: Evaluation errors such as division by zero
+	ExpandArithmetic(expr string) (string, error)
+
+	// ExpandGlob performs filename expansion on a word that contains
+	// unquoted pattern characters.
+	//
+	// Parameters:
+	//   - pattern: The word in pattern form, with quoted pattern characters
+	//     backslash-escaped
+	//
+	// Returns:
+	//   - []string: The words replacing the pattern, normally the sorted
+	//     matching paths; when nothing matches, the word itself with the
+	//     escapes removed (or no words at all for nullglob)
+	//   - error: An error when nothing matches and failglob is set
+	ExpandGlob(pattern string) ([]string, error)
+
+	// ExpandTilde resolves a tilde prefix at the start of a word.
+	//
+	// Parameters:
+	//   - prefix: The text between "~" and the first "/" (or ":" in an
+	//     assignment): "" for the user's home, a login name, "+" or "-"
+	//
+	// Returns:
+	//   - string: The directory the prefix stands for
+	//   - bool: false if the prefix is unknown, which leaves it literal
+	ExpandTilde(prefix string) (string, bool)
+
+	// ExpandList returns the values of a parameter expansion that stands
+	// for a list, such as $@ or ${arr[@]} (see listExpansion), which
+	// expand to one field per value rather than a single value.
+	//
+	// Parameters:
+	//   - expr: The text of the expansion, one of the list forms
+	//
+	// Returns:
+	//   - []string: The values in order, such as the parameters $1, $2, ...
+	//   - error: Errors in the offset or length of a slice
+	ExpandList(expr string) ([]string, error)
+
+	// FieldSeparators returns the characters that split the results of
+	// unquoted expansions into fields: the value of IFS.
+	//
+	// Returns:
+	//   - string: The separators; " \t\n" when IFS is unset, and "" to turn
+	//     field splitting off
+	FieldSeparators() string
+
+	// ExpandProcess starts a process substitution and returns the file
+	// name that connects the command to it.
+	//
+	// Parameters:
+	//   - command: The command text from <(...) or >(...)
+	//   - output: true for >(...), whose command reads what is written to
+	//     the file; false for <(...), whose output is read from it
+	//
+	// Returns:
+	//   - string: The file name, such as /dev/fd/63
+	//   - error: Syntax errors in the command
+	ExpandProcess(command string, output bool) (string, error)
+}
+
+// ErrUnclosedExpansion is returned when a ${, $( or ` expansion is not
+// closed before the end of the command line.
+//
+// Example inputs that trigger this error:
+//
+//	echo ${HOME
+//	echo $(date
+//	echo `date
+var ErrUnclosedExpansion = errors.New("unclosed expansion")
+
 // NewDefaultParser creates a new DefaultParser with standard dependencies.
 //
 // The returned parser uses strings.NewReader for reading runes and
@@ -109,7 +362,7 @@ type DefaultParser struct {
 //	fmt.Println(args) // Output: [echo hello world]
 func NewDefaultParser() *DefaultParser {
 	d := &DefaultParser{
-		newReader: func(s string) io.RuneReader {
+		newReader: func(s string) io.RuneScanner {
 			return strings.NewReader(s)
 		},
 		newBuilder: func() *strings.Builder {
@@ -120,26 +373,78 @@ func NewDefaultParser() *DefaultParser {
 	return d
 }
 
+// SetExpander enables "$" expansion using the given Expander.
+//
+// Without an expander the parser treats "$" as an ordinary character, which
+// keeps it usable on its own (for example in tests). The shell installs an
+// expander backed by its variable table.
+//
+// Example:
+//
+//	parser := shell.NewDefaultParser()
+//	parser.SetExpander(myExpander)
+//	args, _ := parser.Parse(`echo "$HOME"`)
+func (p *DefaultParser) SetExpander(expander Expander) {
+	p.expander = expander
+}
+
+// SetAliases enables alias expansion in ParseTree using the given lookup
+// function, which returns the value of an alias and whether it is defined.
+//
+// Without it no word is treated as an alias. The shell installs a lookup
+// backed by its alias table.
+//
+// Example:
+//
+//	parser := shell.NewDefaultParser()
+//	parser.SetAliases(func(name string) (string, bool) {
+//	    value, ok := map[string]string{"ll": "ls -l"}[name]
+//	    return value, ok
+//	})
+//	list, _ := parser.ParseTree("ll /tmp") // runs ls -l /tmp
+func (p *DefaultParser) SetAliases(lookup func(name string) (string, bool)) {
+	p.aliases = lookup
+}
+
 // parseState represents the current parsing context in the state machine.
 //
 // The parser transitions between states as it encounters quotes:
 //   - stateOutside: Not inside any quotes (normal parsing)
 //   - stateSingleQuote: Inside single quotes (literal mode)
 //   - stateDoubleQuote: Inside double quotes (limited escaping)
+//   - stateANSIQuote: Inside $'...' (literal, but a backslash escapes the
+//     next character)
 type parseState int
 
 const (
 	stateOutside parseState = iota
 	stateSingleQuote
 	stateDoubleQuote
+	stateANSIQuote
 )
 
 // tokenBuffer accumulates characters for the current token being parsed.
 //
 // This wrapper around strings.Builder provides token-specific operations
 // like checking emptiness and flushing complete tokens to the result slice.
+//
+// Alongside the token text the buffer keeps a pattern form of the token in
+// which every quoted or escaped pattern character (*, ?, [, ] and \) is
+// backslash-escaped. This preserves the quoting information that quote
+// removal would otherwise lose, so that *.go can be globbed while '*.go'
+// and \*.go stay literal.
 type tokenBuffer struct {
-	builder *strings.Builder
+	builder   *strings.Builder
+	pattern   strings.Builder // Token text with quoted pattern characters escaped
+	hasGlob   bool            // Whether the token has an unquoted *, ? or [
+	hasQuotes bool            // Whether the token has quoted text, which makes it a word even when empty
+	patterns  []tokenPattern  // Pattern forms of the flushed tokens, in order
+}
+
+// tokenPattern is the pattern form of a flushed token.
+type tokenPattern struct {
+	text   string // Token text with quoted pattern characters escaped
+	isGlob bool   // Whether the token is subject to filename expansion
 }
 
 // newTokenBuffer creates a new token accumulator.
@@ -159,185 +464,222 @@ func newTokenBuffer(builder *strings.Builder) *tokenBuffer {
 
 // isEmpty returns true if the buffer contains no characters.
 //
-// This is used to determine whether a token should be flushed.
-// Empty quoted strings ("" or ”) do not trigger a flush.
+// An empty token is still flushed as an empty word when it has quoted text
+// (see hasQuotes), so a pair of empty double or single quotes is a word
+// while an unquoted empty expansion is not.
 func (tokenBuffer *tokenBuffer) isEmpty() bool {
 	return tokenBuffer.builder.Len() == 0
 }
 
-// appendRune adds a single rune to the current token.
+// tildeContext reports whether an unquoted "~" appended now would begin a
+// tilde prefix, and whether that prefix ends at a ":" as well as a "/".
+//
+// A tilde prefix starts a word, or follows the "=" or any ":" in the value
+// of a NAME=value word, as in PATH=~/bin:~alice/bin.
+func (tokenBuffer *tokenBuffer) tildeContext() (isPrefix bool, inAssignment bool) {
+	if tokenBuffer.isEmpty() {
+		return true, false
+	}
+
+	_, value, ok := splitAssignment(tokenBuffer.builder.String())
+
+	if ok && (value == "" || strings.HasSuffix(value, ":")) {
+		return true, true
+	}
+
+	return false, false
+}
+
+// appendRune adds a single unquoted rune to the current token.
 //
 // Parameters:
 //   - r: The rune to append
 func (tokenBuffer *tokenBuffer) appendRune(r rune) {
 	tokenBuffer.builder.WriteRune(r)
+	tokenBuffer.pattern.WriteRune(r)
+
+	if r == '*' || r == '?' || r == '[' {
+		tokenBuffer.hasGlob = true
+	}
 }
 
-// flushIfNotEmpty finalizes the current token and adds it to the arguments slice.
+// appendQuoted adds a single quoted or escaped rune to the current token.
 //
-// If the buffer is empty, no token is added.  After flushing, the buffer
-// is reset for the next token.
+// The rune is taken literally: it is escaped in the token's pattern form so
+// that it never acts as a pattern character.
 //
 // Parameters:
-//   - args: The current slice of parsed arguments
-//
-// Returns:
-//   - []string: Updated arguments slice with the flushed token (if any)
-func (tokenBuffer *tokenBuffer) flushIfNotEmpty(args []string) []string {
-	if !tokenBuffer.isEmpty() {
-		s := tokenBuffer.builder.String()
-		tokenBuffer.builder.Reset()
-		args = append(args, s)
+//   - r: The rune to append
+func (tokenBuffer *tokenBuffer) appendQuoted(r rune) {
+	tokenBuffer.builder.WriteRune(r)
+
+	if strings.ContainsRune(`*?[]\`, r) {
+		tokenBuffer.pattern.WriteRune('\\')
 	}
 
-	return args
+	tokenBuffer.pattern.WriteRune(r)
+}
+
+// appendString adds every rune of s to the current token.
+//
+// Parameters:
+//   - s: The text to append, typically the result of an expansion
+//   - quoted: Whether s appeared inside double quotes, which keeps pattern
+//     characters in it literal
+func (tokenBuffer *tokenBuffer) appendString(s string, quoted bool) {
+	tokenBuffer.hasQuotes = tokenBuffer.hasQuotes || quoted
 
+	for _, r := range s {
+		if quoted {
+			tokenBuffer.appendQuoted(r)
+		} else {
+			tokenBuffer.appendRune(r)
+		}
+	}
 }
 
-// handleStateOutside processes a character when the parser is outside quotes.
+// appendFields splits s into fields at the characters of ifs and adds them
+// to the token stream.
 //
-// In this state:
-//   - Whitespace triggers token completion
-//   - ' begins a single-quoted string
-//   - " begins a double-quoted string
-//   - \ begins an escape sequence
-//   - Other characters are added to the current token
+// The splitting follows POSIX field splitting:
+//   - IFS whitespace (space, tab and newline in ifs) at the start and end
+//     of s is ignored, and a run of it inside s separates two fields
+//   - Every other character of ifs ends a field, together with any IFS
+//     whitespace around it, so two in a row delimit an empty field
+//   - With an empty ifs, s is not split at all
+//
+// The first field joins the current token and the last field stays in the
+// buffer so that following text can join it, as in a$(echo b c)d → "ab",
+// "cd". Leading IFS whitespace in s ends the adjacent token instead, and a
+// leading delimiter ends it even when empty.
 //
 // Parameters:
-//   - ch:  The current character being processed
-//   - currState:  The current parsing state (should be stateOutside)
-//   - tokenBuffer: Buffer for the current token
-//   - isEscaping: Whether the previous character was an unprocessed backslash
-//   - args: Current slice of completed arguments
+//   - s: The unquoted expansion result to split
+//   - ifs: The field separators (see Expander.FieldSeparators)
+//   - args: The current slice of parsed arguments
 //
 // Returns:
-//   - parseState: The new parsing state
-//   - bool: Whether an escape is in progress
-//   - []string: Updated arguments slice
-func handleStateOutside(ch rune, currState parseState, tokenBuffer *tokenBuffer, isEscaping bool, args []string) (parseState, bool, []string) {
+//   - []string: Updated arguments slice with any completed tokens
+//
+// Example (IFS=","):
+//
+//	appendFields("a,,b", ",", args) → "a", "" and "b", with "b" left in the buffer
+func (tokenBuffer *tokenBuffer) appendFields(s string, ifs string, args []string) []string {
+	isWhitespace := func(ch rune) bool {
+		return strings.ContainsRune(" \t\n", ch) && strings.ContainsRune(ifs, ch)
+	}
 
-	if isEscaping {
-		tokenBuffer.appendRune(ch)
-		isEscaping = false
-		return currState, isEscaping, args
+	if ifs == "" {
+		tokenBuffer.appendString(s, false)
+		return args
 	}
 
-	if unicode.IsSpace(ch) {
+	trimmed := strings.TrimLeftFunc(s, isWhitespace)
 
+	if len(trimmed) < len(s) {
 		args = tokenBuffer.flushIfNotEmpty(args)
+	}
 
-	} else if ch == '\'' {
-		currState = stateSingleQuote
+	for i := 0; i < len(trimmed); {
+		ch, size := utf8.DecodeRuneInString(trimmed[i:])
 
-	} else if ch == '"' {
-		currState = stateDoubleQuote
-	} else if ch == '\\' {
-		isEscaping = true
-	} else {
-		tokenBuffer.appendRune(ch)
-	}
+		if !strings.ContainsRune(ifs, ch) {
+			tokenBuffer.appendRune(ch)
+			i += size
+			continue
+		}
 
-	return currState, isEscaping, args
+		// a delimiter is a run of IFS whitespace, or one other IFS
+		// character with the IFS whitespace around it
+		rest := strings.TrimLeftFunc(trimmed[i:], isWhitespace)
+
+		if next, nextSize := utf8.DecodeRuneInString(rest); rest != "" && !isWhitespace(next) && strings.ContainsRune(ifs, next) {
+			rest = strings.TrimLeftFunc(rest[nextSize:], isWhitespace)
+		}
 
+		args = tokenBuffer.flush(args)
+		i = len(trimmed) - len(rest)
+	}
+
+	return args
 }
 
-// handleStateSingleQuote processes a character when inside single quotes.
+// appendList adds the values of a list expansion, such as $@ or
+// ${arr[@]}, to the token stream, one field per value.
 //
-// In single-quoted strings:
-//   - Everything is literal (no escape sequences)
-//   - Only a closing ' exits the quoted string
-//   - Backslashes, double quotes, and whitespace are all literal
+// The first value joins the current token and the last stays in the
+// buffer, so "a$@b" with the parameters 1 and 2 gives "a1" and "2b".
+// Quoted, every value is a word of its own, even when empty; unquoted,
+// each one is split into fields (see appendFields) and empty ones vanish.
 //
 // Parameters:
-//   - ch: The current character being processed
-//   - currState: The current parsing state (should be stateSingleQuote)
-//   - tokenBuffer: Buffer for the current token
-//   - isEscaping:  Escape flag (ignored in single quotes)
-//   - args: Current slice of completed arguments
+//   - values: The values of the expansion
+//   - quoted: Whether the expansion is inside double quotes
+//   - ifs: The field separators for unquoted values
+//   - args: The current slice of parsed arguments
 //
 // Returns:
-//   - parseState: The new parsing state
-//   - bool: Whether an escape is in progress (always false)
-//   - []string: Updated arguments slice
-//
-// Example:
-//
-//	'hello\nworld' → "hello\nworld" (backslash literal, not newline)
-func handleStateSingleQuote(ch rune, currState parseState, tokenBuffer *tokenBuffer, isEscaping bool, args []string) (parseState, bool, []string) {
-
-	if ch == '\'' {
-		currState = stateOutside
+//   - []string: Updated arguments slice with any completed tokens
+func (tokenBuffer *tokenBuffer) appendList(values []string, quoted bool, ifs string, args []string) []string {
+	for i, value := range values {
+		if i > 0 {
+			args = tokenBuffer.flushIfNotEmpty(args)
+		}
 
-	} else {
-		tokenBuffer.appendRune(ch)
+		if quoted {
+			tokenBuffer.appendString(value, true)
+		} else {
+			args = tokenBuffer.appendFields(value, ifs, args)
+		}
 	}
 
-	return currState, isEscaping, args
-
+	return args
 }
 
-// handleStateDoubleQuote processes a character when inside double quotes.
-//
-// In double-quoted strings:
-//   - Backslash escapes \" and \\
-//   - Other backslashes are preserved literally
-//   - Closing " exits the quoted string
-//   - Whitespace is included in the token
+// flushIfNotEmpty finalizes the current token and adds it to the arguments slice.
 //
-// Escape behavior:
-//   - \" → "   (escaped quote)
-//   - \\ → \   (escaped backslash)
-//   - \x → \x  (backslash + x, for any other character x)
+// If the buffer is empty and has no quoted text, no token is added.  After flushing, the buffer
+// is reset for the next token and the token's pattern form is recorded in
+// patterns.
 //
 // Parameters:
-//   - ch: The current character being processed
-//   - currState: The current parsing state (should be stateDoubleQuote)
-//   - tokenBuffer: Buffer for the current token
-//   - isEscaping: Whether the previous character was an unprocessed backslash
-//   - args: Current slice of completed arguments
+//   - args: The current slice of parsed arguments
 //
 // Returns:
-//   - parseState: The new parsing state
-//   - bool: Whether an escape is in progress
-//   - []string: Updated arguments slice
-//
-// Examples:
-//
-//	"hello\"world" → hello"world
-//	"hello\\world" → hello\world
-//	"hello\nworld" → hello\nworld (backslash literal)
-func handleStateDoubleQuote(ch rune, currState parseState, tokenBuffer *tokenBuffer, isEscaping bool, args []string) (parseState, bool, []string) {
-
-	if isEscaping {
-		if ch != '\\' && ch != '"' {
-			tokenBuffer.appendRune('\\')
-		}
-
-		tokenBuffer.appendRune(ch)
-
-		isEscaping = false
-		return currState, isEscaping, args
-
+//   - []string: Updated arguments slice with the flushed token (if any)
+func (tokenBuffer *tokenBuffer) flushIfNotEmpty(args []string) []string {
+	if !tokenBuffer.isEmpty() || tokenBuffer.hasQuotes {
+		args = tokenBuffer.flush(args)
 	}
 
-	if ch == '"' {
-		currState = stateOutside
+	return args
 
-	} else if ch == '\\' {
-		isEscaping = true
-	} else {
-		tokenBuffer.appendRune(ch)
-	}
+}
 
-	return currState, isEscaping, args
+// flush finalizes the current token, even an empty one, and adds it to the
+// arguments slice. Field splitting uses it for the empty field between two
+// delimiters, as in a,,b with IFS=",".
+func (tokenBuffer *tokenBuffer) flush(args []string) []string {
+	s := tokenBuffer.builder.String()
+	tokenBuffer.patterns = append(tokenBuffer.patterns, tokenPattern{
+		text:   tokenBuffer.pattern.String(),
+		isGlob: tokenBuffer.hasGlob,
+	})
 
+	tokenBuffer.builder.Reset()
+	tokenBuffer.pattern.Reset()
+	tokenBuffer.hasGlob = false
+	tokenBuffer.hasQuotes = false
+
+	return append(args, s)
 }
 
 // Parse tokenizes a command line string into arguments using shell quoting rules.
 //
-// The method implements a state machine that tracks whether it's inside quotes
-// and handles escape sequences appropriately for each context.  It processes
-// the input character-by-character (rune-by-rune for Unicode support).
+// Parse is the word-level counterpart of ParseTree: the whole line is read
+// as the words of one command, split at unquoted whitespace only, so
+// operators such as ";" and "|" are ordinary characters. The words are
+// then expanded as by ExpandWords.
 //
 // Parsing rules:
 //
@@ -358,11 +700,60 @@ func handleStateDoubleQuote(ch rune, currState parseState, tokenBuffer *tokenBuf
 //   - Example: "say \"hi\"" → "say "hi""
 //   - Example: "path\\to\\file" → "path\to\file"
 //
+// ANSI-C quotes (outside double quotes):
+//   - $'...' is literal like single quotes, but backslash escapes such as
+//     \n, \t, \xHH, \uHHHH and \NNN are decoded (see decodeEscapes)
+//   - \' puts a single quote inside the string
+//   - Example: $'a\tb' → "a<TAB>b"
+//   - Example: $'it\'s' → "it's"
+//
 // Backslash (outside quotes):
 //   - Escapes the next character
 //   - Example: hello\ world → "hello world"
 //   - Example: \$ → "$"
 //
+// Parameter expansion (only when an Expander is set):
+//   - $name and ${name} are replaced by the expander's value
+//   - Expanded outside quotes and inside double quotes
+//   - Literal inside single quotes or when escaped as \$
+//   - Example: "$HOME/src" → "/home/user/src"
+//   - Example: '$HOME' → "$HOME"
+//
+// Command substitution (only when an Expander is set):
+//   - $(cmd) and `cmd` are replaced by the output of cmd
+//   - Substitutions nest: $(echo $(date))
+//   - Example: echo $(echo a  b) → ["echo", "a", "b"]
+//   - Example: echo "$(echo a  b)" → ["echo", "a  b"]
+//
+// Arithmetic expansion (only when an Expander is set):
+//   - $((expr)) is replaced by the value of the integer expression
+//   - Example: echo $((2 * 21)) → ["echo", "42"]
+//
+// Field splitting (only when an Expander is set):
+//   - Unquoted results of parameter expansion, command substitution and
+//     arithmetic expansion are split into fields at the characters of
+//     the expander's FieldSeparators (IFS); see appendFields
+//   - Results inside double quotes stay a single token, and an empty IFS
+//     turns splitting off
+//   - Example (IFS=","): x=a,b; echo $x "$x" → ["echo", "a", "b", "a,b"]
+//
+// Brace expansion:
+//   - Runs on the raw line before any other expansion (see expandBraces)
+//   - Unquoted {a,b} and {x..y[..step]} produce one word per item
+//   - Example: mkdir dir/{src,test} → ["mkdir", "dir/src", "dir/test"]
+//   - Example: echo "{a,b}" → ["echo", "{a,b}"]
+//
+// Tilde expansion (only when an Expander is set):
+//   - An unquoted ~ at the start of a word, or after the = or a : of a
+//     NAME=value word, is replaced by a home directory
+//   - ~ is $HOME, ~user is the home of user, ~+ is $PWD and ~- is $OLDPWD
+//   - Example: ls ~/src → ["ls", "/home/user/src"]
+//   - Example: PATH=~/bin:~/go/bin → ["PATH=/home/user/bin:/home/user/go/bin"]
+//
+// Filename expansion (only when an Expander is set):
+//   - Words with unquoted *, ? or [ are passed to the expander's ExpandGlob
+//   - Example: ls *.go → ["ls", "main.go", "shell.go"]
+//
 // Empty input:
 //   - Returns empty slice (not an error)
 //
@@ -373,7 +764,8 @@ func handleStateDoubleQuote(ch rune, currState parseState, tokenBuffer *tokenBuf
 //   - []string: Slice of parsed arguments/tokens
 //   - error: ErrUnclosedQuote if quotes aren't balanced,
 //     ErrUnescapedCharacter if line ends with backslash,
-//     or I/O errors from the rune reader
+//     ErrUnclosedExpansion if a ${, $(, $(( or ` is never closed,
+//     errors from the Expander, or I/O errors from the rune reader
 //
 // Examples:
 //
@@ -386,48 +778,848 @@ func handleStateDoubleQuote(ch rune, currState parseState, tokenBuffer *tokenBuf
 //
 // The parser maintains no state between calls - each invocation is independent.
 func (p *DefaultParser) Parse(line string) ([]string, error) {
-	runeReader := p.newReader(line)
-	tokenBuffer := newTokenBuffer(p.newBuilder())
+	words, err := p.lexFields(expandBraces(line))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return p.expandFields(words)
+}
+
+// ExpandWords expands the words of a command into the arguments it runs
+// with.
+//
+// Every word undergoes, in order, brace expansion, tilde expansion,
+// parameter and arithmetic expansion and command substitution, field
+// splitting of unquoted expansion results by IFS, quote removal and filename
+// expansion, following the rules described for Parse. A word can produce
+// any number of arguments: "$(true)" and an unquoted empty variable
+// produce none, while *.go or {a,b} may produce several.
+//
+// Parameters:
+//   - words: The words of a command, as produced by ParseTree
+//
+// Returns:
+//   - []string: The expanded arguments
+//   - error: Errors from the Expander
+//
+// Example:
+//
+//	list, _ := parser.ParseTree(`echo {a,b}-"$USER" '*'`)
+//	command := list.Pipelines[0].Commands[0].(*SimpleCommand)
+//	parser.ExpandWords(command.Words) // → ["echo", "a-alice", "b-alice", "*"]
+func (p *DefaultParser) ExpandWords(words []*Word) ([]string, error) {
+	expanded := make([]*Word, 0, len(words))
+
+	for _, word := range words {
+		alternatives := expandBraceWord(word.Raw)
+
+		if len(alternatives) == 1 {
+			expanded = append(expanded, word)
+			continue
+		}
+
+		for _, alternative := range alternatives {
+			braced, err := p.lexText(alternative)
+
+			if err != nil {
+				return nil, err
+			}
+
+			expanded = append(expanded, braced)
+		}
+	}
 
+	return p.expandFields(expanded)
+}
+
+// expandFields expands words whose braces have already been expanded,
+// then globs the results.
+func (p *DefaultParser) expandFields(words []*Word) ([]string, error) {
+	tokenBuffer := newTokenBuffer(p.newBuilder())
 	args := []string{}
 
+	for _, word := range words {
+		var err error
+		args, err = p.expandWord(word, tokenBuffer, args, true)
+
+		if err != nil {
+			return nil, err
+		}
+
+		args = tokenBuffer.flushIfNotEmpty(args)
+	}
+
+	if p.expander == nil {
+		return args, nil
+	}
+
+	return p.expandGlobs(args, tokenBuffer.patterns)
+}
+
+// expandGlobs replaces every token that contains unquoted pattern characters
+// with the words returned by the expander's ExpandGlob.
+func (p *DefaultParser) expandGlobs(args []string, patterns []tokenPattern) ([]string, error) {
+	expanded := make([]string, 0, len(args))
+
+	for i, arg := range args {
+		if !patterns[i].isGlob {
+			expanded = append(expanded, arg)
+			continue
+		}
+
+		words, err := p.expander.ExpandGlob(patterns[i].text)
+
+		if err != nil {
+			return nil, err
+		}
+
+		expanded = append(expanded, words...)
+	}
+
+	return expanded, nil
+}
+
+// ExpandWord applies quote removal and expansion to a single word without
+// splitting it on whitespace.
+//
+// This is used for text that is already known to form one word, such as the
+// default value in ${var:-some text}: quotes and escapes are processed and
+// "$" expansions are resolved exactly as in Parse, but unquoted whitespace
+// is kept instead of separating tokens.
+//
+// Parameters:
+//   - text: The raw word text
+//
+// Returns:
+//   - string: The expanded word
+//   - error: Same errors as Parse
+//
+// Example:
+//
+//	parser.ExpandWord(`"$HOME"/my docs`) → "/home/user/my docs"
+func (p *DefaultParser) ExpandWord(text string) (string, error) {
+	word, err := p.lexText(text)
+
+	if err != nil {
+		return "", err
+	}
+
+	value, _, err := p.expandSingleWord(word)
+	return value, err
+}
+
+// ExpandPattern expands a single word like ExpandWord, but returns it in
+// pattern form: characters that were quoted or escaped in text are
+// backslash-escaped so that matchPattern treats them literally.
+//
+// This is used for the patterns of ${var#pattern} and friends, where
+// ${file%'.*'} must remove a literal ".*" rather than any extension.
+//
+// Parameters:
+//   - text: The raw pattern text
+//
+// Returns:
+//   - string: The expanded pattern
+//   - error: Same errors as Parse
+//
+// Example:
+//
+//	parser.ExpandPattern(`"*".txt*`) → `\*.txt*`
+func (p *DefaultParser) ExpandPattern(text string) (string, error) {
+	word, err := p.lexText(text)
+
+	if err != nil {
+		return "", err
+	}
+
+	_, pattern, err := p.expandSingleWord(word)
+	return pattern, err
+}
+
+// expandSingleWord expands word without field splitting or filename
+// expansion, as for assignment values, case words and here-strings. A
+// quoted "$@" or "${arr[@]}" gives its values joined by spaces, as "$*"
+// does with the default IFS.
+//
+// Returns:
+//   - string: The expanded word
+//   - string: The expanded word in pattern form (see ExpandPattern)
+//   - error: Errors from the Expander
+func (p *DefaultParser) expandSingleWord(word *Word) (string, string, error) {
+	tokenBuffer := newTokenBuffer(p.newBuilder())
+
+	args, err := p.expandWord(word, tokenBuffer, nil, false)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	args = tokenBuffer.flushIfNotEmpty(args)
+
+	if len(args) == 0 {
+		return "", "", nil
+	}
+
+	return args[0], tokenBuffer.patterns[0].text, nil
+}
+
+// expandRedirectTarget expands the file name of a redirection: a single
+// word, without field splitting, that then undergoes filename expansion. A
+// pattern must match exactly one file; one that matches nothing is kept as
+// it is, unless nullglob or failglob is set.
+//
+// Returns:
+//   - string: The expanded target
+//   - error: Errors from the Expander, or an *ExpansionError wrapping
+//     ErrAmbiguousRedirect when the pattern does not give a single word
+func (p *DefaultParser) expandRedirectTarget(word *Word) (string, error) {
+	tokenBuffer := newTokenBuffer(p.newBuilder())
+
+	args, err := p.expandWord(word, tokenBuffer, nil, false)
+
+	if err != nil {
+		return "", err
+	}
+
+	args = tokenBuffer.flushIfNotEmpty(args)
+
+	if len(args) == 0 || p.expander == nil {
+		return strings.Join(args, ""), nil
+	}
+
+	targets, err := p.expandGlobs(args, tokenBuffer.patterns)
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(targets) != 1 {
+		return "", &ExpansionError{Param: word.Raw, Err: ErrAmbiguousRedirect}
+	}
+
+	return targets[0], nil
+}
+
+// expandWord appends the expansion of word's parts to tokenBuffer.
+//
+// Quoted and escaped text is appended as quoted, so it is never globbed.
+// Unquoted literals are appended as they are, with tilde prefixes
+// expanded. Expansions are resolved with the expander; an unquoted result
+// is split into fields by IFS when splitFields is true, which may complete
+// tokens and append them to args.
+//
+// Without an expander, expansions are copied verbatim from the source.
+//
+// Parameters:
+//   - word: The word to expand
+//   - tokenBuffer: Buffer holding the current token
+//   - args: Tokens completed so far
+//   - splitFields: Whether unquoted expansion results are split
+//
+// Returns:
+//   - []string: args with any tokens completed by field splitting
+//   - error: Errors from the Expander
+func (p *DefaultParser) expandWord(word *Word, tokenBuffer *tokenBuffer, args []string, splitFields bool) ([]string, error) {
+	for i, part := range word.Parts {
+		switch part := part.(type) {
+		case *Literal:
+			if part.Escaped {
+				tokenBuffer.appendString(part.Value, true)
+				continue
+			}
+
+			// a tilde prefix must end before the next part, since a quoted
+			// or escaped character cannot belong to it
+			p.expandLiteral(part.Value, tokenBuffer, i == len(word.Parts)-1)
+
+		case *SingleQuoted:
+			tokenBuffer.appendString(part.Value, true)
+
+		case *ArrayLiteral:
+			// outside an assignment, NAME=(...) is passed on as written,
+			// for declare and local to assign
+			tokenBuffer.appendString("("+part.Text+")", true)
+
+		case *DoubleQuoted:
+			// "" is an empty word of its own
+			if len(part.Parts) == 0 {
+				tokenBuffer.appendString("", true)
+			}
+
+			for _, inner := range part.Parts {
+				switch inner := inner.(type) {
+				case *Literal:
+					tokenBuffer.appendString(inner.Value, true)
+
+				case *Expansion:
+					// "$@" and "${arr[@]}" are one word per value, and no
+					// word without any; in a word that is not split, such
+					// as x="$@", the values are joined with spaces instead
+					if list, ok := p.listExpansion(inner); ok && !list.joined && splitFields {
+						values, err := p.expander.ExpandList(inner.Text)
+
+						if err != nil {
+							return nil, err
+						}
+
+						args = tokenBuffer.appendList(values, true, "", args)
+						continue
+					}
+
+					value, err := p.expandValue(inner)
+
+					if err != nil {
+						return nil, err
+					}
+
+					tokenBuffer.appendString(value, true)
+				}
+			}
+
+		case *Expansion:
+			// unquoted $@, $* and ${arr[@]} are split per value
+			if _, ok := p.listExpansion(part); ok && splitFields {
+				values, err := p.expander.ExpandList(part.Text)
+
+				if err != nil {
+					return nil, err
+				}
+
+				args = tokenBuffer.appendList(values, false, p.expander.FieldSeparators(), args)
+				continue
+			}
+
+			value, err := p.expandValue(part)
+
+			if err != nil {
+				return nil, err
+			}
+
+			// unquoted expansion results are split into fields by IFS
+			if splitFields && p.expander != nil {
+				args = tokenBuffer.appendFields(value, p.expander.FieldSeparators(), args)
+			} else {
+				tokenBuffer.appendString(value, false)
+			}
+		}
+	}
+
+	return args, nil
+}
+
+// expandLiteral appends an unquoted literal to tokenBuffer, expanding the
+// tilde prefixes in it.
+//
+// A "~" begins a tilde prefix at the start of a word, or after the "=" or
+// a ":" in the value of a NAME=value word (see tokenBuffer.tildeContext).
+// The prefix is the run of login-name characters (plus "+" and "-") after
+// the "~". It is only expanded when it is followed by a "/", whitespace
+// (or, inside an assignment, a ":"), or ends the literal when the literal
+// ends the word; otherwise, or when the expander does not know the prefix,
+// the text is appended literally. An expanded directory is appended as
+// quoted text, so it is never split or globbed.
+//
+// Parameters:
+//   - value: The literal text
+//   - tokenBuffer: Buffer holding the current token
+//   - endsWord: Whether the literal is the last part of its word
+func (p *DefaultParser) expandLiteral(value string, tokenBuffer *tokenBuffer, endsWord bool) {
+	for i := 0; i < len(value); {
+		ch, size := utf8.DecodeRuneInString(value[i:])
+		i += size
+
+		isPrefix, inAssignment := tokenBuffer.tildeContext()
+
+		if ch != '~' || p.expander == nil || !isPrefix {
+			tokenBuffer.appendRune(ch)
+			continue
+		}
+
+		end := strings.IndexFunc(value[i:], func(ch rune) bool { return !isTildePrefixRune(ch) })
+
+		if end < 0 {
+			end = len(value) - i
+		}
+
+		prefix := value[i : i+end]
+		rest := value[i+end:]
+		isTerminated := rest == "" && endsWord
+
+		if rest != "" {
+			next, _ := utf8.DecodeRuneInString(rest)
+			isTerminated = next == '/' || unicode.IsSpace(next) || (inAssignment && next == ':')
+		}
+
+		if isTerminated {
+			if dir, ok := p.expander.ExpandTilde(prefix); ok {
+				tokenBuffer.appendString(dir, true)
+				i += end
+				continue
+			}
+		}
+
+		tokenBuffer.appendRune(ch)
+	}
+}
+
+// isTildePrefixRune reports whether ch may appear in a tilde prefix: a
+// portable login-name character, or the "+" and "-" of ~+ and ~-.
+func isTildePrefixRune(ch rune) bool {
+	return ch < unicode.MaxASCII && (unicode.IsLetter(ch) || unicode.IsDigit(ch) || strings.ContainsRune("._-+", ch))
+}
+
+// listExpansion reports whether expansion is one of the list forms, such
+// as $@ or ${arr[@]}, that the expander's ExpandList resolves.
+func (p *DefaultParser) listExpansion(expansion *Expansion) (listExpansion, bool) {
+	if p.expander == nil || expansion.Kind != ParameterExpansion {
+		return listExpansion{}, false
+	}
+
+	return parseListExpansion(expansion.Text)
+}
+
+// expandValue resolves an expansion with the expander:
+//   - ParameterExpansion: The name or ${...} body goes to ExpandParameter
+//   - CommandSubstitution: The command goes to ExpandCommand
+//   - ArithmeticExpansion: The expression goes to ExpandArithmetic
+//   - ProcessSubstitution: The command goes to ExpandProcess
+//
+// Without an expander the expansion's source text is returned unchanged.
+func (p *DefaultParser) expandValue(expansion *Expansion) (string, error) {
+	if p.expander == nil {
+		return expansion.Raw, nil
+	}
+
+	switch expansion.Kind {
+	case CommandSubstitution:
+		return p.expander.ExpandCommand(expansion.Text)
+	case ArithmeticExpansion:
+		return p.expander.ExpandArithmetic(expansion.Text)
+	case ProcessSubstitution:
+		return p.expander.ExpandProcess(expansion.Text, strings.HasPrefix(expansion.Raw, ">"))
+	default:
+		return p.expander.ExpandParameter(expansion.Text)
+	}
+}
+
+// readBraced reads the body of a ${...} expansion up to its matching "}".
+//
+// Nested braces are balanced, so ${a:-${b}} returns "a:-${b}". Quoted text
+// inside the braces is copied verbatim and may contain "}".
+//
+// Parameters:
+//   - runeReader: Reader positioned just after "${"
+//
+// Returns:
+//   - string: The text between the braces
+//   - error: ErrUnclosedExpansion if the line ends first
+func readBraced(runeReader io.RuneScanner) (string, error) {
+	var body strings.Builder
+
+	depth := 1
 	currState := stateOutside
 	isEscaping := false
+	afterDollar := false
 
 	for {
 		ch, _, err := runeReader.ReadRune()
 
 		if err == io.EOF {
-			break
+			return "", ErrUnclosedExpansion
 		}
 
 		if err != nil {
-			return nil, err
+			return "", err
+		}
+
+		isDollarQuote := afterDollar && ch == '\''
+		afterDollar = false
+
+		switch {
+		case isEscaping:
+			isEscaping = false
+		case currState == stateSingleQuote:
+			if ch == '\'' {
+				currState = stateOutside
+			}
+		case currState == stateANSIQuote:
+			if ch == '\\' {
+				isEscaping = true
+			} else if ch == '\'' {
+				currState = stateOutside
+			}
+		case ch == '\\':
+			isEscaping = true
+		case currState == stateDoubleQuote:
+			if ch == '"' {
+				currState = stateOutside
+			}
+		case ch == '$':
+			afterDollar = true
+		case isDollarQuote:
+			currState = stateANSIQuote
+		case ch == '\'':
+			currState = stateSingleQuote
+		case ch == '"':
+			currState = stateDoubleQuote
+		case ch == '{':
+			depth++
+		case ch == '}':
+			depth--
+			if depth == 0 {
+				return body.String(), nil
+			}
+		}
+
+		body.WriteRune(ch)
+	}
+}
+
+// readParenthesized reads the body of a $(...) substitution up to its
+// matching ")".
+//
+// Nested parentheses are balanced and quoted text is copied verbatim, so
+// $(echo "(" $(date)) returns `echo "(" $(date)`. A ")" that would close
+// the substitution only does so if the command in it cannot take the ")"
+// (see closesSubstitution), so the patterns of a case command are kept:
+// $(case $x in a) echo A;; esac) returns `case $x in a) echo A;; esac`.
+//
+// Parameters:
+//   - runeReader: Reader positioned just after "$("
+//
+// Returns:
+//   - string: The text between the parentheses
+//   - error: ErrUnclosedExpansion if the line ends first
+func readParenthesized(runeReader io.RuneScanner) (string, error) {
+	var body strings.Builder
+
+	depth := 1
+	currState := stateOutside
+	isEscaping := false
+	afterDollar := false
+
+	for {
+		ch, _, err := runeReader.ReadRune()
+
+		if err == io.EOF {
+			return "", ErrUnclosedExpansion
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		isDollarQuote := afterDollar && ch == '\''
+		afterDollar = false
+
+		switch {
+		case isEscaping:
+			isEscaping = false
+		case currState == stateSingleQuote:
+			if ch == '\'' {
+				currState = stateOutside
+			}
+		case currState == stateANSIQuote:
+			if ch == '\\' {
+				isEscaping = true
+			} else if ch == '\'' {
+				currState = stateOutside
+			}
+		case ch == '\\':
+			isEscaping = true
+		case currState == stateDoubleQuote:
+			if ch == '"' {
+				currState = stateOutside
+			}
+		case ch == '$':
+			afterDollar = true
+		case isDollarQuote:
+			currState = stateANSIQuote
+		case ch == '\'':
+			currState = stateSingleQuote
+		case ch == '"':
+			currState = stateDoubleQuote
+		case ch == '(':
+			depth++
+		case ch == ')':
+			depth--
+			if depth <= 0 && closesSubstitution(body.String()) {
+				return body.String(), nil
+			}
+		}
+
+		body.WriteRune(ch)
+	}
+}
+
+// closesSubstitution reports whether a ")" after body, the text of a
+// substitution read so far, is the end of the substitution rather than
+// part of a command in it, such as the end of a case pattern. It is the
+// end when the parser fails on that ")" or earlier; a syntax error in
+// body is reported once the substitution runs.
+func closesSubstitution(body string) bool {
+	_, err := NewDefaultParser().ParseTree(body + ")")
+
+	var parseErr *ParseError
+
+	if errors.As(err, &parseErr) {
+		return parseErr.Position.Offset <= len(body)
+	}
+
+	return err != nil
+}
+
+// readArithmetic reads the body of a $((...)) expansion or ((...)) command
+// up to the matching "))".
+//
+// Parentheses inside the expression are balanced, so $(( (1+2) * 3 ))
+// returns " (1+2) * 3 ".
+//
+// Parameters:
+//   - runeReader: Reader positioned just after "(("
+//
+// Returns:
+//   - string: The expression text
+//   - error: ErrUnclosedExpansion if the line ends first, or if a ")" at the
+//     outer level is not immediately followed by another ")"
+func readArithmetic(runeReader io.RuneScanner) (string, error) {
+	var body strings.Builder
+
+	depth := 0
+
+	for {
+		ch, _, err := runeReader.ReadRune()
+
+		if err == io.EOF {
+			return "", ErrUnclosedExpansion
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		if ch == '(' {
+			depth++
+		}
+
+		if ch == ')' {
+			if depth == 0 {
+				next, _, err := runeReader.ReadRune()
+
+				if err != nil || next != ')' {
+					return "", ErrUnclosedExpansion
+				}
+
+				return body.String(), nil
+			}
+
+			depth--
+		}
+
+		body.WriteRune(ch)
+	}
+}
+
+// readBackquoted reads the body of a `...` substitution up to the closing
+// backquote.
+//
+// Inside backquotes a backslash only escapes "$", "`" and "\\"; the
+// backslash is removed for those and kept for anything else, so the
+// returned text is the command exactly as $(...) would contain it.
+//
+// Parameters:
+//   - runeReader: Reader positioned just after the opening "`"
+//
+// Returns:
+//   - string: The command text between the backquotes
+//   - error: ErrUnclosedExpansion if the line ends first
+func readBackquoted(runeReader io.RuneScanner) (string, error) {
+	var body strings.Builder
+
+	isEscaping := false
+
+	for {
+		ch, _, err := runeReader.ReadRune()
+
+		if err == io.EOF {
+			return "", ErrUnclosedExpansion
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		if isEscaping {
+			if ch != '$' && ch != '`' && ch != '\\' {
+				body.WriteRune('\\')
+			}
+			body.WriteRune(ch)
+			isEscaping = false
+			continue
+		}
+
+		if ch == '\\' {
+			isEscaping = true
+			continue
+		}
+
+		if ch == '`' {
+			return body.String(), nil
+		}
+
+		body.WriteRune(ch)
+	}
+}
+
+// isNameStart reports whether ch may begin a variable name.
+func isNameStart(ch rune) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+// splitOnOperators splits a command line at every unquoted occurrence of one
+// of the given operators.
+//
+// The scan follows the same quoting rules as DefaultParser: operators inside
+// single or double quotes, inside an expansion or ((...)) arithmetic, or
+// preceded by a backslash, are part of the surrounding text. Operators are matched in the order given, so longer
+// operators that share a prefix with shorter ones must be listed first
+// (for example "||" before "|").
+//
+// The segments are returned verbatim, quotes and escapes included, so that
+// each one can be handed to Parse on its own. Unbalanced quotes are not
+// reported here; they surface when the final segment is parsed.
+//
+// Parameters:
+//   - line: The raw command line to split
+//   - operators: Operators to split on, in priority order
+//
+// Returns:
+//   - []string: The text between operators (always len(ops)+1 entries)
+//   - []string: The operators found, in order of appearance
+//
+// Example:
+//
+//	splitOnOperators(`ls | grep "a|b"`, []string{"|"})
+//	// → []string{"ls ", ` grep "a|b"`}, []string{"|"}
+func splitOnOperators(line string, operators []string) ([]string, []string) {
+	segments := []string{}
+	found := []string{}
+
+	runeReader := strings.NewReader(line)
+	currState := stateOutside
+	isEscaping := false
+	start := 0
+
+	for {
+		pos := len(line) - runeReader.Len()
+		ch, _, err := runeReader.ReadRune()
+
+		if err != nil {
+			break
+		}
+
+		if isEscaping {
+			isEscaping = false
+			continue
+		}
+
+		// operators inside ${...}, $(...) and `...` belong to the expansion;
+		// malformed expansions are reported later by Parse
+		if currState == stateOutside && ch == '$' && strings.HasPrefix(line[pos+1:], "'") {
+			runeReader.ReadRune()
+			currState = stateANSIQuote
+			continue
+		}
+
+		if (currState == stateOutside || currState == stateDoubleQuote) && (ch == '$' || ch == '`') {
+			skipExpansion(runeReader, ch)
+			continue
 		}
 
 		switch currState {
 		case stateOutside:
-			currState, isEscaping, args = handleStateOutside(ch, currState, tokenBuffer, isEscaping, args)
+			if ch == '\\' {
+				isEscaping = true
+			} else if ch == '\'' {
+				currState = stateSingleQuote
+			} else if ch == '"' {
+				currState = stateDoubleQuote
+			} else if strings.HasPrefix(line[pos:], "((") {
+				// operators inside ((...)) belong to the arithmetic expression
+				runeReader.ReadRune()
+				readArithmetic(runeReader)
+			} else if op := matchOperator(line[pos:], operators); op != "" {
+				segments = append(segments, line[start:pos])
+				found = append(found, op)
+				start = pos + len(op)
+				runeReader.Seek(int64(start), io.SeekStart)
+			}
 
 		case stateSingleQuote:
-			currState, isEscaping, args = handleStateSingleQuote(ch, currState, tokenBuffer, isEscaping, args)
+			if ch == '\'' {
+				currState = stateOutside
+			}
 
 		case stateDoubleQuote:
-			currState, isEscaping, args = handleStateDoubleQuote(ch, currState, tokenBuffer, isEscaping, args)
+			if ch == '\\' {
+				isEscaping = true
+			} else if ch == '"' {
+				currState = stateOutside
+			}
+
+		case stateANSIQuote:
+			if ch == '\\' {
+				isEscaping = true
+			} else if ch == '\'' {
+				currState = stateOutside
+			}
 		}
+	}
+
+	segments = append(segments, line[start:])
+
+	return segments, found
+}
 
+// skipExpansion advances runeReader past the expansion introduced by ch
+// ("$" or "`"), leaving it positioned after the closing delimiter. A "$"
+// that does not start ${...} or $(...) is left alone.
+//
+// The error is ErrUnclosedExpansion when the text ends before the expansion
+// is closed; most callers ignore it and let Parse report the problem.
+func skipExpansion(runeReader io.RuneScanner, ch rune) error {
+	if ch == '`' {
+		_, err := readBackquoted(runeReader)
+		return err
 	}
 
-	if currState == stateSingleQuote || currState == stateDoubleQuote {
-		return nil, ErrUnclosedQuote
+	next, _, err := runeReader.ReadRune()
+
+	if err != nil {
+		return nil
 	}
 
-	if isEscaping {
-		return nil, ErrUnescapedCharacter
+	switch next {
+	case '{':
+		_, err = readBraced(runeReader)
+	case '(':
+		_, err = readParenthesized(runeReader)
+	default:
+		runeReader.UnreadRune()
 	}
 
-	args = tokenBuffer.flushIfNotEmpty(args)
+	return err
+}
 
-	return args, nil
+// matchOperator returns the first operator that prefixes s, or "" if none do.
+func matchOperator(s string, operators []string) string {
+	for _, op := range operators {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
 
+	return ""
 }
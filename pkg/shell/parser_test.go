@@ -2,6 +2,7 @@ package shell
 
 import (
 	"errors"
+	"strings"
 	"testing"
 )
 
@@ -105,9 +106,9 @@ func TestParser_Parse(t *testing.T) {
 			expectedErr: ErrUnescapedCharacter,
 		},
 		{
-			name:        "empty quotes",
+			name:        "empty quotes are empty words",
 			input:       `echo "" ''`,
-			expected:    []string{"echo"},
+			expected:    []string{"echo", "", ""},
 			expectedErr: nil,
 		},
 		{
@@ -122,6 +123,30 @@ func TestParser_Parse(t *testing.T) {
 			expected:    []string{"grep", "pattern", "file.txt"},
 			expectedErr: nil,
 		},
+		{
+			name:        "ANSI-C quoted string",
+			input:       `printf $'a\tb\n' $'it\'s' x$'\x41'y`,
+			expected:    []string{"printf", "a\tb\n", "it's", "xAy"},
+			expectedErr: nil,
+		},
+		{
+			name:        "ANSI-C quoting only outside double quotes",
+			input:       `echo "$'a\tb'"`,
+			expected:    []string{"echo", `$'a\tb'`},
+			expectedErr: nil,
+		},
+		{
+			name:        "ANSI-C quoted operators and blanks",
+			input:       `echo $'a | b;c'`,
+			expected:    []string{"echo", "a | b;c"},
+			expectedErr: nil,
+		},
+		{
+			name:        "unclosed ANSI-C quote",
+			input:       `echo $'a\'`,
+			expected:    nil,
+			expectedErr: ErrUnclosedQuote,
+		},
 	}
 
 	for _, tt := range tests {
@@ -174,3 +199,434 @@ func equalStringSlices(a, b []string) bool {
 	}
 	return true
 }
+
+// mapExpander resolves parameters from a fixed map for parser tests.
+// Command substitutions expand to the command text itself and arithmetic
+// expansions to the parenthesized expression. Glob words expand to their pattern
+// form in angle brackets, and tilde prefixes resolve from "~prefix" keys.
+// Lists such as $@ and ${a[@]} are the blank-separated fields of their key,
+// with $* reading "@", and the field separators come from the "IFS" key
+// when it is present. Process substitutions expand to a /dev/fd name
+// holding the direction and the command.
+type mapExpander map[string]string
+
+func (m mapExpander) ExpandParameter(expr string) (string, error) {
+	return m[expr], nil
+}
+
+func (m mapExpander) ExpandCommand(command string) (string, error) {
+	return command, nil
+}
+
+func (m mapExpander) ExpandArithmetic(expr string) (string, error) {
+	return "(" + expr + ")", nil
+}
+
+func (m mapExpander) ExpandGlob(pattern string) ([]string, error) {
+	return []string{"<" + pattern + ">"}, nil
+}
+
+func (m mapExpander) ExpandTilde(prefix string) (string, bool) {
+	dir, ok := m["~"+prefix]
+	return dir, ok
+}
+
+func (m mapExpander) ExpandList(expr string) ([]string, error) {
+	if expr == "*" {
+		expr = "@"
+	}
+	return strings.Fields(m[expr]), nil
+}
+
+func (m mapExpander) FieldSeparators() string {
+	if ifs, ok := m["IFS"]; ok {
+		return ifs
+	}
+	return " \t\n"
+}
+
+func (m mapExpander) ExpandProcess(command string, output bool) (string, error) {
+	if output {
+		return "/dev/fd/out:" + command, nil
+	}
+	return "/dev/fd/in:" + command, nil
+}
+
+func TestParser_ParseExpansion(t *testing.T) {
+
+	vars := mapExpander{
+		"HOME": "/home/user", "NAME": "world", "SPACED": "a b",
+		"~": "/home/user", "~root": "/root", "~+": "/work", "~-": "/old[1]",
+	}
+
+	tests := []struct {
+		name        string
+		input       string
+		expected    []string
+		expectedErr error
+	}{
+		{
+			name:     "plain variable",
+			input:    "echo $NAME",
+			expected: []string{"echo", "world"},
+		},
+		{
+			name:     "braced variable joined to text",
+			input:    "echo ${NAME}ly",
+			expected: []string{"echo", "worldly"},
+		},
+		{
+			name:     "variable inside double quotes",
+			input:    `echo "$HOME/src"`,
+			expected: []string{"echo", "/home/user/src"},
+		},
+		{
+			name:     "variable inside single quotes is literal",
+			input:    `echo '$HOME'`,
+			expected: []string{"echo", "$HOME"},
+		},
+		{
+			name:     "escaped dollar outside quotes",
+			input:    `echo \$HOME`,
+			expected: []string{"echo", "$HOME"},
+		},
+		{
+			name:     "escaped dollar inside double quotes",
+			input:    `echo "\$HOME"`,
+			expected: []string{"echo", "$HOME"},
+		},
+		{
+			name:     "unset variable disappears",
+			input:    "echo $UNSET end",
+			expected: []string{"echo", "end"},
+		},
+		{
+			name:     "unquoted expansion result is split",
+			input:    "echo $SPACED",
+			expected: []string{"echo", "a", "b"},
+		},
+		{
+			name:     "lone dollar is literal",
+			input:    "echo $ 5$",
+			expected: []string{"echo", "$", "5$"},
+		},
+		{
+			name:     "unquoted command substitution is split",
+			input:    "echo $(a  b)",
+			expected: []string{"echo", "a", "b"},
+		},
+		{
+			name:     "quoted command substitution is one token",
+			input:    `echo "$(a  b)"`,
+			expected: []string{"echo", "a  b"},
+		},
+		{
+			name:     "substitution fields join surrounding text",
+			input:    "echo x$(a b)y",
+			expected: []string{"echo", "xa", "by"},
+		},
+		{
+			name:     "backquotes",
+			input:    "echo `a b`",
+			expected: []string{"echo", "a", "b"},
+		},
+		{
+			name:     "nested substitution text is kept intact",
+			input:    `echo "$(a $(b) ")")"`,
+			expected: []string{"echo", `a $(b) ")"`},
+		},
+		{
+			name:     "case patterns in a substitution",
+			input:    `echo "$(case x in a) b;; (c) d;; esac)"`,
+			expected: []string{"echo", "case x in a) b;; (c) d;; esac"},
+		},
+		{
+			name:     "case patterns in a subshell in a substitution",
+			input:    `echo "$( (case x in a) b;; esac) )"`,
+			expected: []string{"echo", " (case x in a) b;; esac) "},
+		},
+		{
+			name:     "substitution in single quotes is literal",
+			input:    `echo '$(a)'`,
+			expected: []string{"echo", "$(a)"},
+		},
+		{
+			name:     "arithmetic expansion",
+			input:    `echo "$((1 + (2 - 3)))"`,
+			expected: []string{"echo", "(1 + (2 - 3))"},
+		},
+		{
+			name:     "arithmetic result is split",
+			input:    "echo $((a b))",
+			expected: []string{"echo", "(a", "b)"},
+		},
+		{
+			name:     "process substitution",
+			input:    "diff <(sort) >(wc)",
+			expected: []string{"diff", "/dev/fd/in:sort", "/dev/fd/out:wc"},
+		},
+		{
+			name:     "quoted process substitution is literal",
+			input:    `echo "<(a)" \<\(b\)`,
+			expected: []string{"echo", "<(a)", "<(b)"},
+		},
+		{
+			name:     "unquoted star is globbed",
+			input:    "ls *.go",
+			expected: []string{"ls", "<*.go>"},
+		},
+		{
+			name:     "quoted star is not globbed",
+			input:    `ls '*.go' "a?" \[x]`,
+			expected: []string{"ls", "*.go", "a?", "[x]"},
+		},
+		{
+			name:     "quoted pattern characters are escaped in a glob",
+			input:    `ls "*"*'[a]'`,
+			expected: []string{"ls", `<\**\[a\]>`},
+		},
+		{
+			name:     "quoted expansion keeps pattern characters literal",
+			input:    `ls "$(*)"x*`,
+			expected: []string{"ls", `<\*x*>`},
+		},
+		{
+			name:     "unquoted expansion result is globbed",
+			input:    "ls $(*.go)",
+			expected: []string{"ls", "<*.go>"},
+		},
+		{
+			name:     "tilde alone",
+			input:    "cd ~",
+			expected: []string{"cd", "/home/user"},
+		},
+		{
+			name:     "tilde with path",
+			input:    "ls ~/src ~root/bin ~+/x",
+			expected: []string{"ls", "/home/user/src", "/root/bin", "/work/x"},
+		},
+		{
+			name:     "unknown user is literal",
+			input:    "ls ~nobody/x",
+			expected: []string{"ls", "~nobody/x"},
+		},
+		{
+			name:     "tilde inside a word is literal",
+			input:    "echo a~ a/~",
+			expected: []string{"echo", "a~", "a/~"},
+		},
+		{
+			name:     "quoted tilde is literal",
+			input:    `echo "~" '~'/x \~`,
+			expected: []string{"echo", "~", "~/x", "~"},
+		},
+		{
+			name:     "quoted prefix is not expanded",
+			input:    `echo ~"root"`,
+			expected: []string{"echo", "~root"},
+		},
+		{
+			name:     "tilde after equals and colons in an assignment",
+			input:    "PATH=~/bin:~root/bin:a~",
+			expected: []string{"PATH=/home/user/bin:/root/bin:a~"},
+		},
+		{
+			name:     "colon does not end a prefix outside assignments",
+			input:    "echo ~:x",
+			expected: []string{"echo", "~:x"},
+		},
+		{
+			name:     "expanded directory is literal in a glob",
+			input:    "echo ~-/*",
+			expected: []string{"echo", `</old\[1\]/*>`},
+		},
+		{
+			name:        "unclosed arithmetic",
+			input:       "echo $((1 + 2)",
+			expectedErr: ErrUnclosedExpansion,
+		},
+		{
+			name:        "unclosed substitution",
+			input:       "echo $(a",
+			expectedErr: ErrUnclosedExpansion,
+		},
+		{
+			name:        "unclosed brace",
+			input:       "echo ${HOME",
+			expectedErr: ErrUnclosedExpansion,
+		},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			parser := NewDefaultParser()
+			parser.SetExpander(vars)
+			res, err := parser.Parse(tt.input)
+
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Errorf("Expected error: %v got %v", tt.expectedErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Expected no error got %v", err)
+				return
+			}
+
+			if !equalStringSlices(res, tt.expected) {
+				t.Errorf("input:  %q\nexpected: %v\ngot:       %v", tt.input, tt.expected, res)
+			}
+
+		})
+
+	}
+
+}
+
+func TestParser_FieldSplitting(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		ifs      string
+		value    string
+		input    string
+		expected []string
+	}{
+		{name: "default IFS", ifs: " \t\n", value: " a\t b\n", input: "$X", expected: []string{"a", "b"}},
+		{name: "joins adjacent text", ifs: " \t\n", value: "a b", input: "<$X>", expected: []string{"<a", "b>"}},
+		{name: "leading whitespace ends the text before", ifs: " \t\n", value: " a ", input: "<$X>", expected: []string{"<", "a", ">"}},
+		{name: "only whitespace", ifs: " \t\n", value: "   ", input: "$X", expected: []string{}},
+		{name: "whitespace only next to text", ifs: " \t\n", value: "   ", input: "a${X}b", expected: []string{"a", "b"}},
+		{name: "non-whitespace delimiter", ifs: ",", value: "a,b", input: "$X", expected: []string{"a", "b"}},
+		{name: "empty field between delimiters", ifs: ",", value: "a,,b", input: "$X", expected: []string{"a", "", "b"}},
+		{name: "leading delimiter", ifs: ",", value: ",a", input: "$X", expected: []string{"", "a"}},
+		{name: "trailing delimiter", ifs: ",", value: "a,", input: "$X", expected: []string{"a"}},
+		{name: "trailing delimiter before text", ifs: ",", value: "a,", input: "${X}b", expected: []string{"a", "b"}},
+		{name: "spaces are not separators", ifs: ",", value: "a b,c", input: "$X", expected: []string{"a b", "c"}},
+		{name: "whitespace around a delimiter", ifs: ", ", value: " a , b  c ", input: "$X", expected: []string{"a", "b", "c"}},
+		{name: "whitespace between delimiters", ifs: ", ", value: "a, ,b", input: "$X", expected: []string{"a", "", "b"}},
+		{name: "empty IFS does not split", ifs: "", value: " a b ", input: "$X", expected: []string{" a b "}},
+		{name: "double quotes are not split", ifs: ",", value: "a,b", input: `"$X"`, expected: []string{"a,b"}},
+		{name: "command substitution", ifs: ":", value: "", input: "$(a:b)", expected: []string{"a", "b"}},
+		{name: "arithmetic expansion", ifs: "+", value: "", input: "$((1+2))", expected: []string{"(1", "2)"}},
+		{name: "positional parameters", ifs: ",", value: "", input: "$@", expected: []string{"a", "b", "c"}},
+		{name: "split fields are globbed", ifs: ",", value: "*.go,x", input: "$X", expected: []string{"<*.go>", "x"}},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			parser := NewDefaultParser()
+			parser.SetExpander(mapExpander{"X": tt.value, "IFS": tt.ifs, "@": "a,b c"})
+			res, err := parser.Parse(tt.input)
+
+			if err != nil {
+				t.Errorf("Expected no error got %v", err)
+				return
+			}
+
+			if !equalStringSlices(res, tt.expected) {
+				t.Errorf("input:  %q\nexpected: %q\ngot:       %q", tt.input, tt.expected, res)
+			}
+
+		})
+
+	}
+
+}
+
+func TestParseError(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		input       string
+		expectedErr error
+		line        int
+		column      int
+		expected    string
+		found       string
+	}{
+		{name: "empty pipeline stage", input: "ls | | wc", expectedErr: ErrSyntax, line: 1, column: 6, expected: "a command", found: "|"},
+		{name: "missing redirection target", input: "echo >", expectedErr: ErrSyntax, line: 1, column: 7, expected: "a word", found: "newline"},
+		{name: "keyword on a later line", input: "if a\nthen b\nfi c", expectedErr: ErrSyntax, line: 3, column: 4, expected: "", found: "c"},
+		{name: "missing keyword", input: "for x in a; echo; done", expectedErr: ErrSyntax, line: 1, column: 13, expected: "`do'", found: "echo"},
+		{name: "end of a compound command", input: "if a; then b", expectedErr: ErrSyntax, line: 1, column: 13, expected: "`elif', `else' or `fi'", found: "end of file"},
+		{name: "invalid name", input: "for 1x in a; do b; done", expectedErr: ErrSyntax, line: 1, column: 5, expected: "a name", found: "1x"},
+		{name: "unclosed single quote", input: "echo 'a\nb", expectedErr: ErrUnclosedQuote, line: 1, column: 6, expected: "`''", found: "end of file"},
+		{name: "unclosed double quote", input: "echo x \"a", expectedErr: ErrUnclosedQuote, line: 1, column: 8, expected: "`\"'", found: "end of file"},
+		{name: "unclosed expansion", input: "echo ${a", expectedErr: ErrUnclosedExpansion, line: 1, column: 6, expected: "`}'", found: "end of file"},
+		{name: "unclosed command substitution", input: "echo\necho $(ls", expectedErr: ErrUnclosedExpansion, line: 2, column: 6, expected: "`)'", found: "end of file"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			_, err := NewDefaultParser().ParseTree(tt.input)
+
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("Expected error: %v got %v", tt.expectedErr, err)
+			}
+
+			var parseErr *ParseError
+
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("expected a *ParseError got %T", err)
+			}
+
+			if parseErr.Position.Line != tt.line || parseErr.Position.Column != tt.column {
+				t.Errorf("expected %d:%d got %d:%d", tt.line, tt.column, parseErr.Position.Line, parseErr.Position.Column)
+			}
+
+			if parseErr.Expected != tt.expected || parseErr.Found != tt.found {
+				t.Errorf("expected (%q, %q) got (%q, %q)", tt.expected, tt.found, parseErr.Expected, parseErr.Found)
+			}
+
+			if parseErr.Source != tt.input {
+				t.Errorf("expected source %q got %q", tt.input, parseErr.Source)
+			}
+
+		})
+
+	}
+
+}
+
+func TestParseError_Diagnostic(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "caret under the token", input: "ls | | wc", expected: "ls | | wc\n     ^"},
+		{name: "only the line of the error", input: "echo a\nls | | wc\necho b", expected: "ls | | wc\n     ^"},
+		{name: "tabs are kept", input: "\tls | | wc", expected: "\tls | | wc\n\t     ^"},
+		{name: "end of the input", input: "echo 'a", expected: "echo 'a\n     ^"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			var parseErr *ParseError
+			_, err := NewDefaultParser().ParseTree(tt.input)
+
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("expected a *ParseError got %v", err)
+			}
+
+			if got := parseErr.Diagnostic(); got != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+
+		})
+
+	}
+
+}
@@ -0,0 +1,355 @@
+package shell
+
+import (
+	"strings"
+	"unicode"
+)
+
+// matchPattern reports whether s matches the shell pattern in its entirety.
+//
+// Patterns follow the shell's filename-matching notation:
+//   - *      : Matches any string, including the empty string
+//   - ?      : Matches any single character
+//   - [abc]  : Matches one character from the set
+//   - [a-z]  : Matches one character in the range
+//   - [!a-z] : Matches one character not in the set ([^a-z] also works)
+//   - [[:alpha:]] : Matches one character of a POSIX class (alpha, digit,
+//     alnum, upper, lower, space, blank, punct, print, graph, cntrl, xdigit)
+//   - \x     : Matches the character x literally
+//
+// Unlike path.Match, "*" and "?" also match "/", which is what parameter
+// expansion (${path##*/}) and case patterns require. A "[" without a
+// closing "]" matches itself.
+//
+// This is the one matcher shared by filename expansion (globPaths), the
+// ${var#pattern} family and case commands. They pass patterns in the form
+// produced by ExpandPattern, where quoted characters are backslash-escaped
+// and so match literally.
+//
+// Parameters:
+//   - pattern: The shell pattern
+//   - s: The string to test
+//
+// Returns:
+//   - bool: true if the whole of s matches pattern
+//
+// Examples:
+//
+//	matchPattern("*.go", "main.go")      → true
+//	matchPattern("file?.txt", "file1.txt") → true
+//	matchPattern("[!0-9]*", "9lives")    → false
+//	matchPattern(`\*`, "*")              → true
+func matchPattern(pattern, s string) bool {
+	return matchRunes([]rune(pattern), []rune(s))
+}
+
+// matchRunes implements matchPattern on rune slices.
+//
+// It walks the pattern and the string together, remembering the position of
+// the most recent "*" so that a failed match can backtrack by letting that
+// star absorb one more character. This keeps matching linear for patterns
+// with a single star and avoids recursion entirely.
+func matchRunes(pattern, s []rune) bool {
+	p, i := 0, 0
+	starP, starI := -1, 0
+
+	for i < len(s) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				starP, starI = p, i
+				p++
+				continue
+
+			case '?':
+				p++
+				i++
+				continue
+
+			case '[':
+				if matched, width, ok := matchBracket(pattern[p:], s[i]); ok {
+					if matched {
+						p += width
+						i++
+						continue
+					}
+				} else if s[i] == '[' {
+					// unterminated bracket matches a literal "["
+					p++
+					i++
+					continue
+				}
+
+			case '\\':
+				if p+1 < len(pattern) && pattern[p+1] == s[i] {
+					p += 2
+					i++
+					continue
+				}
+				if p+1 == len(pattern) && s[i] == '\\' {
+					p++
+					i++
+					continue
+				}
+
+			default:
+				if pattern[p] == s[i] {
+					p++
+					i++
+					continue
+				}
+			}
+		}
+
+		// mismatch: let the last star swallow one more character
+		if starP < 0 {
+			return false
+		}
+
+		starI++
+		p, i = starP+1, starI
+	}
+
+	// only trailing stars may remain
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
+
+// matchBracket matches ch against the bracket expression at the start of
+// pattern (which must begin with "[").
+//
+// Returns:
+//   - matched: Whether ch is in (or, for [!...], not in) the set
+//   - width: Number of pattern runes consumed, including both brackets
+//   - ok: false if the expression has no closing "]"
+func matchBracket(pattern []rune, ch rune) (matched bool, width int, ok bool) {
+	i := 1
+	negate := false
+
+	if i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^') {
+		negate = true
+		i++
+	}
+
+	start := i
+
+	for i < len(pattern) {
+		// a "]" right after the opening bracket is a literal member
+		if pattern[i] == ']' && i > start {
+			return matched != negate, i + 1, true
+		}
+
+		if pattern[i] == '[' && i+1 < len(pattern) && pattern[i+1] == ':' {
+			if end := indexRunes(pattern[i+2:], ":]"); end >= 0 {
+				class := string(pattern[i+2 : i+2+end])
+				if matchClass(class, ch) {
+					matched = true
+				}
+				i += end + 4
+				continue
+			}
+		}
+
+		lo := pattern[i]
+		if lo == '\\' && i+1 < len(pattern) {
+			i++
+			lo = pattern[i]
+		}
+
+		hi := lo
+		if i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']' {
+			hi = pattern[i+2]
+			if hi == '\\' && i+3 < len(pattern) {
+				i++
+				hi = pattern[i+2]
+			}
+			i += 2
+		}
+
+		if lo <= ch && ch <= hi {
+			matched = true
+		}
+
+		i++
+	}
+
+	return false, 0, false
+}
+
+// matchClass reports whether ch belongs to the named POSIX character class.
+func matchClass(class string, ch rune) bool {
+	switch class {
+	case "alpha":
+		return unicode.IsLetter(ch)
+	case "digit":
+		return ch >= '0' && ch <= '9'
+	case "alnum":
+		return unicode.IsLetter(ch) || unicode.IsDigit(ch)
+	case "upper":
+		return unicode.IsUpper(ch)
+	case "lower":
+		return unicode.IsLower(ch)
+	case "space":
+		return unicode.IsSpace(ch)
+	case "blank":
+		return ch == ' ' || ch == '\t'
+	case "punct":
+		return unicode.IsPunct(ch) || unicode.IsSymbol(ch)
+	case "print":
+		return unicode.IsPrint(ch)
+	case "graph":
+		return unicode.IsGraphic(ch) && !unicode.IsSpace(ch)
+	case "cntrl":
+		return unicode.IsControl(ch)
+	case "xdigit":
+		return strings.ContainsRune("0123456789abcdefABCDEF", ch)
+	}
+
+	return false
+}
+
+// indexRunes returns the index of the first occurrence of sub in s, or -1.
+func indexRunes(s []rune, sub string) int {
+	target := []rune(sub)
+
+	for i := 0; i+len(target) <= len(s); i++ {
+		if string(s[i:i+len(target)]) == sub {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// hasPatternMeta reports whether s contains an unescaped pattern
+// metacharacter (*, ? or [), i.e. whether it can match anything other than
+// itself.
+func hasPatternMeta(s string) bool {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '*', '?', '[':
+			return true
+		}
+	}
+
+	return false
+}
+
+// stripPrefix removes the shortest (or longest) prefix of s matching pattern.
+//
+// This implements ${var#pattern} and ${var##pattern}. If no prefix matches,
+// s is returned unchanged.
+func stripPrefix(s, pattern string, longest bool) string {
+	runes, pat := []rune(s), []rune(pattern)
+
+	if longest {
+		for n := len(runes); n >= 0; n-- {
+			if matchRunes(pat, runes[:n]) {
+				return string(runes[n:])
+			}
+		}
+		return s
+	}
+
+	for n := 0; n <= len(runes); n++ {
+		if matchRunes(pat, runes[:n]) {
+			return string(runes[n:])
+		}
+	}
+
+	return s
+}
+
+// stripSuffix removes the shortest (or longest) suffix of s matching pattern.
+//
+// This implements ${var%pattern} and ${var%%pattern}. If no suffix matches,
+// s is returned unchanged.
+func stripSuffix(s, pattern string, longest bool) string {
+	runes, pat := []rune(s), []rune(pattern)
+
+	if longest {
+		for n := 0; n <= len(runes); n++ {
+			if matchRunes(pat, runes[n:]) {
+				return string(runes[:n])
+			}
+		}
+		return s
+	}
+
+	for n := len(runes); n >= 0; n-- {
+		if matchRunes(pat, runes[n:]) {
+			return string(runes[:n])
+		}
+	}
+
+	return s
+}
+
+// replacePattern substitutes the longest matches of pattern in s.
+//
+// This implements the ${var/pattern/replacement} family:
+//   - mode "/"  : Replace the first match
+//   - mode "//" : Replace every match
+//   - mode "/#" : Replace a match anchored at the start of s
+//   - mode "/%" : Replace a match anchored at the end of s
+//
+// An empty pattern leaves s unchanged.
+func replacePattern(s, pattern, replacement, mode string) string {
+	if pattern == "" {
+		return s
+	}
+
+	runes, pat := []rune(s), []rune(pattern)
+
+	switch mode {
+	case "/#":
+		for n := len(runes); n >= 0; n-- {
+			if matchRunes(pat, runes[:n]) {
+				return replacement + string(runes[n:])
+			}
+		}
+		return s
+
+	case "/%":
+		for n := 0; n <= len(runes); n++ {
+			if matchRunes(pat, runes[n:]) {
+				return string(runes[:n]) + replacement
+			}
+		}
+		return s
+	}
+
+	var result strings.Builder
+	i := 0
+
+	for i < len(runes) {
+		end := -1
+		for n := len(runes); n > i; n-- {
+			if matchRunes(pat, runes[i:n]) {
+				end = n
+				break
+			}
+		}
+
+		if end < 0 {
+			result.WriteRune(runes[i])
+			i++
+			continue
+		}
+
+		result.WriteString(replacement)
+		i = end
+
+		if mode != "//" {
+			result.WriteString(string(runes[i:]))
+			return result.String()
+		}
+	}
+
+	return result.String()
+}
@@ -0,0 +1,81 @@
+package shell
+
+import "testing"
+
+func TestMatchPattern(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		pattern  string
+		input    string
+		expected bool
+	}{
+		{name: "literal match", pattern: "main.go", input: "main.go", expected: true},
+		{name: "literal mismatch", pattern: "main.go", input: "main.rs", expected: false},
+		{name: "star suffix", pattern: "*.go", input: "parser.go", expected: true},
+		{name: "star matches slash", pattern: "*/", input: "usr/local/", expected: true},
+		{name: "star matches empty", pattern: "a*b", input: "ab", expected: true},
+		{name: "multiple stars backtrack", pattern: "*a*b*c", input: "xaybzbc", expected: true},
+		{name: "question mark", pattern: "file?.txt", input: "file1.txt", expected: true},
+		{name: "question mark needs a character", pattern: "file?.txt", input: "file.txt", expected: false},
+		{name: "bracket set", pattern: "[abc]x", input: "bx", expected: true},
+		{name: "bracket range", pattern: "[0-9][0-9]", input: "42", expected: true},
+		{name: "negated bracket", pattern: "[!0-9]*", input: "9lives", expected: false},
+		{name: "caret negation", pattern: "[^a]", input: "b", expected: true},
+		{name: "bracket with leading close", pattern: "[]a]", input: "]", expected: true},
+		{name: "character class", pattern: "[[:upper:]]*", input: "Hello", expected: true},
+		{name: "unterminated bracket is literal", pattern: "[abc", input: "[abc", expected: true},
+		{name: "escaped star is literal", pattern: `\*`, input: "*", expected: true},
+		{name: "escaped star does not glob", pattern: `\*`, input: "x", expected: false},
+		{name: "empty pattern matches empty", pattern: "", input: "", expected: true},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			if got := matchPattern(tt.pattern, tt.input); got != tt.expected {
+				t.Errorf("matchPattern(%q, %q) = %v, expected %v", tt.pattern, tt.input, got, tt.expected)
+			}
+
+		})
+
+	}
+
+}
+
+func TestPatternStripAndReplace(t *testing.T) {
+
+	path := "/usr/local/bin/go.tar.gz"
+
+	tests := []struct {
+		name     string
+		got      string
+		expected string
+	}{
+		{name: "shortest prefix", got: stripPrefix(path, "*/", false), expected: "usr/local/bin/go.tar.gz"},
+		{name: "longest prefix", got: stripPrefix(path, "*/", true), expected: "go.tar.gz"},
+		{name: "shortest suffix", got: stripSuffix(path, ".*", false), expected: "/usr/local/bin/go.tar"},
+		{name: "longest suffix", got: stripSuffix(path, ".*", true), expected: "/usr/local/bin/go"},
+		{name: "no match leaves value", got: stripPrefix(path, "x*", true), expected: path},
+		{name: "replace first", got: replacePattern("aaa", "a", "b", "/"), expected: "baa"},
+		{name: "replace all", got: replacePattern("aaa", "a", "b", "//"), expected: "bbb"},
+		{name: "replace longest match", got: replacePattern("abcabc", "a*c", "X", "/"), expected: "X"},
+		{name: "replace anchored start", got: replacePattern("abab", "ab", "X", "/#"), expected: "Xab"},
+		{name: "replace anchored end", got: replacePattern("abab", "ab", "X", "/%"), expected: "abX"},
+		{name: "anchored start without match", got: replacePattern("abab", "b", "X", "/#"), expected: "abab"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			if tt.got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, tt.got)
+			}
+
+		})
+
+	}
+
+}
@@ -0,0 +1,143 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// runPipeline executes the commands of a pipeline.
+//
+// A single command is run directly in the current shell, so builtins such as
+// cd keep affecting the shell's state. With two or more commands every
+// command runs concurrently in its own goroutine: the stdout of each command
+// is connected to the stdin of the next through an OS pipe (os.Pipe), which
+// lets external commands stream data to one another while builtins simply
+// read from or write to the pipe files in their IOBindings.
+//
+// Each concurrent command runs in a subshell, a copy of the shell made with
+// subshell, so builtins can swap Out and Err for their redirections without
+// racing the other commands, and assignments or cd in a stage do not leak
+// into the shell. An exit builtin inside a multi-command pipeline only ends
+// its own command, matching the behaviour of other shells.
+//
+// Redirections on a command are applied after the pipe bindings, so
+// `echo hi > out.txt | cat` writes to out.txt and cat reads nothing.
+//
+// Once a stage has finished, its end of the pipe is closed. A builtin that
+// then writes to the previous pipe gets EPIPE and ends its whole stage with
+// status 141, as SIGPIPE ends an external command, so
+// `while true; do echo y; done | head -n 1` finishes with head.
+//
+// A negated pipeline, `! cmd`, has status 1 when the last command succeeds
+// and 0 otherwise, so `if ! grep -q x file; then` runs its body when x is
+// missing. exit, return, break and continue keep their own status.
+//
+// Parameters:
+//   - pipeline: The parsed pipeline
+//
+// Returns:
+//   - int: Exit status of the last command, inverted for a negated pipeline
+//   - error: ErrExit when a single-command pipeline runs the exit builtin,
+//     or errors from command substitutions that cannot be parsed. Expansion
+//     errors such as ${var:?} are printed and give the command status 1
+//     instead.
+//
+// Example:
+//
+//	$ ls | grep go | wc -l
+//	2
+func (shell *Shell) runPipeline(pipeline *Pipeline) (int, error) {
+	status, err := shell.runPipelineCommands(pipeline.Commands)
+
+	if pipeline.Negated && err == nil {
+		if status == 0 {
+			return 1, nil
+		}
+
+		return 0, nil
+	}
+
+	return status, err
+}
+
+// runPipelineCommands runs the commands of a pipeline and returns the status
+// of the last one; see runPipeline.
+func (shell *Shell) runPipelineCommands(commands []Command) (int, error) {
+
+	baseBindings := IOBindings{
+		Stdin:  shell.stdin,
+		Stdout: shell.Out,
+		Stderr: shell.Err,
+		Dir:    shell.dir,
+	}
+
+	if len(commands) == 1 {
+		return shell.runCommand(commands[0], baseBindings)
+	}
+
+	// pipe i connects the stdout of stage i to the stdin of stage i+1
+	readers := make([]*os.File, len(commands)-1)
+	writers := make([]*os.File, len(commands)-1)
+
+	for i := range readers {
+		r, w, err := os.Pipe()
+
+		if err != nil {
+			for j := 0; j < i; j++ {
+				readers[j].Close()
+				writers[j].Close()
+			}
+
+			fmt.Fprintln(shell.Err, "pipeline error:", err)
+			return 1, nil
+		}
+
+		readers[i], writers[i] = r, w
+	}
+
+	statuses := make([]int, len(commands))
+	var wg sync.WaitGroup
+
+	for i, command := range commands {
+
+		ioBindings := baseBindings
+
+		if i > 0 {
+			ioBindings.Stdin = readers[i-1]
+		}
+
+		if i < len(writers) {
+			ioBindings.Stdout = writers[i]
+		}
+
+		stage := shell.subshell()
+
+		wg.Go(func() {
+			// release this stage's pipe ends so its neighbours see EOF or EPIPE
+			defer func() {
+				if i > 0 {
+					readers[i-1].Close()
+				}
+				if i < len(writers) {
+					writers[i].Close()
+				}
+			}()
+
+			// exit, break and continue only end their own stage
+			status, err := stage.runCommand(command, ioBindings)
+
+			if stage.globFailure(err) {
+				status = 1
+			} else if err != nil && !isControlFlow(err) {
+				fmt.Fprintln(stage.Err, err)
+			}
+
+			statuses[i] = status
+		})
+	}
+
+	wg.Wait()
+
+	return statuses[len(statuses)-1], nil
+}
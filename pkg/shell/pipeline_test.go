@@ -0,0 +1,110 @@
+package shell
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRunPipeline(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		script         string
+		expected       string
+		expectedStatus int
+	}{
+		{name: "external stages", script: "printf 'b\\na\\n' | sort", expected: "a\nb\n"},
+		{name: "builtin into external", script: "echo hello | tr a-z A-Z", expected: "HELLO\n"},
+		{name: "external into builtin", script: "ls / | echo ignored", expected: "ignored\n"},
+		{name: "builtin in the middle", script: "printf x | echo mid | cat", expected: "mid\n"},
+		{name: "three stages", script: "printf 'a\\nb\\nc\\n' | grep -v b | wc -l | tr -d ' '", expected: "2\n"},
+		{name: "type as a stage", script: "type echo | cat", expected: "echo is a shell builtin\n"},
+		{name: "compound stage", script: "for x in a b; do echo $x; done | sort -r", expected: "b\na\n"},
+		{name: "status of the last stage", script: "false | true", expectedStatus: 0},
+		{name: "failing last stage", script: "true | false", expectedStatus: 1},
+		{name: "last stage not found", script: "echo x | nosuchcommand 2>/dev/null", expectedStatus: 127},
+		{name: "assignments in a stage are not kept", script: "x=1; x=2 | true; echo $x", expected: "1\n"},
+		{name: "cd in a stage is not kept", script: "d=$(pwd); cd / | true; [ \"$(pwd)\" = \"$d\" ] && echo same", expected: "same\n"},
+		{name: "negated success", script: "! true", expectedStatus: 1},
+		{name: "negated failure", script: "! false", expectedStatus: 0},
+		{name: "negation applies to the last stage", script: "! echo x | grep -q y && echo missing", expected: "missing\n"},
+		{name: "negated condition", script: "if ! grep -q zz /dev/null; then echo none; fi", expected: "none\n"},
+		{name: "negated not found", script: "! nosuchcommand 2>/dev/null; echo $?", expected: "0\n"},
+		{name: "exit keeps its status", script: "! exit 3", expectedStatus: 3},
+		{name: "stage redirection wins", script: "echo hi > /dev/null | wc -c | tr -d ' '", expected: "0\n"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, status := runScript(t, tt.script)
+
+			if got != tt.expected {
+				t.Errorf("script: %q\nexpected: %q\ngot:      %q", tt.script, tt.expected, got)
+			}
+
+			if status != tt.expectedStatus {
+				t.Errorf("expected status %d got %d", tt.expectedStatus, status)
+			}
+
+		})
+
+	}
+
+}
+
+func TestRunPipeline_BrokenPipe(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		script   string
+		expected string
+	}{
+		{name: "builtin loop stops with the reader", script: "while true; do echo y; done | head -n 1", expected: "y\n"},
+		{name: "the whole stage ends", script: "{ while true; do echo y; done; echo after; } | head -n 2", expected: "y\ny\n"},
+		{name: "function loop stops", script: "f() { for ((;;)); do echo z; done; }; f | head -n 1; echo next", expected: "z\nnext\n"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, _ := runScript(t, tt.script)
+
+			if got != tt.expected {
+				t.Errorf("script: %q\nexpected: %q\ngot:      %q", tt.script, tt.expected, got)
+			}
+
+		})
+
+	}
+
+}
+
+func TestRunSimpleCommand_BrokenPipeStatus(t *testing.T) {
+
+	reader, writer, err := os.Pipe()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer writer.Close()
+	reader.Close()
+
+	sh := New(strings.NewReader(""), writer, io.Discard)
+	err = sh.evaluate("while true; do echo y; done; echo unreachable")
+
+	if !errors.Is(err, ErrExit) {
+		t.Fatalf("expected the shell to end, got %v", err)
+	}
+
+	if sh.lastStatus != statusBrokenPipe {
+		t.Errorf("expected status %d got %d", statusBrokenPipe, sh.lastStatus)
+	}
+
+}
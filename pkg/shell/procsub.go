@@ -0,0 +1,129 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+)
+
+// processSubstitution is a <(cmd) or >(cmd) whose command is running
+// alongside the command it was expanded for.
+type processSubstitution struct {
+	file *os.File      // The pipe end named by the /dev/fd path, held open for the outer command
+	done chan struct{} // Closed once the inner command has finished
+}
+
+// ExpandProcess starts a process substitution and returns the path that
+// stands for it.
+//
+// The command runs concurrently in a subshell, connected to the outer
+// command through a pipe: for <(cmd) its stdout is the write end and the
+// outer command reads the other one, for >(cmd) its stdin is the read end
+// and the outer command writes to the other one. The outer command's end
+// stays open in the shell, and the word becomes /dev/fd/N, N being that
+// end's descriptor. External commands inherit the descriptor under the
+// same number (see substitutionFiles), and redirections opened by the
+// shell itself reopen it through /dev/fd.
+//
+// The substitution lasts until the command it was expanded for finishes
+// (see finishSubstitutions).
+//
+// Parameters:
+//   - command: The command text from <(...) or >(...)
+//   - output: true for >(...), whose command reads what is written
+//
+// Returns:
+//   - string: The path of the outer command's pipe end, /dev/fd/N
+//   - error: Syntax errors in the command, or errors creating the pipe
+//
+// Example:
+//
+//	$ diff <(echo a) <(echo b)
+//	1c1
+//	< a
+//	---
+//	> b
+func (e shellExpander) ExpandProcess(command string, output bool) (string, error) {
+	substitution := e.shell.subshell()
+	command, err := substitution.embedHereDocuments(command)
+
+	if err != nil {
+		return "", err
+	}
+
+	list, err := substitution.parser.ParseTree(command)
+
+	if err != nil {
+		return "", err
+	}
+
+	reader, writer, err := os.Pipe()
+
+	if err != nil {
+		return "", err
+	}
+
+	// inner is the command's end of the pipe, outer the end the path names
+	inner, outer := writer, reader
+	substitution.Out = writer
+
+	if output {
+		inner, outer = reader, writer
+		substitution.Out = e.shell.Out
+		substitution.stdin = reader
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer inner.Close()
+
+		if err := substitution.runList(list); err != nil {
+			substitution.globFailure(err)
+		}
+	}()
+
+	e.shell.substitutions = append(e.shell.substitutions, &processSubstitution{file: outer, done: done})
+
+	return fmt.Sprintf("/dev/fd/%d", outer.Fd()), nil
+}
+
+// substitutionFiles returns the pipe ends of the running process
+// substitutions laid out as exec.Cmd.ExtraFiles, so that an external
+// command sees each one under the descriptor number in its /dev/fd path.
+// The nil entries in between are closed in the child.
+func (shell *Shell) substitutionFiles() []*os.File {
+	var files []*os.File
+
+	for _, substitution := range shell.substitutions {
+		fd := int(substitution.file.Fd())
+
+		// ExtraFiles[0] becomes descriptor 3
+		for len(files) <= fd-3 {
+			files = append(files, nil)
+		}
+
+		files[fd-3] = substitution.file
+	}
+
+	return files
+}
+
+// finishSubstitutions ends the process substitutions started after the
+// first n, once the command they were expanded for has finished.
+//
+// Closing the outer command's end of each pipe gives a >(cmd) command the
+// end of its input, and stops a <(cmd) command that is still writing; the
+// shell then waits for each one to finish.
+func (shell *Shell) finishSubstitutions(n int) {
+	if len(shell.substitutions) <= n {
+		return
+	}
+
+	for _, substitution := range shell.substitutions[n:] {
+		substitution.file.Close()
+		<-substitution.done
+	}
+
+	shell.substitutions = shell.substitutions[:n]
+}
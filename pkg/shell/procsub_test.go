@@ -0,0 +1,47 @@
+package shell
+
+import (
+	"testing"
+)
+
+func TestProcessSubstitution(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		script         string
+		expected       string
+		expectedStatus int
+	}{
+		{name: "read the output of a command", script: "cat <(echo hello)", expected: "hello\n"},
+		{name: "several substitutions", script: "diff <(echo a) <(echo a) && echo same", expected: "same\n"},
+		{name: "differing inputs", script: "diff <(echo a) <(echo b) >/dev/null", expectedStatus: 1},
+		{name: "expands to a /dev/fd path", script: "echo <(true) | grep -c '^/dev/fd/[0-9]*$'", expected: "1\n"},
+		{name: "redirect input from one", script: "cat < <(printf 'x\\ny\\n')", expected: "x\ny\n"},
+		{name: "write to a command", script: "echo shout > >(tr a-z A-Z)", expected: "SHOUT\n"},
+		{name: "passed to a function", script: "f() { cat \"$1\"; }; f <(echo inside)", expected: "inside\n"},
+		{name: "inner command is a builtin", script: "x=set; cat <(echo $x; pwd >/dev/null)", expected: "set\n"},
+		{name: "inner assignments are not kept", script: "x=1; cat <(x=2); echo $x", expected: "1\n"},
+		{name: "reader stops early", script: "head -n 1 <(yes)", expected: "y\n"},
+		{name: "builtin loop stops with the reader", script: "head -n 1 <(while true; do echo y; done)", expected: "y\n"},
+		{name: "loop over the output", script: "for f in <(echo a); do cat $f; done", expected: "a\n"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, status := runScript(t, tt.script)
+
+			if got != tt.expected {
+				t.Errorf("script: %q\nexpected: %q\ngot:      %q", tt.script, tt.expected, got)
+			}
+
+			if status != tt.expectedStatus {
+				t.Errorf("expected status %d got %d", tt.expectedStatus, status)
+			}
+
+		})
+
+	}
+
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 )
 
 // FileOpener abstracts file system operations for I/O redirection.
@@ -51,18 +52,25 @@ type FileOpener interface {
 	OpenWrite(name string, flag int, perm os.FileMode) (io.WriteCloser, error)
 }
 
-// ErrMissingRedirectDestination is returned when a redirection operator
-// is encountered without a following target file path.
+// ErrMissingRedirectDestination is returned when a redirection is applied
+// without a target file path.
 //
-// This error occurs during argument parsing when a command ends with a
-// redirection operator that requires a target.
-//
-// Example command that triggers this error:
+// A command line that ends with a redirection operator is rejected earlier,
+// as a syntax error (see ArgumentParser.Parse):
 //
 //	$ echo hello >
-//	parse error: missing target for redirection '>' at position 2
+//	syntax error near unexpected token `newline' (expected a file name)
 var ErrMissingRedirectDestination = errors.New("missing redirect destination")
 
+// ErrAmbiguousRedirect is returned when the target of a redirection is a
+// pattern that does not match exactly one file.
+//
+// Example:
+//
+//	$ echo hello > *.go
+//	*.go: ambiguous redirect
+var ErrAmbiguousRedirect = errors.New("ambiguous redirect")
+
 // DefaultFileOpener implements FileOpener using the real file system.
 //
 // This is the production implementation used by the shell for actual
@@ -130,8 +138,8 @@ func (fp *DefaultFileOpener) OpenWrite(name string, flag int, perm os.FileMode)
 //   - {Operator: ">", Target:  "output.txt", Index: 2}
 //   - {Operator: "2>", Target: "errors.log", Index: 4}
 type RedirectionSpec struct {
-	Operator string // Redirection operator (>, >>, 1>, 1>>, 2>, 2>>)
-	Target   string // Target file path
+	Operator string // Redirection operator (>, >>, 1>, 1>>, 2>, 2>>, &>, &>>, 2>&, <, <&, <<, <<-, <<<)
+	Target   string // Target file path, or descriptor number for 2>&, 1>& and <&
 	Index    int    // Position in original arguments (for error reporting)
 }
 
@@ -151,9 +159,15 @@ type RedirectionSpec struct {
 //	    Args:         []string{"ls", "-l", "src/"},
 //	    Redirections: []RedirectionSpec{{Operator: ">", Target:  "output.txt", Index: 2}},
 //	}
+//
+// The shell builds a ParsedCommand from each simple command of the syntax
+// tree, with the leading NAME=value words in Assignments; ArgumentParser
+// leaves Assignments empty.
 type ParsedCommand struct {
-	Args         []string          // Command arguments without redirection operators
-	Redirections []RedirectionSpec // Parsed redirection specifications
+	Args         []string               // Command arguments without redirection operators
+	Redirections []RedirectionSpec      // Parsed redirection specifications
+	Assignments  []string               // Leading NAME=value words, expanded
+	arrays       map[int][]arrayElement // Elements of the NAME=(...) words among Assignments, by index
 }
 
 // RedirectionHandler defines the interface for implementing specific
@@ -320,7 +334,7 @@ func (handler *StdoutRedirectionHandler) Apply(spec RedirectionSpec, ioBindings
 		flag |= os.O_APPEND
 	}
 
-	file, err := opener.OpenWrite(spec.Target, flag, 0644)
+	file, err := opener.OpenWrite(ioBindings.resolve(spec.Target), flag, 0644)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to open %s: %w", spec.Target, err)
@@ -419,7 +433,7 @@ func (handler *StderrRedirectionHandler) Apply(spec RedirectionSpec, ioBindings
 		flag |= os.O_APPEND
 	}
 
-	file, err := opener.OpenWrite(spec.Target, flag, 0644)
+	file, err := opener.OpenWrite(ioBindings.resolve(spec.Target), flag, 0644)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to open %s: %w", spec.Target, err)
@@ -430,6 +444,425 @@ func (handler *StderrRedirectionHandler) Apply(spec RedirectionSpec, ioBindings
 
 }
 
+// StdinRedirectionHandler handles redirection of standard input (file
+// descriptor 0) from a file.
+//
+// Supported operators:
+//   - < or 0< : Read stdin from the target file
+//
+// Example usage:
+//
+//	handler := &StdinRedirectionHandler{}
+//	handler.CanHandle("<")   // returns true
+//	handler.CanHandle("<<")  // returns false
+type StdinRedirectionHandler struct{}
+
+// CanHandle returns true for the < and 0< operators.
+//
+// Parameters:
+//   - operator: The operator to check
+//
+// Returns:
+//   - bool: true for < and 0<
+func (handler *StdinRedirectionHandler) CanHandle(operator string) bool {
+	return operator == "<" || operator == "0<"
+}
+
+// Validate checks that the redirection has a source file.
+//
+// Parameters:
+//   - spec: The redirection specification to validate
+//
+// Returns:
+//   - error: ErrMissingRedirectDestination if Target is empty, nil otherwise
+func (handler *StdinRedirectionHandler) Validate(spec RedirectionSpec) error {
+	if spec.Target == "" {
+		return ErrMissingRedirectDestination
+	}
+
+	return nil
+}
+
+// Apply opens the target file for reading and binds it to stdin.
+//
+// Parameters:
+//   - spec: Redirection specification with the source file path
+//   - ioBindings: I/O bindings to modify (Stdin will be replaced)
+//   - opener: File opener for creating the file handle
+//
+// Returns:
+//   - cleanup: Function to close the file (must be called by caller)
+//   - error: File opening errors (no such file, permission denied, etc.)
+//
+// Example:
+//
+//	spec := RedirectionSpec{Operator: "<", Target: "input.txt"}
+//	cleanup, err := handler.Apply(spec, &bindings, opener)
+func (handler *StdinRedirectionHandler) Apply(spec RedirectionSpec, ioBindings *IOBindings, opener FileOpener) (cleanup func(), err error) {
+
+	file, err := opener.OpenRead(ioBindings.resolve(spec.Target))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", spec.Target, err)
+	}
+
+	ioBindings.Stdin = file
+	return func() { file.Close() }, nil
+
+}
+
+// HereDocumentHandler feeds the body of a here-document to standard input.
+//
+// Supported operators:
+//   - <<  : Here-document
+//   - <<- : Here-document with leading tabs stripped
+//
+// The shell reads the body from its input before the command is parsed and
+// passes it (expanded, unless the delimiter was quoted) as the Target of
+// the spec, so Apply only has to bind it to stdin. See
+// Shell.readHereDocuments.
+//
+// Example:
+//
+//	$ cat <<EOF
+//	> hello
+//	> EOF
+//	hello
+type HereDocumentHandler struct{}
+
+// CanHandle returns true for the << and <<- operators.
+//
+// Parameters:
+//   - operator: The operator to check
+//
+// Returns:
+//   - bool: true for << and <<-
+func (handler *HereDocumentHandler) CanHandle(operator string) bool {
+	return operator == "<<" || operator == "<<-"
+}
+
+// Validate accepts every here-document; the body is allowed to be empty.
+//
+// Parameters:
+//   - spec: The redirection specification to validate
+//
+// Returns:
+//   - error: Always nil
+func (handler *HereDocumentHandler) Validate(spec RedirectionSpec) error {
+	return nil
+}
+
+// Apply binds stdin to a reader over the here-document body.
+//
+// Parameters:
+//   - spec: Redirection specification whose Target is the body
+//   - ioBindings: I/O bindings to modify (Stdin will be replaced)
+//   - opener: Unused; no file is opened
+//
+// Returns:
+//   - cleanup: nil, as there is nothing to close
+//   - error: Always nil
+func (handler *HereDocumentHandler) Apply(spec RedirectionSpec, ioBindings *IOBindings, opener FileOpener) (cleanup func(), err error) {
+	ioBindings.Stdin = strings.NewReader(spec.Target)
+	return nil, nil
+}
+
+// HereStringHandler feeds a single word, followed by a newline, to standard
+// input.
+//
+// Supported operators:
+//   - <<< : Here-string
+//
+// The word is expanded like any other argument, so variables and command
+// substitutions work as expected.
+//
+// Example:
+//
+//	$ wc -w <<< "one two three"
+//	3
+type HereStringHandler struct{}
+
+// CanHandle returns true for the <<< operator.
+//
+// Parameters:
+//   - operator: The operator to check
+//
+// Returns:
+//   - bool: true for <<<
+func (handler *HereStringHandler) CanHandle(operator string) bool {
+	return operator == "<<<"
+}
+
+// Validate accepts every here-string.
+//
+// Parameters:
+//   - spec: The redirection specification to validate
+//
+// Returns:
+//   - error: Always nil
+func (handler *HereStringHandler) Validate(spec RedirectionSpec) error {
+	return nil
+}
+
+// Apply binds stdin to a reader over the word and a trailing newline.
+//
+// Parameters:
+//   - spec: Redirection specification whose Target is the word
+//   - ioBindings: I/O bindings to modify (Stdin will be replaced)
+//   - opener: Unused; no file is opened
+//
+// Returns:
+//   - cleanup: nil, as there is nothing to close
+//   - error: Always nil
+func (handler *HereStringHandler) Apply(spec RedirectionSpec, ioBindings *IOBindings, opener FileOpener) (cleanup func(), err error) {
+	ioBindings.Stdin = strings.NewReader(spec.Target + "\n")
+	return nil, nil
+}
+
+// CombinedRedirectionHandler redirects both standard output and standard
+// error to the same file.
+//
+// Supported operators:
+//   - &>  : Overwrite mode (truncate existing file)
+//   - &>> : Append mode (append to existing file)
+//
+// The operator >& followed by a file name rather than a descriptor number
+// means the same as &>; see DuplicationRedirectionHandler.
+//
+// Example usage:
+//
+//	handler := &CombinedRedirectionHandler{Overwrite: true}
+//	handler.CanHandle("&>")   // returns true
+//	handler.CanHandle("&>>")  // returns false
+type CombinedRedirectionHandler struct {
+	Overwrite bool // true for &>, false for &>>
+}
+
+// CanHandle returns true if this handler can process the given operator.
+//
+// Parameters:
+//   - operator: The operator to check
+//
+// Returns:
+//   - bool: true for &> (if Overwrite=true), or &>> (if Overwrite=false)
+func (handler *CombinedRedirectionHandler) CanHandle(operator string) bool {
+	if handler.Overwrite {
+		return operator == "&>"
+	}
+
+	return operator == "&>>"
+}
+
+// Validate checks that the redirection has a target file.
+//
+// Parameters:
+//   - spec: The redirection specification to validate
+//
+// Returns:
+//   - error: ErrMissingRedirectDestination if Target is empty, nil otherwise
+func (handler *CombinedRedirectionHandler) Validate(spec RedirectionSpec) error {
+	if spec.Target == "" {
+		return ErrMissingRedirectDestination
+	}
+
+	return nil
+}
+
+// Apply opens the target file once and binds both stdout and stderr to it.
+//
+// Parameters:
+//   - spec: Redirection specification with target file path
+//   - ioBindings: I/O bindings to modify (Stdout and Stderr will be replaced)
+//   - opener: File opener for creating the file handle
+//
+// Returns:
+//   - cleanup: Function to close the file (must be called by caller)
+//   - error: File opening errors (permission denied, disk full, etc.)
+func (handler *CombinedRedirectionHandler) Apply(spec RedirectionSpec, ioBindings *IOBindings, opener FileOpener) (cleanup func(), err error) {
+
+	flag := os.O_CREATE | os.O_WRONLY
+
+	if handler.Overwrite {
+		flag |= os.O_TRUNC
+	} else {
+		flag |= os.O_APPEND
+	}
+
+	file, err := opener.OpenWrite(ioBindings.resolve(spec.Target), flag, 0644)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", spec.Target, err)
+	}
+
+	ioBindings.Stdout = file
+	ioBindings.Stderr = file
+	return func() { file.Close() }, nil
+
+}
+
+// ErrBadFileDescriptor is returned when a duplication such as 2>&N names a
+// file descriptor the shell cannot duplicate.
+//
+// Example command that triggers this error:
+//
+//	$ echo hello 1>&7
+//	redirection error: invalid redirection '1>& 7': bad file descriptor
+var ErrBadFileDescriptor = errors.New("bad file descriptor")
+
+// DuplicationRedirectionHandler makes one output descriptor a copy of
+// another.
+//
+// Supported operators:
+//   - N>& : Make descriptor N (1 or 2) write where the target descriptor
+//     currently writes
+//   - >&  : Same as 1>&, or the same as &> when the target is a file name
+//
+// Duplication copies the binding as it is at that point, so the order of
+// redirections matters:
+//   - cmd > out 2>&1 : Both streams go to out
+//   - cmd 2>&1 > out : Stderr goes to the original stdout, stdout to out
+//
+// Example usage:
+//
+//	handler := &DuplicationRedirectionHandler{}
+//	handler.CanHandle("2>&")  // returns true
+//	handler.CanHandle("2>")   // returns false
+type DuplicationRedirectionHandler struct{}
+
+// CanHandle returns true for >&, 1>& and 2>&.
+//
+// Parameters:
+//   - operator: The operator to check
+//
+// Returns:
+//   - bool: true for a duplication of stdout or stderr
+func (handler *DuplicationRedirectionHandler) CanHandle(operator string) bool {
+	return operator == ">&" || operator == "1>&" || operator == "2>&"
+}
+
+// Validate checks that the target is present and, for the numbered forms,
+// names stdout or stderr.
+//
+// Parameters:
+//   - spec: The redirection specification to validate
+//
+// Returns:
+//   - error: ErrMissingRedirectDestination if Target is empty,
+//     ErrBadFileDescriptor if it is a descriptor other than 1 or 2
+func (handler *DuplicationRedirectionHandler) Validate(spec RedirectionSpec) error {
+	if spec.Target == "" {
+		return ErrMissingRedirectDestination
+	}
+
+	if isDescriptorNumber(spec.Target) || spec.Operator != ">&" {
+		if spec.Target != "1" && spec.Target != "2" {
+			return ErrBadFileDescriptor
+		}
+	}
+
+	return nil
+}
+
+// Apply binds the operator's descriptor to the writer of the target
+// descriptor. A >& with a file name target is handed to a
+// CombinedRedirectionHandler instead.
+//
+// Parameters:
+//   - spec: Redirection specification whose Target is "1" or "2"
+//   - ioBindings: I/O bindings to modify (Stdout or Stderr will be replaced)
+//   - opener: File opener, used only for the file name form of >&
+//
+// Returns:
+//   - cleanup: nil for a duplication, or the file's cleanup for >& file
+//   - error: File opening errors for >& file
+func (handler *DuplicationRedirectionHandler) Apply(spec RedirectionSpec, ioBindings *IOBindings, opener FileOpener) (cleanup func(), err error) {
+
+	if !isDescriptorNumber(spec.Target) {
+		combined := &CombinedRedirectionHandler{Overwrite: true}
+		return combined.Apply(spec, ioBindings, opener)
+	}
+
+	target := ioBindings.Stdout
+	if spec.Target == "2" {
+		target = ioBindings.Stderr
+	}
+
+	if spec.Operator == "2>&" {
+		ioBindings.Stderr = target
+	} else {
+		ioBindings.Stdout = target
+	}
+
+	return nil, nil
+}
+
+// InputDuplicationHandler makes standard input a copy of another input
+// descriptor.
+//
+// Supported operators:
+//   - <&, 0<& : Read standard input from the target descriptor
+//
+// Standard input is the only input descriptor the shell keeps, so the only
+// valid target is 0, and the duplication leaves stdin as it is: `cat <&0`
+// reads the shell's stdin, or whatever an earlier redirection bound it to.
+//
+// Example usage:
+//
+//	handler := &InputDuplicationHandler{}
+//	handler.CanHandle("<&")  // returns true
+//	handler.CanHandle("<")   // returns false
+type InputDuplicationHandler struct{}
+
+// CanHandle returns true for <& and 0<&.
+//
+// Parameters:
+//   - operator: The operator to check
+//
+// Returns:
+//   - bool: true for a duplication of stdin
+func (handler *InputDuplicationHandler) CanHandle(operator string) bool {
+	return operator == "<&" || operator == "0<&"
+}
+
+// Validate checks that the target is present and names stdin.
+//
+// Parameters:
+//   - spec: The redirection specification to validate
+//
+// Returns:
+//   - error: ErrMissingRedirectDestination if Target is empty,
+//     ErrBadFileDescriptor if it is anything but 0
+func (handler *InputDuplicationHandler) Validate(spec RedirectionSpec) error {
+	if spec.Target == "" {
+		return ErrMissingRedirectDestination
+	}
+
+	if spec.Target != "0" {
+		return ErrBadFileDescriptor
+	}
+
+	return nil
+}
+
+// Apply keeps stdin bound where it is, since its target is stdin itself.
+//
+// Parameters:
+//   - spec: Redirection specification whose Target is "0"
+//   - ioBindings: I/O bindings, left unchanged
+//   - opener: Unused; no file is opened
+//
+// Returns:
+//   - cleanup: nil, as there is nothing to close
+//   - error: Always nil
+func (handler *InputDuplicationHandler) Apply(spec RedirectionSpec, ioBindings *IOBindings, opener FileOpener) (cleanup func(), err error) {
+	return nil, nil
+}
+
+// isDescriptorNumber reports whether s is a non-empty run of digits.
+func isDescriptorNumber(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
 // RedirectionManager coordinates multiple redirection handlers and manages
 // the I/O redirection lifecycle.
 //
@@ -504,6 +937,13 @@ func (rManager *RedirectionManager) GetHandler(operator string) (RedirectionHand
 //   - >> and 1>> : Stdout append
 //   - 2>         : Stderr overwrite
 //   - 2>>        : Stderr append
+//   - < and 0<   : Stdin from a file
+//   - << and <<- : Here-documents
+//   - <<<        : Here-strings
+//   - &>         : Stdout and stderr overwrite
+//   - &>>        : Stdout and stderr append
+//   - >&, 1>&, 2>& : Duplication (2>&1), or >& file like &>
+//   - <&, 0<&    : Stdin duplication (<&0)
 //
 // Parameters:
 //   - fileOpener: Implementation of FileOpener for file operations.
@@ -547,6 +987,39 @@ func NewRedirectionManager(fileOpener FileOpener) *RedirectionManager {
 	rManager.RegisterHandler(&StderrRedirectionHandler{Overwrite: false})
 	rManager.RegisterKnownOperator("2>>")
 
+	// < , 0<
+	rManager.RegisterHandler(&StdinRedirectionHandler{})
+	rManager.RegisterKnownOperator("<")
+	rManager.RegisterKnownOperator("0<")
+
+	// << , <<-
+	rManager.RegisterHandler(&HereDocumentHandler{})
+	rManager.RegisterKnownOperator("<<")
+	rManager.RegisterKnownOperator("<<-")
+
+	// <<<
+	rManager.RegisterHandler(&HereStringHandler{})
+	rManager.RegisterKnownOperator("<<<")
+
+	// &>
+	rManager.RegisterHandler(&CombinedRedirectionHandler{Overwrite: true})
+	rManager.RegisterKnownOperator("&>")
+
+	// &>>
+	rManager.RegisterHandler(&CombinedRedirectionHandler{Overwrite: false})
+	rManager.RegisterKnownOperator("&>>")
+
+	// >& , 1>& , 2>&
+	rManager.RegisterHandler(&DuplicationRedirectionHandler{})
+	rManager.RegisterKnownOperator(">&")
+	rManager.RegisterKnownOperator("1>&")
+	rManager.RegisterKnownOperator("2>&")
+
+	// <& , 0<&
+	rManager.RegisterHandler(&InputDuplicationHandler{})
+	rManager.RegisterKnownOperator("<&")
+	rManager.RegisterKnownOperator("0<&")
+
 	return rManager
 
 }
@@ -647,9 +1120,12 @@ func (rManager *RedirectionManager) ValidateSpecs(specs []RedirectionSpec) error
 //   - Later redirections can override earlier ones
 //   - Example: "cmd > a.txt > b.txt" results in output to b.txt
 //
+// Relative file names are opened from baseBindings.Dir, the working
+// directory of the shell running the command, when it is set.
+//
 // Parameters:
 //   - specs: Redirection specifications to apply
-//   - baseBindings: Original I/O bindings (Stdin, Stdout, Stderr)
+//   - baseBindings: Original I/O bindings (Stdin, Stdout, Stderr, Dir)
 //
 // Returns:
 //   - IOBindings: Modified bindings with redirections applied
@@ -681,11 +1157,7 @@ func (rManager *RedirectionManager) ApplyRedirections(specs []RedirectionSpec, b
 
 	cleanupFuncs := []func(){}
 
-	bindings := IOBindings{
-		Stdin:  baseBindings.Stdin,
-		Stdout: baseBindings.Stdout,
-		Stderr: baseBindings.Stderr,
-	}
+	bindings := baseBindings
 
 	for _, spec := range specs {
 
@@ -790,7 +1262,9 @@ func NewArgumentParser(rManager *RedirectionManager) *ArgumentParser {
 //     - Add to regular arguments
 //
 // Error conditions:
-//   - Operator at end of list without target
+//   - Operator at end of list without target, reported as a *ParseError
+//     wrapping ErrSyntax, positioned at the end of the space-joined
+//     arguments
 //
 // Parameters:
 //   - args: Command arguments including redirection operators
@@ -808,7 +1282,7 @@ func NewArgumentParser(rManager *RedirectionManager) *ArgumentParser {
 //	  → ParsedCommand{Args: []string{"ls", "-l"}, Redirections: []}, nil
 //
 //	Parse([]string{"echo", "test", ">"})
-//	  → ParsedCommand{}, error("missing target for redirection '>' at position 2")
+//	  → ParsedCommand{}, *ParseError("syntax error near unexpected token `newline' (expected a file name)")
 func (argumentParser *ArgumentParser) Parse(args []string) (ParsedCommand, error) {
 
 	parsedCommand := ParsedCommand{
@@ -826,7 +1300,8 @@ func (argumentParser *ArgumentParser) Parse(args []string) (ParsedCommand, error
 
 			// if there is no target then return error
 			if i == len(args)-1 {
-				return parsedCommand, fmt.Errorf("missing target for redirection '%s' at position %d", arg, i)
+				text := strings.Join(args, " ")
+				return parsedCommand, newParseError(text, len(text), ErrSyntax, "a file name", "newline")
 			}
 
 			spec := RedirectionSpec{
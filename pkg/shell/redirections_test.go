@@ -0,0 +1,266 @@
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// bufferOpener is a FileOpener that writes to in-memory buffers.
+type bufferOpener map[string]*bytes.Buffer
+
+func (m bufferOpener) OpenRead(name string) (io.ReadCloser, error) {
+	return nil, os.ErrNotExist
+}
+
+func (m bufferOpener) OpenWrite(name string, flag int, perm os.FileMode) (io.WriteCloser, error) {
+	if m[name] == nil || flag&os.O_TRUNC != 0 {
+		m[name] = &bytes.Buffer{}
+	}
+
+	return nopWriteCloser{m[name]}, nil
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestApplyRedirections_Duplication(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		specs       []RedirectionSpec
+		expected    map[string]string
+		expectedErr error
+	}{
+		{
+			name:     "stderr to stdout after redirecting stdout",
+			specs:    []RedirectionSpec{{Operator: ">", Target: "out"}, {Operator: "2>&", Target: "1"}},
+			expected: map[string]string{"out": "o\ne\n", "stdout": "", "stderr": ""},
+		},
+		{
+			name:     "stderr to stdout before redirecting stdout",
+			specs:    []RedirectionSpec{{Operator: "2>&", Target: "1"}, {Operator: ">", Target: "out"}},
+			expected: map[string]string{"out": "o\n", "stdout": "e\n", "stderr": ""},
+		},
+		{
+			name:     "stdout to stderr",
+			specs:    []RedirectionSpec{{Operator: ">&", Target: "2"}},
+			expected: map[string]string{"stdout": "", "stderr": "o\ne\n"},
+		},
+		{
+			name:     "both streams to a file",
+			specs:    []RedirectionSpec{{Operator: "&>", Target: "all"}},
+			expected: map[string]string{"all": "o\ne\n", "stdout": "", "stderr": ""},
+		},
+		{
+			name:     ">& with a file name",
+			specs:    []RedirectionSpec{{Operator: ">&", Target: "all"}},
+			expected: map[string]string{"all": "o\ne\n", "stdout": "", "stderr": ""},
+		},
+		{
+			name:        "unknown descriptor",
+			specs:       []RedirectionSpec{{Operator: "2>&", Target: "7"}},
+			expectedErr: ErrBadFileDescriptor,
+		},
+		{
+			name:        "unsupported io-number",
+			specs:       []RedirectionSpec{{Operator: "3>", Target: "out"}},
+			expectedErr: nil,
+		},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			opener := bufferOpener{"stdout": &bytes.Buffer{}, "stderr": &bytes.Buffer{}}
+			manager := NewRedirectionManager(opener)
+			base := IOBindings{Stdout: opener["stdout"], Stderr: opener["stderr"]}
+
+			bindings, cleanup, err := manager.ApplyRedirections(tt.specs, base)
+
+			if tt.expected == nil {
+				if err == nil || (tt.expectedErr != nil && !errors.Is(err, tt.expectedErr)) {
+					t.Errorf("Expected error: %v got %v", tt.expectedErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+
+			if cleanup != nil {
+				defer cleanup()
+			}
+
+			fmt.Fprintln(bindings.Stdout, "o")
+			fmt.Fprintln(bindings.Stderr, "e")
+
+			for name, expected := range tt.expected {
+				if got := opener[name].String(); got != expected {
+					t.Errorf("%s: expected %q got %q", name, expected, got)
+				}
+			}
+
+		})
+
+	}
+
+}
+
+func TestArgumentParser_MissingTarget(t *testing.T) {
+
+	_, err := NewArgumentParser(NewRedirectionManager(&DefaultFileOpener{})).Parse([]string{"echo", "test", ">"})
+
+	var parseErr *ParseError
+
+	if !errors.As(err, &parseErr) || !errors.Is(err, ErrSyntax) {
+		t.Fatalf("expected a syntax *ParseError got %v", err)
+	}
+
+	if parseErr.Position.Column != 12 || parseErr.Found != "newline" {
+		t.Errorf("expected column 12 at `newline' got %d at %q", parseErr.Position.Column, parseErr.Found)
+	}
+
+}
+
+func TestRunRedirections_Duplication(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		script         string
+		expected       string
+		expectedStatus int
+	}{
+		{name: "target touching the next redirection", script: "{ echo o; echo e >&2; } 2>&1>/dev/null | cat", expected: "e\n"},
+		{name: "stdout to stderr touching a redirection", script: "{ echo x 1>&2>/dev/null; } 2>&1 | cat", expected: ""},
+		{name: "stdin from stdin", script: "cat <&0 <<< hi", expected: "hi\n"},
+		{name: "numbered stdin from stdin", script: "cat 0<&0 <<< hi", expected: "hi\n"},
+		{name: "stdin from another descriptor", script: "cat <&5", expectedStatus: 1},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, status := runScript(t, tt.script)
+
+			if got != tt.expected {
+				t.Errorf("script: %q\nexpected: %q\ngot:      %q", tt.script, tt.expected, got)
+			}
+
+			if status != tt.expectedStatus {
+				t.Errorf("expected status %d got %d", tt.expectedStatus, status)
+			}
+
+		})
+
+	}
+
+}
+
+func TestRunRedirections_GlobTarget(t *testing.T) {
+
+	dir := t.TempDir()
+
+	for _, name := range []string{"a.go", "b.go", "one.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name           string
+		script         string
+		expected       string
+		expectedStatus int
+	}{
+		{name: "single match", script: "echo hi > *.txt; cat one.txt", expected: "hi\n"},
+		{name: "several matches are ambiguous", script: "echo hi > *.go", expectedStatus: 1},
+		{name: "ambiguous target runs nothing", script: "echo hi > *.go; cat a.go b.go", expected: ""},
+		{name: "no match is literal", script: "echo hi > '*.none'; echo x > *.none; cat '*.none'", expected: "x\n"},
+		{name: "quoted pattern is literal", script: "echo q > '*.go'; cat '*.go'", expected: "q\n"},
+		{name: "nullglob leaves no target", script: "shopt -s nullglob; echo hi > *.rs", expectedStatus: 1},
+		{name: "here-string is not globbed", script: "cat <<< *.go", expected: "*.go\n"},
+		{name: "here-string with one match is not globbed", script: "cat <<< o*.txt", expected: "o*.txt\n"},
+		{name: "compound command target", script: "{ echo g; } > o*.txt; cat one.txt", expected: "g\n"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, status := runScript(t, "cd "+dir+"; "+tt.script)
+
+			if got != tt.expected {
+				t.Errorf("script: %q\nexpected: %q\ngot:      %q", tt.script, tt.expected, got)
+			}
+
+			if status != tt.expectedStatus {
+				t.Errorf("expected status %d got %d", tt.expectedStatus, status)
+			}
+
+		})
+
+	}
+
+}
+
+func TestExpandRedirects_GlobsOnlyFiles(t *testing.T) {
+
+	dir := t.TempDir()
+
+	for _, name := range []string{"1", "a.go", "b.go", "one.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "file target", input: "cat > o*.txt", expected: "one.txt"},
+		{name: "here-string with a pattern", input: "cat <<< *", expected: "*"},
+		{name: "here-string with a matching pattern", input: "cat <<< a.*", expected: "a.*"},
+		{name: "output duplication", input: "cat 2>&?", expected: "?"},
+		{name: "input duplication", input: "cat <&?", expected: "?"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			sh := New(strings.NewReader(""), io.Discard, io.Discard)
+			sh.dir = dir
+
+			list, err := sh.parser.ParseTree(tt.input)
+
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+
+			command := list.Pipelines[0].Commands[0].(*SimpleCommand)
+			specs, err := sh.expandRedirects(command.Redirects, command.Words)
+
+			if err != nil {
+				t.Fatalf("Expected no error got %v", err)
+			}
+
+			if got := specs[0].Target; got != tt.expected {
+				t.Errorf("input: %q\nexpected target: %q\ngot:             %q", tt.input, tt.expected, got)
+			}
+
+		})
+
+	}
+
+}
@@ -12,6 +12,84 @@
 //   - >>  or 1>>  : Redirect stdout (append)
 //   - 2>          : Redirect stderr (overwrite)
 //   - 2>>         : Redirect stderr (append)
+//   - &>  or &>>  : Redirect stdout and stderr together
+//   - 2>&1, 1>&2  : Duplicate one output stream onto the other
+//   - <&0         : Duplicate stdin (the only input descriptor)
+//
+// Operators need no surrounding spaces: echo hi>out.txt redirects, and a
+// descriptor number must touch its operator (2>err, not 2 >err). The
+// target of a duplication is a word of its own, so cmd 2>&1>out is 2>&1
+// followed by >out.
+//
+// Process substitutions, <(cmd) and >(cmd), run cmd alongside the command
+// and stand for a /dev/fd path connected to its output or input; external
+// commands inherit the pipe through IOBindings.ExtraFiles:
+//
+//	diff <(sort a.txt) <(sort b.txt)
+//
+// # Compound Commands
+//
+// Conditionals run a list when a condition list succeeds, and may be
+// redirected or piped as a whole:
+//
+//	if test -f go.mod; then go build; elif test -f Makefile; then make; else echo "nothing to build"; fi > build.log
+//
+// Case commands run the first item whose pattern matches a word:
+//
+//	case $file in *.tar.gz) tar xzf "$file" ;; *.zip) unzip "$file" ;; *) echo "unknown" ;; esac
+//
+// Loops repeat a list over words, while an arithmetic condition holds, or
+// while (or until) a condition list succeeds; break and continue unwind
+// them:
+//
+//	for f in *.log; do gzip "$f"; done
+//	for ((i = 0; i < 3; i++)); do echo $i; done
+//	until test -f ready; do sleep 1; done
+//
+// Functions group commands under a name; each call has its own positional
+// parameters, and local variables are restored when it returns:
+//
+//	greet() { local who=${1:-world}; echo "hello $who"; }
+//	greet you
+//
+// Scripts get their positional parameters from SetScript, and set -- can
+// replace them; "$@" expands to one word per parameter, and the special
+// parameters $?, $$ and $0 give the last status, the process ID and the
+// script's name:
+//
+//	set -- a 'b c'
+//	for arg in "$@"; do echo "$0: $arg"; done
+//
+// Unquoted expansion results are split into fields at the characters of
+// IFS, while double-quoted ones stay whole:
+//
+//	IFS=:; for dir in $PATH; do ls "$dir"; done
+//
+// Arrays are assigned whole or by element, indexed by number or, once
+// declared with declare -A, by string:
+//
+//	files=(*.go); echo "${#files[@]} files, first ${files[0]}"
+//	declare -A port=([http]=80); port[https]=443
+//
+// Aliases replace the first word of a command when it is parsed:
+//
+//	alias ll='ls -l'
+//
+// Brace groups run a list in the current shell, while subshells run it in a
+// copy with its own working directory, variables and functions:
+//
+//	{ date; uptime; } > status.txt
+//	(cd build && make)
+//
+// # Syntax Errors
+//
+// Parse errors are *ParseError values that wrap ErrSyntax, ErrUnclosedQuote
+// or ErrUnclosedExpansion with the line and column of the error, the token
+// found there and what was expected instead. Run reports them without
+// stopping: interactively with a caret under the error (see
+// ParseError.Diagnostic), and in scripts as file:line:column:
+//
+//	build.sh:3:6: syntax error near unexpected token `|' (expected a command)
 //
 // # Basic Usage
 //
@@ -35,8 +113,8 @@
 // # Architecture
 //
 // The shell uses a modular architecture with pluggable components:
-//   - Parser: Tokenizes command lines with quote and escape handling
-//   - ArgumentParser: Separates regular arguments from redirection operators
+//   - Parser: Parses command text into a syntax tree of lists, pipelines,
+//     commands and words, and expands words with quote and escape handling
 //   - RedirectionManager: Manages file opening and I/O stream binding
 //   - Executor:  Executes external commands via os/exec
 //
@@ -53,7 +131,10 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
 )
 
 // ErrExit is returned by built-in commands to signal that the shell should
@@ -62,11 +143,16 @@ import (
 //
 // Example usage in a custom builtin:
 //
-//	shell.builtins["quit"] = func(args []string, s *Shell) error {
-//	    return shell.ErrExit
+//	shell.builtins["quit"] = func(args []string, s *Shell) (int, error) {
+//	    return 0, shell.ErrExit
 //	}
 var ErrExit = errors.New("exit")
 
+// statusBrokenPipe is the status of a command killed by SIGPIPE, 128 plus
+// the signal number, which builtins also get when they write to a pipe
+// whose reader has exited.
+const statusBrokenPipe = 128 + int(syscall.SIGPIPE)
+
 // Builtin is the function signature for implementing custom built-in commands.
 //
 // Built-in commands are executed directly by the shell without spawning
@@ -81,9 +167,15 @@ var ErrExit = errors.New("exit")
 //     (s.Out, s.Err) and other shell facilities.
 //
 // Returns:
-//   - error: Return nil for success, ErrExit to terminate the shell gracefully,
-//     or any other error to indicate command failure.  Errors are printed to
-//     stderr but do not terminate the shell.
+//   - int: Exit status of the command. 0 means success and any other value
+//     means failure; the status drives && and || in command lists.
+//   - error: Return nil for normal completion (successful or not), ErrExit
+//     to terminate the shell gracefully with the returned status, or any
+//     other error for unexpected failures. Such errors are printed to stderr
+//     and the command's status becomes 1 if it was 0, but they do not
+//     terminate the shell. Write errors on s.Out should be returned as
+//     they are: a write to a closed pipe (EPIPE) ends the shell running
+//     the builtin with status 141, as SIGPIPE would.
 //
 // The shell automatically manages I/O redirection for built-in commands,
 // temporarily replacing s.Out and s.Err before calling the builtin and
@@ -91,15 +183,15 @@ var ErrExit = errors.New("exit")
 //
 // Example custom builtin:
 //
-//	myBuiltin := func(args []string, s *Shell) error {
+//	myBuiltin := func(args []string, s *Shell) (int, error) {
 //	    if len(args) == 0 {
 //	        fmt.Fprintln(s. Err, "error: missing argument")
-//	        return nil // Continue shell even on error
+//	        return 1, nil // Report failure but continue the shell
 //	    }
 //	    fmt.Fprintln(s. Out, "Processing:", args[0])
-//	    return nil
+//	    return 0, nil
 //	}
-type Builtin func(args []string, s *Shell) error
+type Builtin func(args []string, s *Shell) (int, error)
 
 // Shell represents a command-line shell instance with configurable I/O streams
 // and pluggable components for parsing, execution, and redirection.
@@ -118,22 +210,39 @@ type Builtin func(args []string, s *Shell) error
 // Fields are unexported to maintain encapsulation and prevent external
 // modification of internal state.  Use the New constructor to create instances.
 type Shell struct {
-	in                 *bufio.Reader       // Buffered command input reader
-	Out                io.Writer           // Standard output stream (exported for builtin access)
-	Err                io.Writer           // Standard error stream (exported for builtin access)
-	pathDirs           []string            // Directories from PATH environment variable
-	builtins           map[string]Builtin  // Registry of built-in command implementations
-	executor           Executor            // External command executor
-	parser             Parser              // Command line tokenizer
-	argumentParser     *ArgumentParser     // Separates args from redirection operators
-	redirectionManager *RedirectionManager // Manages file I/O for redirections
+	in                 *bufio.Reader                  // Buffered command input reader
+	stdin              io.Reader                      // Stdin inherited by commands (nil unless input is a file or SetStdin)
+	Out                io.Writer                      // Standard output stream (exported for builtin access)
+	Err                io.Writer                      // Standard error stream (exported for builtin access)
+	pathDirs           []string                       // Directories from PATH environment variable
+	builtins           map[string]Builtin             // Registry of built-in command implementations
+	executor           Executor                       // External command executor
+	parser             *DefaultParser                 // Parses command text into syntax trees
+	expander           shellExpander                  // Resolves $ expansions against this shell
+	redirectionManager *RedirectionManager            // Manages file I/O for redirections
+	lastStatus         int                            // Exit status of the most recent command list
+	substitutionStatus int                            // Exit status of the last command substitution of the current command
+	vars               map[string]*shellVariable      // Shell variables, seeded from the environment
+	options            map[string]bool                // Options set with shopt, such as nullglob
+	dir                string                         // Working directory, changed by cd without touching the process's
+	loopDepth          int                            // Number of loops currently running, for break and continue
+	functions          map[string]*FunctionDefinition // Shell functions by name
+	params             []string                       // Positional parameters $1, $2, ... of the running function
+	frames             []*callFrame                   // Function calls in progress, innermost last
+	aliases            map[string]string              // Aliases by name, expanded when commands are parsed
+	name               string                         // $0: the script being run, or the shell's own name
+	interactive        bool                           // Whether prompts are printed
+	substitutions      []*processSubstitution         // Process substitutions whose commands are running
+	lineNumber         int                            // Lines of input read so far, for the positions of errors in scripts
 }
 
 // New creates and initializes a new Shell instance with the specified I/O streams.
 //
 // The constructor sets up all necessary components and initializes the shell's
-// state from the environment. The PATH is captured at creation time; subsequent
-// changes to the PATH environment variable will not affect this shell instance.
+// state from the environment. The environment is copied into the shell's own
+// variable table at creation time; later changes to the process environment
+// do not affect this shell instance, while assigning PATH inside the shell
+// does.
 //
 // Parameters:
 //   - reader: Input stream for reading commands. Use os.Stdin for interactive shells
@@ -146,10 +255,13 @@ type Shell struct {
 //
 // Initialization steps:
 //  1. Reads and parses the PATH environment variable
-//  2. Registers built-in commands:  echo, exit, type, pwd, cd
-//  3. Initializes command parser with quote and escape handling
-//  4. Configures redirection manager with operators:  >, >>, 1>, 1>>, 2>, 2>>
-//  5. Sets up default executor for external command execution
+//  2. Copies the process environment into the shell's variable table
+//  3. Registers built-in commands:  echo, exit, type, pwd, cd, export, unset,
+//     set, declare, break, continue, local, return, alias, unalias, shopt
+//  4. Initializes command parser with quote, escape, $VAR and glob handling
+//  5. Configures redirection manager with operators:  >, >>, 1>, 1>>, 2>, 2>>,
+//     &>, &>>, >&, 1>&, 2>&, <, 0<, <&, 0<&, <<, <<-, <<<
+//  6. Sets up default executor for external command execution
 //
 // Example for interactive shell:
 //
@@ -173,25 +285,42 @@ type Shell struct {
 //	sh := shell.New(script, os.Stdout, os.Stderr)
 //	sh.Run()
 func New(reader io.Reader, out, errw io.Writer) *Shell {
-	path := os.Getenv("PATH")
-	var dirs []string
-
-	if path != "" {
-		dirs = strings.Split(path, string(os.PathListSeparator))
+	// only hand real files to child processes; copying from a buffered
+	// reader would consume the shell's own input
+	var stdin io.Reader
+	if file, ok := reader.(*os.File); ok {
+		stdin = file
 	}
 
 	shell := &Shell{
-		in:       bufio.NewReader(reader),
-		Out:      out,
-		Err:      errw,
-		pathDirs: dirs,
-		builtins: make(map[string]Builtin),
+		in:          bufio.NewReader(reader),
+		stdin:       stdin,
+		Out:         out,
+		Err:         errw,
+		pathDirs:    splitPath(os.Getenv("PATH")),
+		builtins:    make(map[string]Builtin),
+		vars:        make(map[string]*shellVariable),
+		options:     make(map[string]bool),
+		functions:   make(map[string]*FunctionDefinition),
+		aliases:     make(map[string]string),
+		name:        "shell",
+		interactive: true,
+	}
+
+	if len(os.Args) > 0 {
+		shell.name = os.Args[0]
+	}
+
+	shell.loadEnvironment()
+
+	if dir, err := os.Getwd(); err == nil {
+		shell.dir = dir
+		shell.setVar("PWD", dir)
 	}
 
 	shell.executor = &DefaultExecutor{LookupFunc: shell.Lookup}
-	shell.parser = NewDefaultParser()
+	shell.bindParser()
 	shell.redirectionManager = NewRedirectionManager(&DefaultFileOpener{})
-	shell.argumentParser = NewArgumentParser(shell.redirectionManager)
 	shell.registerBuiltins()
 	return shell
 }
@@ -200,36 +329,49 @@ func New(reader io.Reader, out, errw io.Writer) *Shell {
 //
 // The method runs an infinite loop that reads commands from the input stream,
 // parses and executes them, and displays results.  The loop continues until
-// the exit command is executed or a fatal error occurs.
+// the exit command is executed, the input ends or an I/O error occurs.
 //
 // Execution flow for each command:
 //  1. Display prompt "$ "
-//  2. Read a line of input
-//  3. Parse command and arguments (handling quotes and escapes)
-//  4. Separate redirection operators from regular arguments
-//  5. Apply I/O redirections (open files as needed)
-//  6. Execute built-in command or external program
-//  7. Clean up resources (close opened files)
-//  8. Repeat
+//  2. Read a line of input, plus the bodies of any here-documents on it.
+//     While the command is incomplete (open quote, trailing backslash or
+//     operator, unfinished if or {), display the PS2 prompt "> " and read
+//     more lines (see readCommand)
+//  3. Parse the text into a syntax tree: a command list of pipelines
+//     separated by unquoted ";", "&&" and "||", each made of commands
+//     separated by unquoted "|", with their words and redirections.
+//     Commands may be compound, such as if ... fi, case ... esac or
+//     loops, holding lists of their own; the tree is walked by runList,
+//     runPipeline and runCommand
+//  4. Expand each command's words (handling quotes and escapes)
+//  5. Expand the targets of its redirections
+//  6. Apply I/O redirections (open files as needed)
+//  7. Execute built-in commands, shell functions or external programs
+//     (looked up in that order), connecting
+//     pipeline stages with OS pipes and running them concurrently
+//  8. Clean up resources (close opened files and pipes)
+//  9. Decide from the exit status whether the next pipeline in the list runs
+//  10. Repeat
 //
 // Returns:
-//   - error: nil on graceful exit via the exit command, or non-nil for
-//     fatal errors (I/O failures, parse errors).
+//   - error: nil on graceful exit via the exit command or at the end of the
+//     input, or non-nil for I/O failures.
 //
 // Error handling behavior:
 //   - I/O read errors:  Returns immediately with the error
-//   - Parse errors: Returns immediately with the error
+//   - Syntax and parse errors: Prints to stderr, sets the status to 2 and
+//     continues to the next command
 //   - Redirection errors: Prints to stderr and continues to next command
 //   - Command not found: Prints to stderr and continues to next command
 //   - Command execution errors: Prints to stderr and continues to next command
-//   - Exit command (ErrExit): Returns nil for graceful shutdown
+//   - Exit command (ErrExit): Returns nil for graceful shutdown; the requested
+//     status is available from ExitStatus
 //
 // Resource management:
 //
-// The method ensures proper cleanup of file descriptors opened for redirection.
-// Cleanup functions are deferred and execute even if command execution fails.
-// However, note that defer in loops can accumulate; in practice, cleanup is
-// called explicitly before continuing to the next iteration.
+// The method ensures proper cleanup of file descriptors opened for redirection
+// and of the pipes that connect pipeline stages. Each command closes its
+// redirection files as soon as it finishes, even if execution fails.
 //
 // Example interactive session:
 //
@@ -241,6 +383,9 @@ func New(reader io.Reader, out, errw io.Writer) *Shell {
 //	shell.go
 //	$ pwd 2> /dev/null
 //	/home/user/project
+//	$ ls | grep go
+//	main.go
+//	shell.go
 //	$ exit
 //
 // Example programmatic usage:
@@ -253,110 +398,503 @@ func (shell *Shell) Run() error {
 	for {
 
 		// print $ for user to type in
-		fmt.Fprint(shell.Out, "$ ")
+		if shell.interactive {
+			fmt.Fprint(shell.Out, "$ ")
+		}
 
-		// get user input
-		line, err := shell.in.ReadString('\n')
+		// get user input, continued over several lines if incomplete
+		firstLine := shell.lineNumber + 1
+		command, err := shell.readCommand()
 
-		if err != nil {
+		// end of input ends the shell like the exit builtin
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		var parseErr *ParseError
+
+		if err != nil && !errors.As(err, &parseErr) {
 			return err
 		}
 
-		line = strings.TrimSpace(line)
-		if line == "" {
+		line := command.String()
+
+		if err == nil && strings.TrimSpace(line) == "" {
 			continue
 		}
 
-		// parse user input command to list of arguments
-		parsedArgs, err := shell.parser.Parse(line)
+		// parse into ;, && and || separated pipelines and run them
+		if err == nil {
+			err = shell.evaluate(line)
+		}
+
+		// exit builtin terminates the shell gracefully
+		if errors.Is(err, ErrExit) {
+			return nil
+		}
+
+		// a failed match under failglob abandons the rest of the command
+		if shell.globFailure(err) {
+			shell.lastStatus = 1
+			continue
+		}
 
+		// syntax errors only fail the command; the shell keeps running
 		if err != nil {
-			return err
+			shell.reportError(err, command, firstLine)
+			shell.lastStatus = 2
+		}
+
+	}
+
+}
+
+// reportError prints the error that ended a command read by Run.
+//
+// A *ParseError is shown with its position in the lines the user typed
+// (see commandText.locate), here-document bodies included. A script
+// reports it as file:line:col, counting lines from the start of the
+// script; when the error is inside other text, such as a command
+// substitution, only the line the command starts on is known. An
+// interactive shell prints the line holding the error with a caret under
+// it instead.
+//
+// Parameters:
+//   - err: The error
+//   - command: The command, as read by readCommand
+//   - firstLine: The line of the input the command starts on
+//
+// Example (interactive):
+//
+//	$ ls | | wc
+//	syntax error near unexpected token `|' (expected a command)
+//	ls | | wc
+//	     ^
+//
+// Example (script):
+//
+//	build.sh:3:6: syntax error near unexpected token `|' (expected a command)
+func (shell *Shell) reportError(err error, command *commandText, firstLine int) {
+	var parseErr *ParseError
+
+	if !errors.As(err, &parseErr) {
+		fmt.Fprintln(shell.Err, err)
+		return
+	}
+
+	if parseErr.Source == command.text {
+		parseErr = command.locate(parseErr)
+	}
+
+	switch {
+	case shell.interactive:
+		fmt.Fprintf(shell.Err, "%v\n%s\n", err, parseErr.Diagnostic())
+
+	case parseErr.Source == command.source:
+		line := firstLine + parseErr.Position.Line - 1
+		fmt.Fprintf(shell.Err, "%s:%d:%d: %v\n", shell.name, line, parseErr.Position.Column, err)
+
+	default:
+		fmt.Fprintf(shell.Err, "%s:%d: %v\n", shell.name, firstLine, err)
+	}
+}
+
+// runCommand executes a single command of a pipeline with the given base
+// I/O bindings.
+//
+// A simple command is expanded first (see expandSimpleCommand) and then run
+// by runSimpleCommand; a ((expr)) command is evaluated directly. Compound
+// commands run their lists in this shell with the bindings in place (see
+// runCompound).
+//
+// Parameters:
+//   - command: The parsed command
+//   - baseBindings: I/O streams the command inherits before redirection,
+//     such as the pipe ends of a pipeline stage
+//
+// Returns:
+//   - int: Exit status of the command
+//   - error: ErrExit when the exit builtin runs, errors from command
+//     substitutions that cannot be parsed, or ErrNoMatch when failglob is
+//     set and a pattern matches nothing (see globFailure). Other expansion
+//     errors such as ${var:?} are printed and give status 1 instead.
+func (shell *Shell) runCommand(command Command, baseBindings IOBindings) (int, error) {
+
+	// process substitutions expanded for the command end with it
+	defer shell.finishSubstitutions(len(shell.substitutions))
+
+	switch command := command.(type) {
+	case *ArithmeticCommand:
+		return shell.runArithmeticCommand(command.Expr), nil
+
+	case *IfClause:
+		return shell.runCompound(command.Redirects, baseBindings, func() (int, error) {
+			return shell.runIfClause(command)
+		})
+
+	case *FunctionDefinition:
+		shell.functions[command.Name] = command
+		return 0, nil
+
+	case *BraceGroup:
+		return shell.runCompound(command.Redirects, baseBindings, func() (int, error) {
+			err := shell.runList(command.Body)
+			return shell.lastStatus, err
+		})
+
+	case *Subshell:
+		return shell.runCompound(command.Redirects, baseBindings, func() (int, error) {
+			return shell.runSubshell(command)
+		})
+
+	case *CaseClause:
+		return shell.runCompound(command.Redirects, baseBindings, func() (int, error) {
+			return shell.runCaseClause(command)
+		})
+
+	case *ForClause:
+		return shell.runCompound(command.Redirects, baseBindings, func() (int, error) {
+			return shell.runForClause(command)
+		})
+
+	case *ArithmeticForClause:
+		return shell.runCompound(command.Redirects, baseBindings, func() (int, error) {
+			return shell.runArithmeticForClause(command)
+		})
+
+	case *WhileClause:
+		return shell.runCompound(command.Redirects, baseBindings, func() (int, error) {
+			return shell.runWhileClause(command)
+		})
+
+	case *SimpleCommand:
+		shell.substitutionStatus = 0
+		parsedCommand, err := shell.expandSimpleCommand(command)
+
+		// failed expansions fail the command, not the shell
+		if err != nil && shell.expansionFailure(err) {
+			return 1, nil
 		}
 
-		command := parsedArgs[0]
-		args := []string{}
-		if len(parsedArgs) > 1 {
-			args = parsedArgs[1:]
+		if err != nil {
+			return 2, err
 		}
 
-		// parse list of arguments to obtain proper redirections
-		parsedCommand, err := shell.argumentParser.Parse(args)
+		return shell.runSimpleCommand(parsedCommand, baseBindings)
+	}
+
+	return 2, fmt.Errorf("unsupported command %T", command)
+}
+
+// expandSimpleCommand expands the parts of a simple command into the
+// arguments, redirections and assignments it runs with.
+//
+// The words are expanded with ExpandWords, so they may produce any number
+// of arguments. Assignment values are expanded as single words, without
+// field splitting or filename expansion, as in other shells: `FILES=*.go`
+// stores the pattern itself. Redirection targets are single words too, but
+// file names are globbed (see expandRedirects). The elements of an array
+// assignment, NAME=(...), are expanded like words (see
+// expandArrayElements).
+//
+// Parameters:
+//   - command: The parsed simple command
+//
+// Returns:
+//   - ParsedCommand: The expanded command
+//   - error: Errors from the expander
+func (shell *Shell) expandSimpleCommand(command *SimpleCommand) (ParsedCommand, error) {
+
+	args, err := shell.parser.ExpandWords(command.Words)
+
+	if err != nil {
+		return ParsedCommand{}, err
+	}
+
+	redirections, err := shell.expandRedirects(command.Redirects, slices.Concat(command.Assignments, command.Words))
+
+	if err != nil {
+		return ParsedCommand{}, err
+	}
+
+	parsedCommand := ParsedCommand{
+		Args:         args,
+		Redirections: redirections,
+	}
+
+	for i, assignment := range command.Assignments {
+		expanded, _, err := shell.parser.expandSingleWord(assignment)
+
+		if err != nil {
+			return ParsedCommand{}, err
+		}
+
+		parsedCommand.Assignments = append(parsedCommand.Assignments, expanded)
+
+		if array := assignment.arrayValue(); array != nil {
+			elements, err := shell.parser.expandArrayElements(array.Text)
+
+			if err != nil {
+				return ParsedCommand{}, err
+			}
+
+			if parsedCommand.arrays == nil {
+				parsedCommand.arrays = map[int][]arrayElement{}
+			}
 
-		baseBindings := &IOBindings{
-			Stdin:  shell.in,
-			Stdout: shell.Out,
-			Stderr: shell.Err,
+			parsedCommand.arrays[i] = elements
 		}
+	}
+
+	return parsedCommand, nil
+}
+
+// expandRedirects expands the targets of redirections into the
+// specifications RedirectionManager applies.
+//
+// Every target is expanded as a single word. File names then undergo
+// filename expansion (see expandRedirectTarget), while the words of
+// here-strings and the descriptors of duplications such as 2>&1 are used
+// as they are: `cat <<< *` reads a literal "*".
+//
+// Parameters:
+//   - redirects: The parsed redirections
+//   - words: The other words of the command, used to compute the Index of
+//     each specification in the command as written
+//
+// Returns:
+//   - []RedirectionSpec: The expanded redirections, in order
+//   - error: Errors from the expander
+func (shell *Shell) expandRedirects(redirects []*Redirect, words []*Word) ([]RedirectionSpec, error) {
+	specs := []RedirectionSpec{}
 
-		// aply redirections to ioBindings for use in builtin and execution commands
-		ioBindings, cleanup, err := shell.redirectionManager.ApplyRedirections(parsedCommand.Redirections, *baseBindings)
+	for i, redirect := range redirects {
+		var target string
+		var err error
+
+		// only file names are globbed; here-strings, here-documents and
+		// descriptor numbers are used as they are
+		if isFileRedirection(redirect.Operator) {
+			target, err = shell.parser.expandRedirectTarget(redirect.Target)
+		} else {
+			target, _, err = shell.parser.expandSingleWord(redirect.Target)
+		}
 
 		if err != nil {
-			fmt.Fprintln(shell.Err, "redirection error:", err)
-			continue
+			return nil, err
 		}
 
-		if cleanup != nil {
-			defer cleanup()
+		// index in the command as written: the words before the operator,
+		// plus an operator and a target for every earlier redirection
+		index := 2 * i
+
+		for _, word := range words {
+			if word.Position.Offset < redirect.Position.Offset {
+				index++
+			}
 		}
 
-		// execute builtin or external command
-		if builtinFunc, ok := shell.builtins[command]; ok {
-			// temporarily swap shell I/O for builtins
-			prevOut := shell.Out
-			prevErr := shell.Err
+		specs = append(specs, RedirectionSpec{
+			Operator: redirect.Operator,
+			Target:   target,
+			Index:    index,
+		})
+	}
 
-			shell.Out = ioBindings.Stdout
-			shell.Err = ioBindings.Stderr
+	return specs, nil
+}
 
-			err := builtinFunc(parsedCommand.Args, shell)
+// isFileRedirection reports whether the target of a redirection operator is
+// a file name, rather than the text of a here-string or here-document or a
+// file descriptor to duplicate.
+func isFileRedirection(operator string) bool {
+	operator = strings.TrimLeft(operator, "0123456789")
+	return !strings.HasPrefix(operator, "<<") && !strings.HasSuffix(operator, "&")
+}
 
-			// restore original I/O
-			shell.Out = prevOut
-			shell.Err = prevErr
+// runSimpleCommand executes an expanded simple command with the given base
+// I/O bindings.
+//
+// The first argument is the command name. The method applies the
+// redirections on top of baseBindings and then dispatches to a builtin, a
+// shell function or, failing both, to the executor.
+//
+// The assignments are NAME=value words. On their own (`FOO=bar`) they set
+// shell variables; in front of an external command (`FOO=bar env`) they
+// are added to that command's environment only. A command with no name
+// still performs its redirections, so `> file` creates an empty file, and
+// its status is that of its last command substitution, or 0 without one:
+// `x=$(false) || echo failed` prints "failed".
+//
+// Builtins are run with shell.Out and shell.Err temporarily swapped for the
+// redirected streams. Any files opened for redirection are closed before
+// the method returns.
+//
+// Parameters:
+//   - parsedCommand: The expanded command
+//   - baseBindings: I/O streams the command inherits before redirection
+//
+// Returns:
+//   - int: Exit status of the command (127 when it is not found)
+//   - error: ErrExit (with the requested status) when the exit builtin
+//     runs, the loopControl or returnControl of break, continue and
+//     return, nil otherwise. Redirection and execution errors are printed
+//     to stderr instead.
+func (shell *Shell) runSimpleCommand(parsedCommand ParsedCommand, baseBindings IOBindings) (int, error) {
+
+	// apply redirections to ioBindings for use in builtin and execution commands
+	ioBindings, cleanup, err := shell.redirectionManager.ApplyRedirections(parsedCommand.Redirections, baseBindings)
+
+	if err != nil {
+		fmt.Fprintln(shell.Err, "redirection error:", err)
+		return 1, nil
+	}
 
-			if err != nil {
+	if cleanup != nil {
+		defer cleanup()
+	}
 
-				// if exiting run clean up
-				if errors.Is(err, ErrExit) {
-					if cleanup != nil {
-						cleanup()
-					}
-					return nil
-				}
+	if len(parsedCommand.Args) == 0 {
+		status := shell.substitutionStatus
+
+		for i, assignment := range parsedCommand.Assignments {
+			name, value, _ := splitAssignment(assignment)
+			err := shell.assign(name, value)
 
-				// else it is a built in error
-				fmt.Fprintln(shell.Err, "builtin error:", err)
+			if elements, ok := parsedCommand.arrays[i]; ok {
+				err = shell.assignArray(name, elements)
 			}
 
-			if cleanup != nil {
-				cleanup()
+			if err != nil {
+				fmt.Fprintln(shell.Err, err)
+				status = 1
 			}
-			continue
 		}
 
-		//execute command
-		exitCode, err := shell.executor.Execute(context.Background(), command, parsedCommand.Args, ioBindings)
+		return status, nil
+	}
 
-		if errors.Is(err, ErrNotFound) {
-			fmt.Fprintln(shell.Err, command+": command not found")
-			continue
-		}
+	command := parsedCommand.Args[0]
+	args := parsedCommand.Args[1:]
+
+	// execute builtin or external command
+	if builtinFunc, ok := shell.builtins[command]; ok {
+		// temporarily swap shell I/O for builtins
+		prevOut := shell.Out
+		prevErr := shell.Err
+
+		shell.Out = ioBindings.Stdout
+		shell.Err = ioBindings.Stderr
+
+		status, err := builtinFunc(args, shell)
+
+		// restore original I/O
+		shell.Out = prevOut
+		shell.Err = prevErr
 
 		if err != nil {
-			fmt.Fprintln(shell.Err, "error running command:", err)
-			continue
+
+			// exit, break and continue unwind the commands around them
+			if isControlFlow(err) {
+				return status, err
+			}
+
+			// a builtin writing to a pipe nobody reads dies like a process
+			// killed by SIGPIPE, taking its (sub)shell and loops with it
+			if errors.Is(err, syscall.EPIPE) {
+				return statusBrokenPipe, ErrExit
+			}
+
+			// else it is a built in error
+			fmt.Fprintln(shell.Err, "builtin error:", err)
+
+			if status == 0 {
+				status = 1
+			}
 		}
 
-		if cleanup != nil {
-			cleanup()
+		return status, nil
+	}
+
+	// functions come after builtins and before PATH lookup
+	if function, ok := shell.functions[command]; ok {
+		return shell.callFunction(function, args, ioBindings)
+	}
+
+	// external commands see exported variables plus any prefix assignments;
+	// arrays cannot be exported
+	var assignments []string
+
+	for i, assignment := range parsedCommand.Assignments {
+		if _, ok := parsedCommand.arrays[i]; !ok {
+			assignments = append(assignments, assignment)
 		}
+	}
 
-		_ = exitCode
+	ioBindings.Env = shell.environ(assignments)
+	ioBindings.ExtraFiles = shell.substitutionFiles()
 
+	//execute command
+	exitCode, err := shell.executor.Execute(context.Background(), command, args, ioBindings)
+
+	if errors.Is(err, ErrNotFound) {
+		fmt.Fprintln(shell.Err, command+": command not found")
+		return 127, nil
 	}
 
+	// the command was found but could not be started
+	if err != nil {
+		fmt.Fprintf(shell.Err, "%s: %v\n", command, err)
+		return exitCode, nil
+	}
+
+	return exitCode, nil
+}
+
+// ExitStatus returns the exit status of the most recently executed command
+// list, or the status passed to the exit builtin once Run has returned.
+//
+// Example:
+//
+//	sh := shell.New(os.Stdin, os.Stdout, os.Stderr)
+//	if err := sh.Run(); err != nil {
+//	    log.Fatal(err)
+//	}
+//	os.Exit(sh.ExitStatus())
+func (shell *Shell) ExitStatus() int {
+	return shell.lastStatus
+}
+
+// SetScript makes the shell run its input as a script rather than an
+// interactive session.
+//
+// The name becomes $0 and the arguments the positional parameters $1, $2,
+// ..., and Run no longer prints prompts. It must be called before Run.
+//
+// Parameters:
+//   - name: The script's file name, as given on the command line
+//   - args: The arguments after the script name
+//
+// Example:
+//
+//	file, _ := os.Open("build.sh")
+//	sh := shell.New(file, os.Stdout, os.Stderr)
+//	sh.SetScript("build.sh", []string{"release"}) // $0 is build.sh, $1 is release
+//	sh.Run()
+func (shell *Shell) SetScript(name string, args []string) {
+	shell.name = name
+	shell.params = args
+	shell.interactive = false
+}
+
+// SetStdin sets the stdin that commands inherit, which is otherwise the
+// shell's input when that is a file. A script read from a file uses it to
+// give its commands the process's stdin:
+//
+//	sh := shell.New(script, os.Stdout, os.Stderr)
+//	sh.SetStdin(os.Stdin)
+func (shell *Shell) SetStdin(stdin io.Reader) {
+	shell.stdin = stdin
 }
 
 // Lookup searches for an executable in the shell's PATH directories.
@@ -426,16 +964,21 @@ func (shell *Shell) Lookup(name string) (string, bool) {
 // Registered built-ins:
 //
 //   - echo: Prints arguments separated by spaces to stdout.
-//     Syntax: echo [args...]
+//     Syntax: echo [-neE] [args...]
+//     -n omits the trailing newline, -e decodes backslash escapes such as
+//     \t, \n and \0NNN (\c stops the output), and -E turns decoding off
+//     again. Any other argument ends the options.
 //     Example: echo hello world → "hello world"
+//     Example: echo -e 'a\tb' → "a<TAB>b"
 //
 //   - exit: Terminates the shell gracefully by returning ErrExit.
 //     Syntax: exit [code]
-//     Note: Exit code parameter is currently ignored.
+//     Without a code, the shell exits with the status of the last command.
 //
 //   - type: Displays information about how a command would be interpreted.
 //     Syntax: type <command>
-//     Shows whether a command is a builtin or external program.
+//     Shows whether a command is an alias, a builtin, a function (with its
+//     body) or an external program.
 //     Example: type echo → "echo is a shell builtin"
 //     Example: type ls → "ls is /bin/ls"
 //
@@ -443,7 +986,9 @@ func (shell *Shell) Lookup(name string) (string, bool) {
 //     Syntax: pwd
 //     Example: pwd → "/home/user/project"
 //
-//   - cd: Changes the current working directory.
+//   - cd: Changes the shell's working directory. The process's own stays
+//     put: relative paths are resolved from the shell's directory, which
+//     external commands start in and subshells copy.
 //     Syntax: cd [directory]
 //     Supports tilde expansion for home directory.
 //     With no args, changes to $HOME.
@@ -451,105 +996,344 @@ func (shell *Shell) Lookup(name string) (string, bool) {
 //     Example: cd ~
 //     Example: cd ~/Documents
 //
+//   - export: Marks variables for export to external commands.
+//     Syntax: export [NAME[=value]...]
+//     With no args, lists exported variables.
+//     Example: export EDITOR=vim
+//
+//   - unset: Removes shell variables, or single array elements.
+//     Syntax: unset NAME... or unset 'NAME[subscript]'
+//     Example: unset EDITOR
+//
+//   - set: Replaces the positional parameters $1, $2, ..., or lists the
+//     shell's variables when given no arguments.
+//     Syntax: set [--] [args...]
+//     Example: set -- a 'b c' → $# is 2, $2 is "b c"
+//
+//   - declare: Makes variables indexed (-a) or associative (-A) arrays,
+//     exports them (-x), assigns them, or prints them as declare commands
+//     (-p). Inside a function the variables are local unless -g is given.
+//     Syntax: declare [-aAxpg] [NAME[=value]...]
+//     Example: declare -A port=([http]=80)
+//
+//   - break, continue: Leave the enclosing loop, or skip to its next
+//     iteration. With a count N, apply to the Nth enclosing loop.
+//     Syntax: break [N], continue [N]
+//     Example: for d in a b; do for f in x y; do break 2; done; done
+//
+//   - local, return: Declare variables local to the running function, and
+//     leave it with a status. local takes the options of declare.
+//     Syntax: local [-aAx] NAME[=value]..., return [N]
+//     Example: f() { local x=1; return 3; }
+//
+//   - alias, unalias: Define, print or remove aliases, which replace the
+//     first word of a command when it is parsed.
+//     Syntax: alias [-p] [name[=value]...], unalias [-a] name...
+//     Example: alias ll='ls -l'
+//
 // Error handling:
 //
-// All built-ins return nil on success or non-fatal errors. They print
-// error messages to the shell's Err stream but allow the shell to continue.
-// Only the exit command returns ErrExit to terminate the shell.
+// All built-ins report failures through their exit status: they print
+// error messages to the shell's Err stream, return a non-zero status and
+// a nil error so the shell continues. Only the exit command returns
+// ErrExit to terminate the shell, break and continue return a loopControl
+// error that the enclosing loop handles, and return a returnControl error
+// that ends the running function. Builtins return the errors of writes to
+// shell.Out, so that one writing into a closed pipe stops (see Builtin).
 //
 // This method is not exported as built-in registration is handled
 // automatically during shell initialization.  Future versions may expose
 // a public RegisterBuiltin method for custom extensions.
 func (shell *Shell) registerBuiltins() {
 
-	shell.builtins["echo"] = func(args []string, shell *Shell) error {
-		fmt.Fprintln(shell.Out, strings.Join(args, " "))
-		return nil
+	shell.builtins["echo"] = func(args []string, shell *Shell) (int, error) {
+		newline, escapes := true, false
+
+		// options are only recognised before the first word that is not one
+		for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' && strings.Trim(args[0][1:], "neE") == "" {
+			for _, flag := range args[0][1:] {
+				switch flag {
+				case 'n':
+					newline = false
+				case 'e':
+					escapes = true
+				case 'E':
+					escapes = false
+				}
+			}
+
+			args = args[1:]
+		}
+
+		output := strings.Join(args, " ")
+
+		if escapes {
+			var stop bool
+			output, stop = decodeEscapes(output, echoEscapes)
+			newline = newline && !stop
+		}
+
+		if newline {
+			output += "\n"
+		}
+
+		if _, err := fmt.Fprint(shell.Out, output); err != nil {
+			return 1, err
+		}
+
+		return 0, nil
 	}
 
-	shell.builtins["exit"] = func(args []string, shell *Shell) error {
-		return ErrExit
+	shell.builtins["exit"] = func(args []string, shell *Shell) (int, error) {
+
+		if len(args) == 0 {
+			return shell.lastStatus, ErrExit
+		}
+
+		code, err := strconv.Atoi(args[0])
+
+		if err != nil {
+			fmt.Fprintf(shell.Err, "exit: %s: numeric argument required\n", args[0])
+			return 2, ErrExit
+		}
+
+		return code & 0xff, ErrExit
 	}
 
-	shell.builtins["type"] = func(args []string, shell *Shell) error {
+	shell.builtins["type"] = func(args []string, shell *Shell) (int, error) {
 
 		if len(args) == 0 {
 			fmt.Fprintln(shell.Out, "type: usage: type NAME")
-			return nil
+			return 2, nil
 		}
 
 		name := args[0]
 
+		if value, ok := shell.aliases[name]; ok {
+			_, err := fmt.Fprintf(shell.Out, "%s is aliased to `%s`\n", name, value)
+			return 0, err
+		}
+
 		// check builts in
 		if _, ok := shell.builtins[name]; ok {
-			fmt.Fprintln(shell.Out, name, "is a shell builtin")
-			return nil
+			_, err := fmt.Fprintln(shell.Out, name, "is a shell builtin")
+			return 0, err
+		}
+
+		if function, ok := shell.functions[name]; ok {
+			_, err := fmt.Fprintf(shell.Out, "%s is a function\n%s () \n%s\n", name, name, function.Source)
+			return 0, err
 		}
 
 		if path, ok := shell.Lookup(name); ok {
-			fmt.Fprintln(shell.Out, name, "is", path)
-			return nil
+			_, err := fmt.Fprintln(shell.Out, name, "is", path)
+			return 0, err
 		}
 
-		fmt.Fprintln(shell.Out, name+": not found")
-		return nil
+		_, err := fmt.Fprintln(shell.Out, name+": not found")
+		return 1, err
 	}
 
-	shell.builtins["pwd"] = func(args []string, shell *Shell) error {
+	shell.builtins["pwd"] = func(args []string, shell *Shell) (int, error) {
+		if shell.dir != "" {
+			_, err := fmt.Fprintln(shell.Out, shell.dir)
+			return 0, err
+		}
+
 		dir, err := os.Getwd()
-		if err == nil {
-			fmt.Fprintln(shell.Out, dir)
-		} else {
+		if err != nil {
 			fmt.Fprintln(shell.Err, "error finding directory:", err)
+			return 1, nil
 		}
 
-		return nil
+		_, err = fmt.Fprintln(shell.Out, dir)
+		return 0, err
 	}
 
-	shell.builtins["cd"] = func(args []string, shell *Shell) error {
+	shell.builtins["cd"] = func(args []string, shell *Shell) (int, error) {
 
 		var target string
 
 		if len(args) == 0 {
-			target = os.Getenv("HOME")
+			target, _ = shell.getVar("HOME")
 			if target == "" {
-				return nil //no home variable set
+				return 0, nil //no home variable set
 			}
 
 		} else {
 			target = args[0]
 		}
 
-		if strings.HasSuffix(target, "~") {
-			home := os.Getenv("HOME")
-			if home == "" {
-				fmt.Fprintln(shell.Err, "cd: HOME not set")
-				return nil
+		// cd - returns to the previous directory and prints it
+		printTarget := false
+		if target == "-" {
+			target, _ = shell.getVar("OLDPWD")
+			if target == "" {
+				fmt.Fprintln(shell.Err, "cd: OLDPWD not set")
+				return 1, nil
 			}
+			printTarget = true
+		}
 
-			if target == "~" {
-				target = home
-			} else if strings.HasSuffix(target, "~/") {
-				target = filepath.Join(home, target[2:])
-			} else {
-				fmt.Fprintf(shell.Err, "cd: unsupported user expansion: %s\n", target)
-				return nil
-			}
+		previous := shell.dir
+		dir := filepath.Clean(resolvePath(previous, target))
+
+		// stat of "dir/." also checks the search permission cd needs
+		info, err := os.Stat(dir)
+
+		if err == nil && info.IsDir() {
+			_, err = os.Stat(dir + string(os.PathSeparator) + ".")
 		}
 
-		if err := os.Chdir(target); err != nil {
+		if err != nil || !info.IsDir() {
 
-			if os.IsNotExist(err) {
+			if err == nil {
+				fmt.Fprintf(shell.Err, "cd: %s: Not a directory\n", target)
+			} else if os.IsNotExist(err) {
 				fmt.Fprintf(shell.Err, "cd: %s: No such file or directory\n", target)
 			} else if os.IsPermission(err) {
 				fmt.Fprintf(shell.Err, "cd: %s: Permission denied\n", target)
 			} else {
-				fmt.Fprintf(shell.Err, "cd: %s: %v", target, err)
+				fmt.Fprintf(shell.Err, "cd: %s: %v\n", target, err)
 			}
 
+			return 1, nil
 		}
 
-		return nil
+		// the directory belongs to this shell; the process never changes its own
+		shell.dir = dir
+		shell.setVar("OLDPWD", previous)
+		shell.setVar("PWD", dir)
+
+		if printTarget {
+			_, err = fmt.Fprintln(shell.Out, target)
+		}
+
+		return 0, err
+
+	}
+
+	shell.builtins["export"] = func(args []string, shell *Shell) (int, error) {
+
+		// with no arguments list exported variables
+		if len(args) == 0 {
+			for _, entry := range shell.environ(nil) {
+				name, value, _ := strings.Cut(entry, "=")
+				if _, err := fmt.Fprintf(shell.Out, "export %s=%q\n", name, value); err != nil {
+					return 1, err
+				}
+			}
+			return 0, nil
+		}
+
+		status := 0
+
+		for _, arg := range args {
+			name, value, hasValue := strings.Cut(arg, "=")
+
+			if !isValidName(name) {
+				fmt.Fprintf(shell.Err, "export: `%s': not a valid identifier\n", arg)
+				status = 1
+				continue
+			}
+
+			if hasValue {
+				shell.setVar(name, value)
+			}
+
+			shell.exportVar(name)
+		}
+
+		return status, nil
+	}
+
+	shell.builtins["unset"] = func(args []string, shell *Shell) (int, error) {
+		status := 0
+
+		for _, arg := range args {
+			name, subscript, ok := splitSubscript(arg)
+
+			if !ok {
+				shell.unsetVar(arg)
+				continue
+			}
+
+			if err := shell.unsetElement(name, subscript); err != nil {
+				fmt.Fprintf(shell.Err, "unset: %v\n", err)
+				status = 1
+			}
+		}
+
+		return status, nil
+	}
+
+	shell.builtins["set"] = setBuiltin
+	shell.builtins["declare"] = declareBuiltin
+	shell.builtins["break"] = loopControlBuiltin("break")
+	shell.builtins["continue"] = loopControlBuiltin("continue")
+	shell.builtins["local"] = localBuiltin
+	shell.builtins["return"] = returnBuiltin
+	shell.builtins["alias"] = aliasBuiltin
+	shell.builtins["unalias"] = unaliasBuiltin
+
+	shell.builtins["shopt"] = func(args []string, shell *Shell) (int, error) {
+		mode := ""
+
+		if len(args) > 0 && (args[0] == "-s" || args[0] == "-u") {
+			mode, args = args[0], args[1:]
+		}
+
+		// printOption prints an option and its state as "name<TAB>on"
+		printOption := func(name string) error {
+			state := "off"
+			if shell.options[name] {
+				state = "on"
+			}
+
+			_, err := fmt.Fprintf(shell.Out, "%s\t%s\n", name, state)
+			return err
+		}
+
+		// without names, list every option (or those in the given state)
+		if len(args) == 0 {
+			for _, name := range shellOptions {
+				if mode != "" && shell.options[name] != (mode == "-s") {
+					continue
+				}
+
+				if err := printOption(name); err != nil {
+					return 1, err
+				}
+			}
+			return 0, nil
+		}
+
+		status := 0
+
+		for _, name := range args {
+			if !slices.Contains(shellOptions, name) {
+				fmt.Fprintf(shell.Err, "shopt: %s: invalid shell option name\n", name)
+				status = 1
+				continue
+			}
+
+			switch mode {
+			case "-s":
+				shell.options[name] = true
+			case "-u":
+				shell.options[name] = false
+			default:
+				// querying an option prints it and reports whether it is set
+				if err := printOption(name); err != nil {
+					return 1, err
+				}
+
+				if !shell.options[name] {
+					status = 1
+				}
+			}
+		}
 
+		return status, nil
 	}
 }
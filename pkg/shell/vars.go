@@ -0,0 +1,343 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// shellVariable is a single entry in the shell's variable table.
+//
+// Variables are kept separately from the process environment: assigning a
+// variable never calls os.Setenv. Only exported variables are passed to
+// external commands, through the Env field of their IOBindings.
+//
+// A variable holds a typed value (see varKind): a string, or an indexed or
+// associative array whose elements are kept by index or key. Arrays are
+// never exported.
+type shellVariable struct {
+	kind     varKind           // The type of value
+	value    string            // Current value of a scalar
+	elements map[string]string // Elements of an array, by index in decimal or by key
+	exported bool              // Whether the variable is passed to child processes
+}
+
+// loadEnvironment seeds the variable table from the process environment.
+//
+// Every environment variable becomes an exported shell variable, so child
+// processes inherit the same environment the shell was started with. IFS
+// is skipped, as an inherited value would change how every script splits
+// its words.
+func (shell *Shell) loadEnvironment() {
+	for _, entry := range os.Environ() {
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok || !isValidName(name) || name == "IFS" {
+			continue
+		}
+
+		shell.vars[name] = &shellVariable{value: value, exported: true}
+	}
+}
+
+// getVar returns the value of a shell variable and whether it is set. The
+// value of an array is its element 0, as in other shells.
+func (shell *Shell) getVar(name string) (string, bool) {
+	return shell.getElement(name, "0")
+}
+
+// getParam returns the value of a parameter and whether it is set.
+//
+// Besides shell variables, parameters include the positional parameters
+// $1, $2, ... (the arguments of the running function or script, or those
+// given to set --) and the special parameters:
+//   - $# : The number of positional parameters
+//   - $@ : The positional parameters joined by spaces; "$@" is one word
+//     per parameter instead (see ExpandPositional)
+//   - $* : The positional parameters joined by the first character of IFS
+//     (a space when IFS is unset, nothing when it is empty)
+//   - $? : The exit status of the last command
+//   - $$ : The process ID of the shell, also inside subshells
+//   - $! : The process ID of the last background command; always unset,
+//     as the shell does not run commands in the background
+//   - $0 : The name of the script, or of the shell itself
+//
+// Example:
+//
+//	// inside `f a b`
+//	shell.getParam("2") → "b", true
+//	shell.getParam("#") → "2", true
+func (shell *Shell) getParam(name string) (string, bool) {
+	switch name {
+	case "#":
+		return strconv.Itoa(len(shell.params)), true
+	case "@":
+		return strings.Join(shell.params, " "), len(shell.params) > 0
+	case "*":
+		separator, ok := shell.getVar("IFS")
+		if !ok {
+			separator = " "
+		}
+
+		if separator != "" {
+			_, size := utf8.DecodeRuneInString(separator)
+			separator = separator[:size]
+		}
+
+		return strings.Join(shell.params, separator), len(shell.params) > 0
+	case "?":
+		return strconv.Itoa(shell.lastStatus), true
+	case "$":
+		return strconv.Itoa(os.Getpid()), true
+	case "!":
+		return "", false
+	case "0":
+		return shell.name, true
+	}
+
+	if n, err := strconv.Atoi(name); err == nil && name[0] != '-' && name[0] != '+' {
+		if n == 0 || n > len(shell.params) {
+			return "", false
+		}
+
+		return shell.params[n-1], true
+	}
+
+	return shell.getVar(name)
+}
+
+// singleQuote quotes value in single quotes so the shell reads it back
+// unchanged. An embedded quote closes the quotes, is escaped and reopens
+// them:
+//
+//	it's → 'it'\''s'
+func singleQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// setBuiltin implements set, which replaces the positional parameters or
+// lists the shell's variables: set [--] [arg ...]
+//
+// The arguments become $1, $2, ...; "--" ends the options, so set -- with
+// nothing after it clears them all. Without arguments, every variable is
+// printed as name='value', or name=([0]='value' ...) for an array, sorted
+// by name. No shell options are supported yet, so any other argument
+// starting with "-" or "+" is rejected with status 2.
+//
+// Inside a function, set changes the function's parameters, and the
+// caller's are restored when it returns.
+//
+// Example:
+//
+//	$ set -- a 'b c'
+//	$ echo $# "$2"
+//	2 b c
+func setBuiltin(args []string, shell *Shell) (int, error) {
+
+	if len(args) == 0 {
+		names := make([]string, 0, len(shell.vars))
+		for name := range shell.vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if _, err := fmt.Fprintf(shell.Out, "%s=%s\n", name, shell.vars[name].format()); err != nil {
+				return 1, err
+			}
+		}
+		return 0, nil
+	}
+
+	if args[0] == "--" {
+		args = args[1:]
+	} else if len(args[0]) > 1 && (args[0][0] == '-' || args[0][0] == '+') {
+		fmt.Fprintf(shell.Err, "set: %s: invalid option\n", args[0])
+		return 2, nil
+	}
+
+	shell.params = slices.Clone(args)
+	return 0, nil
+}
+
+// setVar assigns a shell variable, keeping its exported attribute. For an
+// array, it assigns element 0.
+//
+// Assigning PATH also refreshes the directories used by Lookup, so a new
+// PATH takes effect for the next command.
+func (shell *Shell) setVar(name, value string) {
+	if v, ok := shell.vars[name]; ok && v.kind != scalarVar {
+		v.elements["0"] = value
+	} else if ok {
+		v.value = value
+	} else {
+		shell.vars[name] = &shellVariable{value: value}
+	}
+
+	if name == "PATH" {
+		shell.pathDirs = splitPath(value)
+	}
+}
+
+// unsetVar removes a shell variable entirely, including its export.
+func (shell *Shell) unsetVar(name string) {
+	delete(shell.vars, name)
+
+	if name == "PATH" {
+		shell.pathDirs = nil
+	}
+}
+
+// exportVar marks a variable for export, creating it empty if needed.
+func (shell *Shell) exportVar(name string) {
+	if _, ok := shell.vars[name]; !ok {
+		shell.setVar(name, "")
+	}
+
+	shell.vars[name].exported = true
+}
+
+// environ builds the environment for an external command.
+//
+// The result contains every exported variable followed by the temporary
+// assignments given as "NAME=value" strings (as in `FOO=1 cmd`), which
+// override exported values of the same name. Entries are sorted by name so
+// child processes see a stable environment.
+//
+// Parameters:
+//   - assignments: Command-prefix assignments that apply only to this command
+//
+// Returns:
+//   - []string: Environment in os/exec "NAME=value" form
+func (shell *Shell) environ(assignments []string) []string {
+	env := map[string]string{}
+
+	for name, v := range shell.vars {
+		if v.exported && v.kind == scalarVar {
+			env[name] = v.value
+		}
+	}
+
+	for _, assignment := range assignments {
+		name, value, _ := splitAssignment(assignment)
+
+		if isValidName(name) {
+			env[name] = value
+		}
+	}
+
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		result = append(result, name+"="+env[name])
+	}
+
+	return result
+}
+
+// splitPath splits a PATH value into its directories.
+func splitPath(path string) []string {
+	if path == "" {
+		return nil
+	}
+
+	return strings.Split(path, string(os.PathListSeparator))
+}
+
+// isValidName reports whether name is a valid shell variable name: a letter
+// or underscore followed by letters, digits and underscores.
+func isValidName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for i, ch := range name {
+		if ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') {
+			continue
+		}
+
+		if i > 0 && ch >= '0' && ch <= '9' {
+			continue
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// isSpecialParam reports whether ch names a parameter on its own after a
+// "$": a digit for a positional parameter or $0, or one of # @ * ? $ !.
+func isSpecialParam(ch rune) bool {
+	return (ch >= '0' && ch <= '9') || strings.ContainsRune("#@*?$!", ch)
+}
+
+// paramRefLength returns the length of the parameter reference at the
+// start of expr: a parameter name, followed for variables by an optional
+// [subscript] (see subscriptLength).
+func paramRefLength(expr string) int {
+	n := paramNameLength(expr)
+
+	if !isValidName(expr[:n]) {
+		return n
+	}
+
+	return n + subscriptLength(expr[n:])
+}
+
+// paramNameLength returns the length of the parameter name at the start of
+// expr, the text of a ${...} expansion: a run of digits for a positional
+// parameter, a single special parameter character, or a variable name.
+func paramNameLength(expr string) int {
+	if expr == "" {
+		return 0
+	}
+
+	if expr[0] >= '0' && expr[0] <= '9' {
+		return len(expr) - len(strings.TrimLeft(expr, "0123456789"))
+	}
+
+	if isSpecialParam(rune(expr[0])) {
+		return 1
+	}
+
+	n := 0
+	for n < len(expr) && (isNameStart(rune(expr[n])) || (n > 0 && expr[n] >= '0' && expr[n] <= '9')) {
+		n++
+	}
+
+	return n
+}
+
+// splitAssignment splits a "NAME=value" or "NAME[subscript]=value" word
+// into its name, subscript included, and value.
+//
+// Returns ok=false when the word has no "=" or the part before it is not a
+// valid variable name, in which case the word is an ordinary argument.
+//
+// Example:
+//
+//	splitAssignment("arr[i+1]=x") → "arr[i+1]", "x", true
+func splitAssignment(word string) (name, value string, ok bool) {
+	name, value, found := strings.Cut(word, "=")
+	if found && isValidName(name) {
+		return name, value, true
+	}
+
+	base, rest, found := strings.Cut(word, "[")
+	end := strings.Index(rest, "]=")
+
+	if !found || !isValidName(base) || end < 0 {
+		return "", "", false
+	}
+
+	return word[:len(base)+end+2], rest[end+2:], true
+}
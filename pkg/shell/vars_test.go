@@ -0,0 +1,195 @@
+package shell
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSpecialParameters(t *testing.T) {
+
+	pid := strconv.Itoa(os.Getpid())
+
+	tests := []struct {
+		name           string
+		script         string
+		expected       string
+		expectedStatus int
+	}{
+		{name: "status of the last command", script: "((0)); echo $?; echo $?", expected: "1\n0\n"},
+		{name: "status of a missing command", script: "nosuchcommand 2>/dev/null; echo $?", expected: "127\n"},
+		{name: "status in braces", script: "((0)); echo ${?}", expected: "1\n"},
+		{name: "process ID", script: "echo $$", expected: pid + "\n"},
+		{name: "process ID in a subshell", script: "(echo $$); echo $(echo $$)", expected: pid + "\n" + pid + "\n"},
+		{name: "last background job is unset", script: "echo \"[${!-unset}]\"", expected: "[unset]\n"},
+		{name: "set positional parameters", script: "set -- a 'b c'; echo $# $1 \"$2\"", expected: "2 a b c\n"},
+		{name: "quoted @ in an assignment", script: "set -- 'a b' c; x=\"$@\"; echo \"[$x]\"", expected: "[a b c]\n"},
+		{name: "quoted @ as a case word", script: "set -- 'a b' c; case \"$@\" in 'a b c') echo match;; esac", expected: "match\n"},
+		{name: "quoted @ in a here-string", script: "set -- 'a b' c; cat <<< \"$@\"", expected: "a b c\n"},
+		{name: "quoted @ without parameters in an assignment", script: "set --; x=\"$@\"; echo \"[$x]\"", expected: "[]\n"},
+		{name: "set without --", script: "set x y; echo $2", expected: "y\n"},
+		{name: "set -- clears them", script: "set a b; set --; echo $#", expected: "0\n"},
+		{name: "quoted $@ keeps each parameter", script: "set -- a 'b c' ''; for x in \"$@\"; do echo \"[$x]\"; done", expected: "[a]\n[b c]\n[]\n"},
+		{name: "quoted $@ without parameters", script: "for x in \"$@\"; do echo never; done; echo done", expected: "done\n"},
+		{name: "quoted $@ joined to text", script: "set -- a b c; for x in \"<$@>\"; do echo $x; done", expected: "<a\nb\nc>\n"},
+		{name: "unquoted $@ is split", script: "set -- 'a b' c; for x in $@; do echo $x; done", expected: "a\nb\nc\n"},
+		{name: "unquoted $* drops empty parameters", script: "set -- '' a ''; for x in $*; do echo \"[$x]\"; done", expected: "[a]\n"},
+		{name: "quoted $* is one word", script: "set -- a 'b c'; for x in \"$*\"; do echo \"[$x]\"; done", expected: "[a b c]\n"},
+		{name: "quoted $* joins with IFS", script: "set -- a b c; IFS=,; echo \"$*\"", expected: "a,b,c\n"},
+		{name: "quoted $* with an empty IFS", script: "set -- a b c; IFS=; echo \"$*\"", expected: "abc\n"},
+		{name: "empty quotes are arguments", script: "set -- '' \"\" x; echo $#", expected: "3\n"},
+		{name: "set inside a function", script: "f() { set -- x; echo $1; }; set -- a; f; echo $1", expected: "x\na\n"},
+		{name: "set in a subshell", script: "set -- a; (set -- b); echo $1", expected: "a\n"},
+		{name: "invalid option", script: "set -x", expectedStatus: 2},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, status := runScript(t, tt.script)
+
+			if got != tt.expected {
+				t.Errorf("script: %q\nexpected: %q\ngot:      %q", tt.script, tt.expected, got)
+			}
+
+			if status != tt.expectedStatus {
+				t.Errorf("expected status %d got %d", tt.expectedStatus, status)
+			}
+
+		})
+
+	}
+
+}
+
+func TestSetBuiltin_ListsVariables(t *testing.T) {
+
+	got, _ := runScript(t, "greeting=\"it's me\"; set")
+
+	if !strings.Contains(got, "greeting='it'\\''s me'\n") {
+		t.Errorf("expected the variable in the listing, got %q", got)
+	}
+
+}
+
+func TestSetScript(t *testing.T) {
+
+	var stdout bytes.Buffer
+	sh := New(strings.NewReader("echo $0 $# \"$2\"\nif true\nthen echo yes\nfi\n"), &stdout, io.Discard)
+	sh.SetScript("build.sh", []string{"a", "b c"})
+
+	if err := sh.Run(); err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+
+	// no "$ " or "> " prompts are printed for scripts
+	if got, expected := stdout.String(), "build.sh 2 b c\nyes\n"; got != expected {
+		t.Errorf("expected %q got %q", expected, got)
+	}
+
+}
+
+func TestSetStdin(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "s.sh")
+	if err := os.WriteFile(path, []byte("cat\necho done\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	script, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer script.Close()
+
+	// the script is read from the file, its commands read the given stdin
+	var stdout bytes.Buffer
+	sh := New(script, &stdout, io.Discard)
+	sh.SetScript(path, nil)
+	sh.SetStdin(strings.NewReader("data\n"))
+
+	if err := sh.Run(); err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+
+	if got, expected := stdout.String(), "data\ndone\n"; got != expected {
+		t.Errorf("expected %q got %q", expected, got)
+	}
+
+}
+
+func TestFieldSplitting(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		script   string
+		expected string
+	}{
+		{name: "variables are split", script: "x='a  b'; set -- $x; echo $#", expected: "2\n"},
+		{name: "quoted variables are not", script: "x='a  b'; set -- \"$x\"; echo $#", expected: "1\n"},
+		{name: "custom IFS", script: "IFS=:; p=/bin:/usr/bin; for d in $p; do echo $d; done", expected: "/bin\n/usr/bin\n"},
+		{name: "empty fields", script: "IFS=,; x=a,,b; set -- $x; echo $#", expected: "3\n"},
+		{name: "empty IFS", script: "IFS=; x='a b'; set -- $x; echo $#", expected: "1\n"},
+		{name: "unset IFS restores the default", script: "IFS=,; unset IFS; x='a b'; set -- $x; echo $#", expected: "2\n"},
+		{name: "command substitution", script: "IFS=-; for x in $(echo a-b); do echo $x; done", expected: "a\nb\n"},
+		{name: "arithmetic expansion", script: "IFS=0; echo $((101 * 2))", expected: "2 2\n"},
+		{name: "assignments are not split", script: "IFS=,; x=a,b; y=$x; echo \"$y\"", expected: "a,b\n"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			if got, _ := runScript(t, tt.script); got != tt.expected {
+				t.Errorf("script: %q\nexpected: %q\ngot:      %q", tt.script, tt.expected, got)
+			}
+
+		})
+
+	}
+
+}
+
+func TestAssignmentStatus(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		script         string
+		expected       string
+		expectedStatus int
+	}{
+		{name: "failing substitution", script: "a=$(false); echo $?", expected: "1\n"},
+		{name: "status drives or", script: "x=$(false) || echo failed", expected: "failed\n"},
+		{name: "status drives if", script: "if out=$(echo hi; exit 3); then echo yes; else echo \"no $out\"; fi", expected: "no hi\n"},
+		{name: "exit status is kept", script: "x=$(exit 4)", expectedStatus: 4},
+		{name: "last substitution wins", script: "x=$(false) y=$(true)", expectedStatus: 0},
+		{name: "without a substitution", script: "false; x=1", expectedStatus: 0},
+		{name: "empty command from a substitution", script: "$(false)", expectedStatus: 1},
+		{name: "command name gives the status", script: "x=$(false) true", expectedStatus: 0},
+		{name: "earlier commands do not count", script: "x=$(false); y=1", expectedStatus: 0},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, status := runScript(t, tt.script)
+
+			if got != tt.expected {
+				t.Errorf("script: %q\nexpected: %q\ngot:      %q", tt.script, tt.expected, got)
+			}
+
+			if status != tt.expectedStatus {
+				t.Errorf("expected status %d got %d", tt.expectedStatus, status)
+			}
+
+		})
+
+	}
+
+}